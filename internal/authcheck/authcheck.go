@@ -0,0 +1,313 @@
+package authcheck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mailcli/internal/email"
+	"mailcli/internal/textutil"
+
+	"github.com/emersion/go-message"
+	gomail "github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/emersion/go-msgauth/authres"
+	"github.com/emersion/go-msgauth/dkim"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Options configures Check.
+type Options struct {
+	// LookupTXT resolves DKIM public key records; defaults to
+	// net.DefaultResolver.LookupTXT.
+	LookupTXT func(ctx context.Context, name string) ([]string, error)
+	// KnownDomains are compared with the From domain to spot lookalikes,
+	// typically the user's own domains.
+	KnownDomains []string
+}
+
+// Verdict is one method result from an Authentication-Results header.
+type Verdict struct {
+	Method string
+	Result string
+	// Domain is the identity the result applies to, such as header.d for
+	// DKIM or smtp.mailfrom for SPF.
+	Domain string
+	Reason string
+}
+
+// ServerResults is one Authentication-Results header.
+type ServerResults struct {
+	AuthServID string
+	Verdicts   []Verdict
+}
+
+// ARCSet summarizes one ARC instance from its seal and results headers.
+type ARCSet struct {
+	Instance   int
+	Domain     string
+	Chain      string
+	AuthServID string
+	Verdicts   []Verdict
+}
+
+// Signature is the outcome of verifying one DKIM-Signature locally.
+type Signature struct {
+	Domain string
+	Err    error
+	// Aligned reports whether Domain shares the From domain's
+	// organizational domain, as DMARC requires.
+	Aligned bool
+}
+
+// Report gathers what is known about a message's authenticity.
+// Authentication-Results are listed newest first; only those added by your
+// own provider can be trusted, since a sender can forge the rest.
+type Report struct {
+	From       string
+	FromDomain string
+	Results    []ServerResults
+	ARC        []ARCSet
+	Signatures []Signature
+	Warnings   []string
+}
+
+// Check parses the authentication headers of raw and verifies its DKIM
+// signatures. Cancelling ctx aborts the DNS lookups.
+func Check(ctx context.Context, raw []byte, opts Options) (*Report, error) {
+	if opts.LookupTXT == nil {
+		opts.LookupTXT = net.DefaultResolver.LookupTXT
+	}
+	raw = email.CanonicalLineEndings(raw)
+	h, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	header := gomail.Header{Header: message.Header{Header: h}}
+
+	r := &Report{}
+	if from, err := header.AddressList("From"); err == nil && len(from) > 0 {
+		r.From = from[0].Address
+		r.FromDomain = domainOf(from[0].Address)
+		r.checkDisplayName(from[0])
+	}
+
+	for _, value := range h.Values("Authentication-Results") {
+		id, results, err := authres.Parse(value)
+		if err != nil {
+			r.warnf("unparsable Authentication-Results header: %v", err)
+			continue
+		}
+		r.Results = append(r.Results, ServerResults{AuthServID: id, Verdicts: verdicts(results)})
+	}
+	r.ARC = parseARC(h)
+
+	lookup := func(name string) ([]string, error) { return opts.LookupTXT(ctx, name) }
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(raw), &dkim.VerifyOptions{LookupTXT: lookup})
+	if err != nil {
+		r.warnf("DKIM verification stopped: %v", err)
+	}
+	for _, v := range verifications {
+		r.Signatures = append(r.Signatures, Signature{
+			Domain:  v.Domain,
+			Err:     v.Err,
+			Aligned: r.FromDomain != "" && sameOrganization(v.Domain, r.FromDomain),
+		})
+	}
+
+	r.checkAlignment(header)
+	r.checkLookalike(opts.KnownDomains)
+	return r, nil
+}
+
+func (r *Report) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// checkDisplayName flags a display name that quotes a different address,
+// as in "ceo@example.com" <someone@elsewhere.test>.
+func (r *Report) checkDisplayName(from *gomail.Address) {
+	for _, field := range strings.FieldsFunc(from.Name, func(c rune) bool { return c == ' ' || c == '<' || c == '>' || c == '"' }) {
+		if domain := domainOf(field); strings.Contains(field, "@") && domain != "" && !sameOrganization(domain, r.FromDomain) {
+			r.warnf("From display name mentions %s but the address is %s", field, from.Address)
+			return
+		}
+	}
+}
+
+// checkAlignment flags a From domain that nothing vouches for: no valid
+// aligned DKIM signature, and envelope or reply addresses elsewhere.
+func (r *Report) checkAlignment(header gomail.Header) {
+	if r.FromDomain == "" {
+		r.warnf("message has no valid From address")
+		return
+	}
+	aligned := false
+	for _, sig := range r.Signatures {
+		if sig.Err == nil && sig.Aligned {
+			aligned = true
+		}
+	}
+	if !aligned {
+		r.warnf("no valid DKIM signature from the From domain %s", r.FromDomain)
+	}
+
+	if len(r.Results) > 0 {
+		for _, v := range r.Results[0].Verdicts {
+			if v.Method == "spf" && v.Domain != "" && !sameOrganization(v.Domain, r.FromDomain) {
+				r.warnf("envelope sender domain %s differs from the From domain %s", v.Domain, r.FromDomain)
+			}
+		}
+	}
+	if replyTo, err := header.AddressList("Reply-To"); err == nil {
+		for _, addr := range replyTo {
+			if domain := domainOf(addr.Address); domain != "" && !sameOrganization(domain, r.FromDomain) {
+				r.warnf("Reply-To %s differs from the From domain %s", addr.Address, r.FromDomain)
+			}
+		}
+	}
+}
+
+// checkLookalike flags internationalized From domains and domains one edit
+// or one confusable character away from a known domain.
+func (r *Report) checkLookalike(known []string) {
+	if r.FromDomain == "" {
+		return
+	}
+	if strings.Contains(r.FromDomain, "xn--") || !textutil.IsASCII(r.FromDomain) {
+		r.warnf("From domain %s uses internationalized characters that can imitate other domains", r.FromDomain)
+	}
+	from := organization(r.FromDomain)
+	for _, domain := range known {
+		domain = organization(strings.ToLower(strings.TrimSpace(domain)))
+		if domain == "" || domain == from {
+			continue
+		}
+		if skeleton(domain) == skeleton(from) || (len(domain) >= 6 && editDistance(domain, from) <= 1) {
+			r.warnf("From domain %s looks like %s", r.FromDomain, domain)
+		}
+	}
+}
+
+func verdicts(results []authres.Result) []Verdict {
+	var out []Verdict
+	for _, res := range results {
+		switch v := res.(type) {
+		case *authres.SPFResult:
+			out = append(out, Verdict{Method: "spf", Result: string(v.Value), Domain: domainOf(textutil.FirstNonEmpty(v.From, v.Helo)), Reason: v.Reason})
+		case *authres.DKIMResult:
+			out = append(out, Verdict{Method: "dkim", Result: string(v.Value), Domain: v.Domain, Reason: v.Reason})
+		case *authres.DMARCResult:
+			out = append(out, Verdict{Method: "dmarc", Result: string(v.Value), Domain: v.From, Reason: v.Reason})
+		case *authres.ARCResult:
+			out = append(out, Verdict{Method: "arc", Result: string(v.Value)})
+		case *authres.AuthResult:
+			out = append(out, Verdict{Method: "auth", Result: string(v.Value), Reason: v.Reason})
+		case *authres.IPRevResult:
+			out = append(out, Verdict{Method: "iprev", Result: string(v.Value), Domain: v.IP, Reason: v.Reason})
+		case *authres.GenericResult:
+			out = append(out, Verdict{Method: v.Method, Result: string(v.Value)})
+		}
+	}
+	return out
+}
+
+// parseARC reads ARC-Seal and ARC-Authentication-Results headers. The seals
+// are reported as stated; they are not verified cryptographically.
+func parseARC(h textproto.Header) []ARCSet {
+	sets := map[int]*ARCSet{}
+	get := func(i int) *ARCSet {
+		if sets[i] == nil {
+			sets[i] = &ARCSet{Instance: i}
+		}
+		return sets[i]
+	}
+	for _, value := range h.Values("ARC-Seal") {
+		tags := parseTags(value)
+		i, err := strconv.Atoi(tags["i"])
+		if err != nil {
+			continue
+		}
+		set := get(i)
+		set.Domain, set.Chain = tags["d"], tags["cv"]
+	}
+	for _, value := range h.Values("ARC-Authentication-Results") {
+		instance, rest, ok := strings.Cut(value, ";")
+		i, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(instance), "i=")))
+		if !ok || err != nil {
+			continue
+		}
+		id, results, err := authres.Parse(rest)
+		if err != nil {
+			continue
+		}
+		set := get(i)
+		set.AuthServID, set.Verdicts = id, verdicts(results)
+	}
+	out := make([]ARCSet, 0, len(sets))
+	for _, set := range sets {
+		out = append(out, *set)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Instance > out[b].Instance })
+	return out
+}
+
+func parseTags(value string) map[string]string {
+	tags := map[string]string{}
+	for _, part := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if ok {
+			tags[strings.TrimSpace(k)] = strings.Join(strings.Fields(v), "")
+		}
+	}
+	return tags
+}
+
+func domainOf(addr string) string {
+	i := strings.LastIndex(addr, "@")
+	return strings.ToLower(strings.Trim(addr[i+1:], " .>"))
+}
+
+// organization returns the registrable domain, e.g. example.co.uk for
+// mail.example.co.uk.
+func organization(domain string) string {
+	if org, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		return org
+	}
+	return domain
+}
+
+func sameOrganization(a, b string) bool {
+	return strings.EqualFold(organization(strings.ToLower(a)), organization(strings.ToLower(b)))
+}
+
+// skeleton maps characters commonly swapped in lookalike domains onto one
+// form.
+func skeleton(domain string) string {
+	return strings.NewReplacer("rn", "m", "vv", "w", "0", "o", "1", "l", "i", "l", "5", "s", "-", "").Replace(domain)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
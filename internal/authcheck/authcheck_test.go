@@ -0,0 +1,139 @@
+package authcheck
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"mailcli/internal/dkim"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject: invoice\r\n" +
+	"Date: Mon, 19 Oct 2026 09:00:00 +0000\r\n" +
+	"Message-ID: <1@example.com>\r\n" +
+	"\r\n" +
+	"Please pay.\r\n"
+
+func signedMessage(t *testing.T, domain string) ([]byte, func(context.Context, string) ([]string, error)) {
+	t.Helper()
+	key, err := dkim.GenerateKey(dkim.AlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	record, err := dkim.Record(key)
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	signed, err := (&dkim.Signer{Domain: domain, Selector: "s1", Key: key}).Sign([]byte(testMessage))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	lookup := func(ctx context.Context, name string) ([]string, error) {
+		if name != dkim.RecordName("s1", domain) {
+			return nil, errors.New("no such record")
+		}
+		return []string{record}, nil
+	}
+	return signed, lookup
+}
+
+func prepend(headers string, raw []byte) []byte {
+	return append([]byte(headers), raw...)
+}
+
+func TestCheckAlignedMessage(t *testing.T) {
+	signed, lookup := signedMessage(t, "mail.example.com")
+	raw := prepend("Authentication-Results: mx.example.org;\r\n"+
+		" spf=pass smtp.mailfrom=bounce@example.com;\r\n"+
+		" dkim=pass header.d=mail.example.com;\r\n"+
+		" dmarc=pass header.from=example.com\r\n"+
+		"ARC-Seal: i=1; a=rsa-sha256; cv=none; d=relay.example.net; s=arc; b=abc\r\n"+
+		"ARC-Authentication-Results: i=1; relay.example.net; spf=pass smtp.mailfrom=example.com\r\n", signed)
+
+	r, err := Check(context.Background(), raw, Options{LookupTXT: lookup, KnownDomains: []string{"example.org"}})
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if r.FromDomain != "example.com" {
+		t.Fatalf("unexpected from domain %q", r.FromDomain)
+	}
+	if len(r.Results) != 1 || r.Results[0].AuthServID != "mx.example.org" || len(r.Results[0].Verdicts) != 3 {
+		t.Fatalf("unexpected results: %+v", r.Results)
+	}
+	if v := r.Results[0].Verdicts[2]; v.Method != "dmarc" || v.Result != "pass" || v.Domain != "example.com" {
+		t.Fatalf("unexpected dmarc verdict: %+v", v)
+	}
+	if len(r.ARC) != 1 || r.ARC[0].Chain != "none" || r.ARC[0].AuthServID != "relay.example.net" {
+		t.Fatalf("unexpected ARC sets: %+v", r.ARC)
+	}
+	if len(r.Signatures) != 1 || r.Signatures[0].Err != nil || !r.Signatures[0].Aligned {
+		t.Fatalf("expected one valid aligned signature, got %+v", r.Signatures)
+	}
+	if len(r.Warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", r.Warnings)
+	}
+}
+
+func TestCheckFlagsSpoofingSigns(t *testing.T) {
+	signed, lookup := signedMessage(t, "bulk-sender.test")
+	raw := prepend("Reply-To: payments@elsewhere.test\r\n"+
+		"Authentication-Results: mx.example.org; spf=pass smtp.mailfrom=bulk-sender.test\r\n", signed)
+	raw = []byte(strings.Replace(string(raw), "From: Alice <alice@example.com>", "From: \"ceo@examp1e.org\" <alice@examp1e.org>", 1))
+
+	r, err := Check(context.Background(), raw, Options{LookupTXT: lookup, KnownDomains: []string{"example.org"}})
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if len(r.Signatures) != 1 || r.Signatures[0].Err == nil {
+		t.Fatalf("expected the rewritten From to break the signature, got %+v", r.Signatures)
+	}
+	warnings := strings.Join(r.Warnings, "\n")
+	for _, want := range []string{
+		"no valid DKIM signature from the From domain examp1e.org",
+		"envelope sender domain bulk-sender.test differs",
+		"Reply-To payments@elsewhere.test differs",
+		"From domain examp1e.org looks like example.org",
+	} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("missing warning %q in:\n%s", want, warnings)
+		}
+	}
+}
+
+func TestCheckFlagsDisplayNameAndIDN(t *testing.T) {
+	raw := []byte(strings.Replace(testMessage, "From: Alice <alice@example.com>",
+		"From: \"security@bank.test\" <alerts@xn--bnk-sna.test>", 1))
+	r, err := Check(context.Background(), raw, Options{LookupTXT: func(context.Context, string) ([]string, error) { return nil, errors.New("unused") }})
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	warnings := strings.Join(r.Warnings, "\n")
+	if !strings.Contains(warnings, "display name mentions security@bank.test") || !strings.Contains(warnings, "internationalized characters") {
+		t.Fatalf("unexpected warnings:\n%s", warnings)
+	}
+}
+
+func TestCheckPassesContextToLookups(t *testing.T) {
+	signed, lookup := signedMessage(t, "example.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var seen error
+	r, err := Check(ctx, signed, Options{LookupTXT: func(ctx context.Context, name string) ([]string, error) {
+		if seen = ctx.Err(); seen != nil {
+			return nil, seen
+		}
+		return lookup(ctx, name)
+	}})
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if !errors.Is(seen, context.Canceled) {
+		t.Fatalf("expected the lookup to see the cancelled context, got %v", seen)
+	}
+	if len(r.Signatures) != 1 || r.Signatures[0].Err == nil {
+		t.Fatalf("expected the signature check to fail, got %+v", r.Signatures)
+	}
+}
@@ -0,0 +1,358 @@
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"mailcli/internal/email"
+)
+
+// Actions of a delivery status notification (RFC 3464 section 2.3.3).
+const (
+	ActionFailed    = "failed"
+	ActionDelayed   = "delayed"
+	ActionDelivered = "delivered"
+	ActionRelayed   = "relayed"
+	ActionExpanded  = "expanded"
+)
+
+// maxDepth bounds how deeply nested multiparts are searched.
+const maxDepth = 5
+
+// Recipient is the outcome of delivery to one recipient.
+type Recipient struct {
+	Address           string `json:"address"`
+	OriginalRecipient string `json:"original_recipient,omitempty"`
+	Action            string `json:"action"`
+	// Status is the enhanced status code (RFC 3463), e.g. 5.1.1.
+	Status     string `json:"status,omitempty"`
+	Diagnostic string `json:"diagnostic,omitempty"`
+	RemoteMTA  string `json:"remote_mta,omitempty"`
+}
+
+// Permanent reports whether delivery failed for good, so the address
+// should not be retried.
+func (r Recipient) Permanent() bool {
+	if r.Status != "" {
+		return strings.HasPrefix(r.Status, "5")
+	}
+	return r.Action == ActionFailed
+}
+
+// Bounce is a delivery report about a message sent earlier.
+type Bounce struct {
+	// Standard is true for RFC 3464 delivery status notifications and false
+	// for bounces recognised from their sender, subject and wording.
+	Standard          bool
+	ReportingMTA      string
+	OriginalMessageID string
+	Recipients        []Recipient
+}
+
+// Parse recognises a bounce and extracts its recipients. It reports false
+// for any other message.
+func Parse(raw []byte) (*Bounce, bool) {
+	raw = email.CanonicalLineEndings(raw)
+	var status, original []byte
+	walk(raw, 0, func(mediaType string, entity []byte) {
+		switch mediaType {
+		case "message/delivery-status", "message/global-delivery-status":
+			if status == nil {
+				status, _ = email.DecodePart(entity)
+			}
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/global-headers":
+			if original == nil {
+				original, _ = email.DecodePart(entity)
+			}
+		}
+	})
+
+	var b *Bounce
+	if status != nil {
+		b = parseDeliveryStatus(status)
+	}
+	if b == nil || len(b.Recipients) == 0 {
+		b = parseHeuristic(raw)
+	}
+	if b == nil || len(b.Recipients) == 0 {
+		return nil, false
+	}
+	if original != nil {
+		b.OriginalMessageID = readFields(original)[0].Get("Message-Id")
+	}
+	if b.OriginalMessageID == "" {
+		// Without an attached copy, look for the original's headers quoted in
+		// the body, past the bounce's own header.
+		_, body, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+		if m := messageIDLine.FindSubmatch(body); m != nil {
+			b.OriginalMessageID = string(m[1])
+		}
+	}
+	return b, true
+}
+
+// walk visits an entity and, for multiparts, each of its parts.
+func walk(entity []byte, depth int, visit func(mediaType string, entity []byte)) {
+	mediaType, params, ok := email.MediaType(entity)
+	if !ok {
+		return
+	}
+	visit(mediaType, entity)
+	if !strings.HasPrefix(mediaType, "multipart/") || depth >= maxDepth {
+		return
+	}
+	parts, err := email.SplitMultipart(entity, params["boundary"])
+	if err != nil {
+		return
+	}
+	for _, part := range parts {
+		walk(part, depth+1, visit)
+	}
+}
+
+// parseDeliveryStatus reads the per-message fields and the per-recipient
+// field groups of a message/delivery-status body.
+func parseDeliveryStatus(data []byte) *Bounce {
+	groups := readFields(data)
+	b := &Bounce{Standard: true, ReportingMTA: typedValue(groups[0].Get("Reporting-Mta"))}
+	for _, g := range groups[1:] {
+		r := Recipient{
+			Address:           typedValue(g.Get("Final-Recipient")),
+			OriginalRecipient: typedValue(g.Get("Original-Recipient")),
+			Action:            strings.ToLower(strings.TrimSpace(g.Get("Action"))),
+			Diagnostic:        typedValue(g.Get("Diagnostic-Code")),
+			RemoteMTA:         typedValue(g.Get("Remote-Mta")),
+		}
+		if fields := strings.Fields(g.Get("Status")); len(fields) > 0 {
+			r.Status = fields[0]
+		}
+		if r.Address == "" {
+			r.Address = r.OriginalRecipient
+		}
+		if r.Address != "" {
+			b.Recipients = append(b.Recipients, r)
+		}
+	}
+	return b
+}
+
+// readFields parses blank-line separated groups of header fields. The
+// result always has at least one (possibly empty) group.
+func readFields(data []byte) []textproto.MIMEHeader {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(bytes.TrimLeft(data, "\r\n"))))
+	var groups []textproto.MIMEHeader
+	for {
+		h, err := r.ReadMIMEHeader()
+		if len(h) > 0 {
+			groups = append(groups, h)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if len(groups) == 0 {
+		groups = append(groups, textproto.MIMEHeader{})
+	}
+	return groups
+}
+
+// typedValue strips the type from "rfc822; user@example.com" or
+// "smtp; 550 ...".
+func typedValue(v string) string {
+	if _, rest, ok := strings.Cut(v, ";"); ok {
+		v = rest
+	}
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "<") && strings.HasSuffix(v, ">") {
+		v = v[1 : len(v)-1]
+	}
+	return v
+}
+
+var (
+	bounceSubject = regexp.MustCompile(`(?i)undeliver|delivery (status notification|failure|has failed|failed|problem)|returned mail|failure notice|mail delivery (failed|failure|system)|could not be delivered|non-?delivery`)
+	delaySubject  = regexp.MustCompile(`(?i)delayed|delay notification|still being retried`)
+	// copyMarker starts the quoted original message in a bounce body.
+	copyMarker = regexp.MustCompile(`(?im)^\s*-+.*(copy of the|below this line|original message|returned message|message headers follow)`)
+	// angleLine matches "<user@example.com>: diagnostic" (qmail, Postfix).
+	angleLine = regexp.MustCompile(`^\s*<([^\s<>]+@[^\s<>]+)>:?\s*(.*)$`)
+	// bareLine matches an indented address alone on its line (Exim).
+	bareLine      = regexp.MustCompile(`^\s+([^\s<>:;,"]+@[^\s<>:;,"]+\.[^\s<>:;,"]+)\s*$`)
+	enhancedCode  = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+	replyCode     = regexp.MustCompile(`\b([45])\d\d[ -]`)
+	messageIDLine = regexp.MustCompile(`(?im)^\s*Message-ID:\s*(<[^>\s]+>)`)
+)
+
+// parseHeuristic recognises the bounces of servers that do not send RFC
+// 3464 reports: qmail's "failure notice", Exim's X-Failed-Recipients and
+// plain-text notices from mailer daemons.
+func parseHeuristic(raw []byte) *Bounce {
+	header := readFields(raw)[0]
+	failed := splitAddresses(header.Get("X-Failed-Recipients"))
+	subject := header.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	if len(failed) == 0 && !isDaemon(header.Get("From")) && !isBounceSubject(subject) {
+		return nil
+	}
+	body, err := email.ParseBody(raw)
+	if err != nil {
+		return nil
+	}
+	text := body.Text
+	if loc := copyMarker.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	action := ActionFailed
+	if delaySubject.MatchString(subject) {
+		action = ActionDelayed
+	}
+
+	found := scanRecipients(text)
+	b := &Bounce{}
+	add := func(addr, diagnostic string) {
+		b.Recipients = append(b.Recipients, Recipient{
+			Address:    addr,
+			Action:     action,
+			Status:     statusCode(diagnostic),
+			Diagnostic: diagnostic,
+		})
+	}
+	if len(failed) > 0 {
+		for _, addr := range failed {
+			diagnostic, ok := found[strings.ToLower(addr)]
+			if !ok {
+				diagnostic = firstCodeLine(text)
+			}
+			add(addr, diagnostic)
+		}
+		return b
+	}
+	for _, addr := range foundOrder(text) {
+		add(addr, found[strings.ToLower(addr)])
+	}
+	return b
+}
+
+// isBounceSubject matches the usual bounce subjects, but not replies to or
+// forwards of a bounce.
+func isBounceSubject(subject string) bool {
+	lower := strings.ToLower(strings.TrimSpace(subject))
+	for _, prefix := range []string{"re:", "fw:", "fwd:"} {
+		if strings.HasPrefix(lower, prefix) {
+			return false
+		}
+	}
+	return bounceSubject.MatchString(subject)
+}
+
+func isDaemon(from string) bool {
+	addrs := splitAddresses(from)
+	if len(addrs) == 0 {
+		return false
+	}
+	local, _, _ := strings.Cut(strings.ToLower(addrs[0]), "@")
+	switch local {
+	case "mailer-daemon", "mailer_daemon", "mailerdaemon", "mail-daemon", "postmaster":
+		return true
+	}
+	return false
+}
+
+// scanRecipients maps each address listed in a bounce text to the
+// diagnostic lines that follow it.
+func scanRecipients(text string) map[string]string {
+	found := map[string]string{}
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		addr, rest, ok := recipientLine(lines[i])
+		if !ok {
+			continue
+		}
+		var diag []string
+		if rest != "" {
+			diag = append(diag, rest)
+		}
+		for i+1 < len(lines) && len(diag) < 6 {
+			next := strings.TrimSpace(lines[i+1])
+			if next == "" {
+				break
+			}
+			if _, _, ok := recipientLine(lines[i+1]); ok {
+				break
+			}
+			diag = append(diag, next)
+			i++
+		}
+		key := strings.ToLower(addr)
+		if _, seen := found[key]; !seen {
+			found[key] = strings.Join(diag, " ")
+		}
+	}
+	return found
+}
+
+// foundOrder lists the addresses of scanRecipients in order of appearance.
+func foundOrder(text string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		if addr, _, ok := recipientLine(line); ok && !seen[strings.ToLower(addr)] {
+			seen[strings.ToLower(addr)] = true
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+func recipientLine(line string) (addr, rest string, ok bool) {
+	line = strings.TrimRight(line, "\r")
+	if m := angleLine.FindStringSubmatch(line); m != nil {
+		return m[1], strings.TrimSpace(m[2]), true
+	}
+	if m := bareLine.FindStringSubmatch(line); m != nil {
+		return m[1], "", true
+	}
+	return "", "", false
+}
+
+// statusCode finds the enhanced status code in a diagnostic, falling back
+// to the class of an SMTP reply code.
+func statusCode(diagnostic string) string {
+	if m := enhancedCode.FindStringSubmatch(diagnostic); m != nil {
+		return m[1]
+	}
+	if m := replyCode.FindStringSubmatch(diagnostic + " "); m != nil {
+		return m[1] + ".0.0"
+	}
+	return ""
+}
+
+// firstCodeLine returns the first line of text with an SMTP status code.
+func firstCodeLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); statusCode(line) != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+func splitAddresses(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if i := strings.LastIndex(part, "<"); i >= 0 {
+			part = strings.TrimSuffix(part[i+1:], ">")
+		}
+		if strings.Contains(part, "@") {
+			out = append(out, part)
+		}
+	}
+	return out
+}
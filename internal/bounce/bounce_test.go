@@ -0,0 +1,137 @@
+package bounce
+
+import (
+	"strings"
+	"testing"
+)
+
+const standardDSN = "From: Mail Delivery System <MAILER-DAEMON@mx.example.com>\r\n" +
+	"To: news@example.com\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"Message-ID: <bounce-1@mx.example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"I'm sorry to have to inform you that your message could not be delivered.\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n" +
+	"Arrival-Date: Mon, 19 Oct 2026 09:00:00 +0000\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; gone@example.org\r\n" +
+	"Original-Recipient: rfc822;Gone@Example.org\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Remote-MTA: dns; mx.example.org\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 <gone@example.org>: Recipient address\r\n" +
+	" rejected: User unknown\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; slow@example.net\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.4.1 (connection timed out)\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: news@example.com\r\n" +
+	"Subject: October newsletter\r\n" +
+	"Message-ID: <newsletter-42@example.com>\r\n" +
+	"\r\n" +
+	"--b1--\r\n"
+
+func TestParseStandardDSN(t *testing.T) {
+	b, ok := Parse([]byte(standardDSN))
+	if !ok {
+		t.Fatal("expected a bounce")
+	}
+	if !b.Standard || b.ReportingMTA != "mx.example.com" || b.OriginalMessageID != "<newsletter-42@example.com>" {
+		t.Fatalf("unexpected bounce: %+v", b)
+	}
+	if len(b.Recipients) != 2 {
+		t.Fatalf("expected 2 recipients, got %+v", b.Recipients)
+	}
+	r := b.Recipients[0]
+	if r.Address != "gone@example.org" || r.OriginalRecipient != "Gone@Example.org" || r.Action != ActionFailed || r.Status != "5.1.1" || r.RemoteMTA != "mx.example.org" {
+		t.Fatalf("unexpected recipient: %+v", r)
+	}
+	if r.Diagnostic != "550 5.1.1 <gone@example.org>: Recipient address rejected: User unknown" {
+		t.Fatalf("unexpected diagnostic %q", r.Diagnostic)
+	}
+	if !r.Permanent() {
+		t.Fatal("expected 5.1.1 to be permanent")
+	}
+	if d := b.Recipients[1]; d.Action != ActionDelayed || d.Status != "4.4.1" || d.Permanent() {
+		t.Fatalf("unexpected delayed recipient: %+v", d)
+	}
+}
+
+func TestParseQmailFailureNotice(t *testing.T) {
+	raw := "From: MAILER-DAEMON@mail.example.com\r\n" +
+		"Subject: failure notice\r\n" +
+		"Message-ID: <qmail-bounce@mail.example.com>\r\n" +
+		"\r\n" +
+		"Hi. This is the qmail-send program at mail.example.com.\r\n" +
+		"I'm afraid I wasn't able to deliver your message to the following addresses.\r\n" +
+		"This is a permanent error; I've given up. Sorry it didn't work out.\r\n" +
+		"\r\n" +
+		"<gone@example.org>:\r\n" +
+		"192.0.2.1 does not like recipient.\r\n" +
+		"Remote host said: 550 5.1.1 User unknown\r\n" +
+		"Giving up on 192.0.2.1.\r\n" +
+		"\r\n" +
+		"--- Below this line is a copy of the message.\r\n" +
+		"\r\n" +
+		"From: news@example.com\r\n" +
+		"Message-ID: <newsletter-42@example.com>\r\n" +
+		"To: <other@example.org>:\r\n"
+
+	b, ok := Parse([]byte(raw))
+	if !ok {
+		t.Fatal("expected a bounce")
+	}
+	if b.Standard || b.OriginalMessageID != "<newsletter-42@example.com>" || len(b.Recipients) != 1 {
+		t.Fatalf("unexpected bounce: %+v", b)
+	}
+	r := b.Recipients[0]
+	if r.Address != "gone@example.org" || r.Action != ActionFailed || r.Status != "5.1.1" || !strings.Contains(r.Diagnostic, "User unknown") {
+		t.Fatalf("unexpected recipient: %+v", r)
+	}
+}
+
+func TestParseEximBounce(t *testing.T) {
+	raw := "From: Mail Delivery System <Mailer-Daemon@relay.example.com>\r\n" +
+		"Subject: Mail delivery failed: returning message to sender\r\n" +
+		"X-Failed-Recipients: full@example.org\r\n" +
+		"\r\n" +
+		"A message that you sent could not be delivered to one or more of its\r\n" +
+		"recipients. This is a permanent error. The following address(es) failed:\r\n" +
+		"\r\n" +
+		"  full@example.org\r\n" +
+		"    host mx.example.org [192.0.2.1]\r\n" +
+		"    SMTP error from remote mail server after RCPT TO:<full@example.org>:\r\n" +
+		"    552 mailbox full\r\n"
+
+	b, ok := Parse([]byte(raw))
+	if !ok || len(b.Recipients) != 1 {
+		t.Fatalf("unexpected result: %+v %v", b, ok)
+	}
+	if r := b.Recipients[0]; r.Address != "full@example.org" || r.Status != "5.0.0" || !strings.Contains(r.Diagnostic, "552 mailbox full") {
+		t.Fatalf("unexpected recipient: %+v", r)
+	}
+}
+
+func TestParseIgnoresOrdinaryMail(t *testing.T) {
+	for _, raw := range []string{
+		"From: alice@example.com\r\nSubject: lunch?\r\n\r\n  bob@example.org\r\n",
+		"From: alice@example.com\r\nSubject: Re: Undelivered Mail Returned to Sender\r\n\r\n<bob@example.org>: why did this bounce?\r\n",
+	} {
+		if b, ok := Parse([]byte(raw)); ok {
+			t.Errorf("expected no bounce, got %+v", b)
+		}
+	}
+}
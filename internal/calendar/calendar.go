@@ -0,0 +1,384 @@
+package calendar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// iTIP methods (RFC 5546) used by mailcli.
+const (
+	MethodRequest = "REQUEST"
+	MethodReply   = "REPLY"
+	MethodCancel  = "CANCEL"
+)
+
+// Participation states an attendee can reply with.
+const (
+	PartStatAccepted  = "ACCEPTED"
+	PartStatDeclined  = "DECLINED"
+	PartStatTentative = "TENTATIVE"
+)
+
+const productID = "-//mailcli//mailcli//EN"
+
+// Person is an organizer or attendee.
+type Person struct {
+	Name    string
+	Address string
+	// PartStat and Role are only set for attendees.
+	PartStat string
+	Role     string
+}
+
+// String formats the person as "Name <address>".
+func (p Person) String() string {
+	if p.Name == "" {
+		return p.Address
+	}
+	return fmt.Sprintf("%s <%s>", p.Name, p.Address)
+}
+
+// Event is the displayable part of a VEVENT.
+type Event struct {
+	UID         string
+	Summary     string
+	Location    string
+	Description string
+	Status      string
+	Organizer   Person
+	Attendees   []Person
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	// TZID is the time zone named by DTSTART. Start and End are in UTC when
+	// it is not a zone the system knows.
+	TZID      string
+	Recurring bool
+}
+
+// Invite is a parsed iCalendar object.
+type Invite struct {
+	Method string
+	Events []Event
+	cal    *ical.Calendar
+}
+
+// Parse reads an iCalendar object and its VEVENTs.
+func Parse(data []byte) (*Invite, error) {
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("parse calendar: %w", err)
+	}
+	inv := &Invite{cal: cal}
+	if prop := cal.Props.Get(ical.PropMethod); prop != nil {
+		inv.Method = strings.ToUpper(prop.Value)
+	}
+	for _, comp := range cal.Events() {
+		inv.Events = append(inv.Events, parseEvent(comp.Component))
+	}
+	if len(inv.Events) == 0 {
+		return nil, errors.New("calendar has no events")
+	}
+	return inv, nil
+}
+
+func parseEvent(comp *ical.Component) Event {
+	e := Event{
+		UID:         propText(comp, ical.PropUID),
+		Summary:     propText(comp, ical.PropSummary),
+		Location:    propText(comp, ical.PropLocation),
+		Description: propText(comp, ical.PropDescription),
+		Status:      strings.ToUpper(propText(comp, ical.PropStatus)),
+		Recurring:   comp.Props.Get(ical.PropRecurrenceRule) != nil,
+	}
+	if prop := comp.Props.Get(ical.PropOrganizer); prop != nil {
+		e.Organizer = person(prop)
+	}
+	for i := range comp.Props.Values(ical.PropAttendee) {
+		e.Attendees = append(e.Attendees, person(&comp.Props.Values(ical.PropAttendee)[i]))
+	}
+	if prop := comp.Props.Get(ical.PropDateTimeStart); prop != nil {
+		e.TZID = prop.Params.Get(ical.PropTimezoneID)
+		e.AllDay = prop.ValueType() == ical.ValueDate || len(prop.Value) == len("20060102")
+		e.Start = dateTime(prop)
+	}
+	if prop := comp.Props.Get(ical.PropDateTimeEnd); prop != nil {
+		e.End = dateTime(prop)
+	} else if prop := comp.Props.Get(ical.PropDuration); prop != nil && !e.Start.IsZero() {
+		if d, err := prop.Duration(); err == nil {
+			e.End = e.Start.Add(d)
+		}
+	}
+	return e
+}
+
+// dateTime falls back to UTC when TZID is not an IANA zone, as with the
+// Windows zone names Outlook uses.
+func dateTime(prop *ical.Prop) time.Time {
+	if t, err := prop.DateTime(time.Local); err == nil {
+		return t
+	}
+	t, _ := time.ParseInLocation("20060102T150405", prop.Value, time.UTC)
+	return t
+}
+
+func person(prop *ical.Prop) Person {
+	return Person{
+		Name:     prop.Params.Get(ical.ParamCommonName),
+		Address:  strings.TrimPrefix(strings.TrimPrefix(prop.Value, "mailto:"), "MAILTO:"),
+		PartStat: strings.ToUpper(prop.Params.Get(ical.ParamParticipationStatus)),
+		Role:     strings.ToUpper(prop.Params.Get(ical.ParamRole)),
+	}
+}
+
+func propText(comp *ical.Component, name string) string {
+	text, err := comp.Props.Text(name)
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+// Describe renders the events for display.
+func (inv *Invite) Describe() string {
+	var b strings.Builder
+	switch inv.Method {
+	case MethodRequest:
+		b.WriteString("Invitation")
+	case MethodReply:
+		b.WriteString("Invitation reply")
+	case MethodCancel:
+		b.WriteString("Cancelled event")
+	default:
+		b.WriteString("Calendar event")
+	}
+	b.WriteString("\n")
+	for _, e := range inv.Events {
+		writeField(&b, "Summary", e.Summary)
+		writeField(&b, "When", e.When())
+		writeField(&b, "Location", e.Location)
+		if e.Organizer.Address != "" {
+			writeField(&b, "Organizer", e.Organizer.String())
+		}
+		for _, a := range e.Attendees {
+			line := a.String()
+			if a.PartStat != "" {
+				line += " (" + strings.ToLower(strings.ReplaceAll(a.PartStat, "-", " ")) + ")"
+			}
+			if a.Role == "OPT-PARTICIPANT" {
+				line += ", optional"
+			}
+			writeField(&b, "Attendee", line)
+		}
+		if e.Status == "CANCELLED" && inv.Method != MethodCancel {
+			writeField(&b, "Status", "cancelled")
+		}
+		if e.Description != "" {
+			b.WriteString("\n" + strings.TrimSpace(e.Description) + "\n")
+		}
+	}
+	return b.String()
+}
+
+func writeField(b *strings.Builder, name, value string) {
+	if value != "" {
+		fmt.Fprintf(b, "  %-10s %s\n", name+":", value)
+	}
+}
+
+// When formats the start and end with their time zone.
+func (e Event) When() string {
+	if e.Start.IsZero() {
+		return ""
+	}
+	var when string
+	switch {
+	case e.AllDay:
+		when = e.Start.Format("Mon 2006-01-02")
+		if last := e.End.AddDate(0, 0, -1); !e.End.IsZero() && last.After(e.Start) {
+			when += " to " + last.Format("Mon 2006-01-02")
+		}
+		when += " (all day)"
+	default:
+		when = e.Start.Format("Mon 2006-01-02 15:04")
+		if !e.End.IsZero() {
+			if sameDay(e.Start, e.End) {
+				when += "-" + e.End.Format("15:04")
+			} else {
+				when += " to " + e.End.Format("Mon 2006-01-02 15:04")
+			}
+		}
+		when += " " + zoneLabel(e)
+	}
+	if e.Recurring {
+		when += ", recurring"
+	}
+	return when
+}
+
+func zoneLabel(e Event) string {
+	abbrev, _ := e.Start.Zone()
+	switch {
+	case e.TZID == "":
+		return abbrev
+	case e.Start.Location() == time.UTC && e.TZID != "UTC":
+		// The zone was not recognised; show the times as written.
+		return e.TZID
+	case abbrev != e.TZID:
+		return fmt.Sprintf("%s (%s)", abbrev, e.TZID)
+	}
+	return abbrev
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Attendee returns the first of addresses invited to the event.
+func (e Event) Attendee(addresses []string) (Person, bool) {
+	for _, a := range e.Attendees {
+		for _, addr := range addresses {
+			if strings.EqualFold(a.Address, addr) {
+				return a, true
+			}
+		}
+	}
+	return Person{}, false
+}
+
+// Reply builds an iTIP REPLY (RFC 5546 section 3.2.3) in which attendee
+// answers every event of the invitation with partStat.
+func (inv *Invite) Reply(attendee Person, partStat string, now time.Time) ([]byte, error) {
+	switch partStat {
+	case PartStatAccepted, PartStatDeclined, PartStatTentative:
+	default:
+		return nil, fmt.Errorf("invalid participation status %q", partStat)
+	}
+	if inv.Method != "" && inv.Method != MethodRequest {
+		return nil, fmt.Errorf("cannot reply to a calendar %s", strings.ToLower(inv.Method))
+	}
+
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropProductID, productID)
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropMethod, MethodReply)
+	tzids := map[string]bool{}
+	var events []*ical.Component
+	for _, orig := range inv.cal.Events() {
+		event := ical.NewEvent()
+		// The organizer matches the reply to the event by UID, SEQUENCE and
+		// RECURRENCE-ID; DTSTART and SUMMARY help clients show it.
+		for _, name := range []string{ical.PropUID, ical.PropSequence, ical.PropRecurrenceID, ical.PropDateTimeStart, ical.PropDateTimeEnd, ical.PropDuration, ical.PropSummary, ical.PropOrganizer} {
+			if prop := orig.Props.Get(name); prop != nil {
+				event.Props.Set(prop)
+				if tzid := prop.Params.Get(ical.ParamTimezoneID); tzid != "" {
+					tzids[tzid] = true
+				}
+			}
+		}
+		if event.Props.Get(ical.PropUID) == nil {
+			return nil, errors.New("invitation event has no UID")
+		}
+		event.Props.SetDateTime(ical.PropDateTimeStamp, now.UTC())
+
+		prop := ical.NewProp(ical.PropAttendee)
+		prop.Value = "mailto:" + attendee.Address
+		if attendee.Name != "" {
+			prop.Params.Set(ical.ParamCommonName, attendee.Name)
+		}
+		prop.Params.Set(ical.ParamParticipationStatus, partStat)
+		event.Props.Add(prop)
+		events = append(events, event.Component)
+	}
+	// RFC 5545 section 3.2.19: every TZID used needs its VTIMEZONE.
+	for _, child := range inv.cal.Children {
+		if child.Name == ical.CompTimezone {
+			if tzid := child.Props.Get(ical.PropTimezoneID); tzid != nil && tzids[tzid.Value] {
+				cal.Children = append(cal.Children, child)
+			}
+		}
+	}
+	cal.Children = append(cal.Children, events...)
+	return encode(cal)
+}
+
+// AsRequest checks data is an event invitation and marks it METHOD:REQUEST
+// when it has no method, so it can be sent as an invite.
+func AsRequest(data []byte) ([]byte, *Invite, error) {
+	inv, err := Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range inv.Events {
+		if e.Organizer.Address == "" {
+			return nil, nil, fmt.Errorf("event %q has no ORGANIZER", e.Summary)
+		}
+	}
+	switch inv.Method {
+	case MethodRequest:
+		return data, inv, nil
+	case "":
+	default:
+		return nil, nil, fmt.Errorf("calendar method is %s, expected REQUEST", inv.Method)
+	}
+	inv.cal.Props.SetText(ical.PropMethod, MethodRequest)
+	inv.Method = MethodRequest
+	out, err := encode(inv.cal)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, inv, nil
+}
+
+// Recipients lists the attendee addresses of every event.
+func (inv *Invite) Recipients() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, e := range inv.Events {
+		for _, a := range e.Attendees {
+			key := strings.ToLower(a.Address)
+			if a.Address != "" && !seen[key] {
+				seen[key] = true
+				out = append(out, a.Address)
+			}
+		}
+	}
+	return out
+}
+
+func encode(cal *ical.Calendar) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, fmt.Errorf("encode calendar: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ReplySubject is the subject clients use for a reply, e.g. "Accepted: Sync".
+func ReplySubject(partStat, summary string) string {
+	verb := Verb(partStat)
+	if verb == "" {
+		return summary
+	}
+	return strings.ToUpper(verb[:1]) + verb[1:] + ": " + summary
+}
+
+// Verb describes a reply, e.g. "tentatively accepted".
+func Verb(partStat string) string {
+	switch partStat {
+	case PartStatAccepted:
+		return "accepted"
+	case PartStatDeclined:
+		return "declined"
+	case PartStatTentative:
+		return "tentatively accepted"
+	}
+	return strings.ToLower(partStat)
+}
@@ -0,0 +1,167 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testInvite = "BEGIN:VCALENDAR\r\n" +
+	"PRODID:-//Example//Calendar//EN\r\n" +
+	"VERSION:2.0\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:sync-42@example.com\r\n" +
+	"SEQUENCE:2\r\n" +
+	"DTSTAMP:20261018T120000Z\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20261020T090000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20261020T093000\r\n" +
+	"SUMMARY:Weekly sync\r\n" +
+	"LOCATION:Room 4\\, 2nd floor\r\n" +
+	"ORGANIZER;CN=Alice:mailto:alice@example.com\r\n" +
+	"ATTENDEE;CN=Bob;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:bob@example.org\r\n" +
+	"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=ACCEPTED:mailto:carol@example.net\r\n" +
+	"RRULE:FREQ=WEEKLY\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseAndDescribe(t *testing.T) {
+	inv, err := Parse([]byte(testInvite))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if inv.Method != MethodRequest || len(inv.Events) != 1 {
+		t.Fatalf("unexpected invite: %+v", inv)
+	}
+	e := inv.Events[0]
+	if e.Location != "Room 4, 2nd floor" || e.Organizer.Address != "alice@example.com" || len(e.Attendees) != 2 {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if e.Start.Location().String() != "Europe/Berlin" || e.End.Sub(e.Start) != 30*time.Minute {
+		t.Fatalf("unexpected times: %s to %s", e.Start, e.End)
+	}
+
+	out := inv.Describe()
+	for _, want := range []string{
+		"Invitation",
+		"Summary:   Weekly sync",
+		"When:      Tue 2026-10-20 09:00-09:30 CEST (Europe/Berlin), recurring",
+		"Organizer: Alice <alice@example.com>",
+		"Attendee:  Bob <bob@example.org> (needs action)",
+		"Attendee:  carol@example.net (accepted), optional",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnknownTimezoneKeepsWallClock(t *testing.T) {
+	ics := strings.Replace(testInvite, "TZID=Europe/Berlin", "TZID=W. Europe Standard Time", 2)
+	inv, err := Parse([]byte(ics))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := inv.Events[0].When(); got != "Tue 2026-10-20 09:00-09:30 W. Europe Standard Time, recurring" {
+		t.Fatalf("unexpected time: %s", got)
+	}
+}
+
+func TestReply(t *testing.T) {
+	inv, err := Parse([]byte(testInvite))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	attendee, ok := inv.Events[0].Attendee([]string{"someone@else.test", "BOB@example.org"})
+	if !ok {
+		t.Fatal("expected bob to be an attendee")
+	}
+	data, err := inv.Reply(attendee, PartStatTentative, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+
+	reply, err := Parse(data)
+	if err != nil {
+		t.Fatalf("parse reply: %v\n%s", err, data)
+	}
+	e := reply.Events[0]
+	if reply.Method != MethodReply || e.UID != "sync-42@example.com" || e.Organizer.Address != "alice@example.com" {
+		t.Fatalf("unexpected reply:\n%s", data)
+	}
+	if len(e.Attendees) != 1 || e.Attendees[0].Address != "bob@example.org" || e.Attendees[0].PartStat != PartStatTentative {
+		t.Fatalf("unexpected reply attendees: %+v", e.Attendees)
+	}
+	if !strings.Contains(string(data), "SEQUENCE:2") || !strings.Contains(string(data), "DTSTAMP:20261019T080000Z") {
+		t.Fatalf("reply lacks SEQUENCE or DTSTAMP:\n%s", data)
+	}
+	if got := ReplySubject(PartStatTentative, e.Summary); got != "Tentatively accepted: Weekly sync" {
+		t.Fatalf("unexpected subject %q", got)
+	}
+
+	if _, err := reply.Reply(attendee, PartStatAccepted, time.Now()); err == nil {
+		t.Fatal("expected replying to a reply to fail")
+	}
+}
+
+func TestReplyKeepsTimezones(t *testing.T) {
+	const vtimezone = "BEGIN:VTIMEZONE\r\n" +
+		"TZID:W. Europe Standard Time\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:16010101T030000\r\n" +
+		"TZOFFSETFROM:+0200\r\n" +
+		"TZOFFSETTO:+0100\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\n" +
+		"END:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\n" +
+		"DTSTART:16010101T020000\r\n" +
+		"TZOFFSETFROM:+0100\r\n" +
+		"TZOFFSETTO:+0200\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\n" +
+		"END:DAYLIGHT\r\n" +
+		"END:VTIMEZONE\r\n"
+	const unused = "BEGIN:VTIMEZONE\r\n" +
+		"TZID:Pacific Standard Time\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:16010101T020000\r\n" +
+		"TZOFFSETFROM:-0700\r\n" +
+		"TZOFFSETTO:-0800\r\n" +
+		"END:STANDARD\r\n" +
+		"END:VTIMEZONE\r\n"
+	ics := strings.Replace(testInvite, "TZID=Europe/Berlin", "TZID=W. Europe Standard Time", 2)
+	ics = strings.Replace(ics, "BEGIN:VEVENT\r\n", vtimezone+unused+"BEGIN:VEVENT\r\n", 1)
+	inv, err := Parse([]byte(ics))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	attendee, _ := inv.Events[0].Attendee([]string{"bob@example.org"})
+	data, err := inv.Reply(attendee, PartStatAccepted, time.Now())
+	if err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	out := string(data)
+	if !strings.Contains(out, "DTSTART;TZID=W. Europe Standard Time:20261020T090000") || !strings.Contains(out, "TZID:W. Europe Standard Time\r\n") || !strings.Contains(out, "BEGIN:DAYLIGHT\r\n") {
+		t.Fatalf("expected the reply to carry the event's VTIMEZONE:\n%s", out)
+	}
+	if strings.Contains(out, "Pacific Standard Time") || strings.Index(out, "BEGIN:VTIMEZONE") > strings.Index(out, "BEGIN:VEVENT") {
+		t.Fatalf("expected only the used VTIMEZONE, before the event:\n%s", out)
+	}
+}
+
+func TestAsRequestAddsMethod(t *testing.T) {
+	ics := strings.Replace(testInvite, "METHOD:REQUEST\r\n", "", 1)
+	data, inv, err := AsRequest([]byte(ics))
+	if err != nil {
+		t.Fatalf("as request: %v", err)
+	}
+	if inv.Method != MethodRequest || !strings.Contains(string(data), "METHOD:REQUEST") {
+		t.Fatalf("expected METHOD:REQUEST:\n%s", data)
+	}
+	if got := inv.Recipients(); len(got) != 2 || got[0] != "bob@example.org" {
+		t.Fatalf("unexpected recipients %v", got)
+	}
+
+	if _, _, err := AsRequest([]byte(strings.Replace(testInvite, "METHOD:REQUEST", "METHOD:CANCEL", 1))); err == nil {
+		t.Fatal("expected a CANCEL to be rejected")
+	}
+}
@@ -45,7 +45,7 @@ func newAttachmentsDownloadCmd() *cobra.Command {
 			}
 
 			service := imap.NewService()
-			files, err := service.DownloadAttachments(cfg, mailbox, uint32(uid), outputDir)
+			files, err := service.DownloadAttachments(cmd.Context(), cfg, mailbox, uint32(uid), outputDir)
 			if err != nil {
 				return err
 			}
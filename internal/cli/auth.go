@@ -34,6 +34,9 @@ func newAuthLoginCmd() *cobra.Command {
 		smtpTLS      bool
 		smtpStartTLS bool
 		smtpInsecure bool
+		smtpUsername string
+		smtpPassword string
+		smtpAuth     string
 
 		username      string
 		password      string
@@ -83,6 +86,24 @@ func newAuthLoginCmd() *cobra.Command {
 				cfg.SMTP.InsecureSkipVerify = smtpInsecure
 			}
 
+			if cmd.Flags().Changed("smtp-auth") {
+				cfg.SMTP.AuthMechanism = strings.ToLower(smtpAuth)
+			}
+			if cmd.Flags().Changed("smtp-username") {
+				cfg.SMTP.Username = smtpUsername
+			}
+			smtpPasswordChanged := cmd.Flags().Changed("smtp-password")
+			if smtpPasswordChanged {
+				if cfg.SMTP.Username == "" {
+					return fmt.Errorf("--smtp-password requires --smtp-username")
+				}
+				if smtpPassword == "" {
+					return fmt.Errorf("smtp password is required")
+				}
+				cfg.SMTP.Password = smtpPassword
+				cfg.SMTP.PasswordSource = "flags"
+			}
+
 			if cmd.Flags().Changed("username") {
 				cfg.Auth.Username = username
 			}
@@ -123,9 +144,18 @@ func newAuthLoginCmd() *cobra.Command {
 				}
 			}
 
+			if smtpPasswordChanged {
+				if err := secrets.SetSMTPPassword(cfg.SMTP.Username, smtpPassword); err != nil {
+					return err
+				}
+			}
+
 			if passwordChanged || cfg.Auth.PasswordSource == "keyring" || cfg.Auth.PasswordSource == "env" {
 				cfg.Auth.Password = ""
 			}
+			if smtpPasswordChanged || cfg.SMTP.PasswordSource == "keyring" || cfg.SMTP.PasswordSource == "env" {
+				cfg.SMTP.Password = ""
+			}
 
 			path, err := config.Save(cfg)
 			if err != nil {
@@ -136,6 +166,9 @@ func newAuthLoginCmd() *cobra.Command {
 			if passwordChanged {
 				fmt.Fprintln(cmd.OutOrStdout(), "Password stored in keyring.")
 			}
+			if smtpPasswordChanged {
+				fmt.Fprintln(cmd.OutOrStdout(), "SMTP password stored in keyring.")
+			}
 			return nil
 		},
 	}
@@ -151,6 +184,9 @@ func newAuthLoginCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&smtpTLS, "smtp-tls", false, "Use SMTP TLS")
 	cmd.Flags().BoolVar(&smtpStartTLS, "smtp-starttls", false, "Use SMTP STARTTLS")
 	cmd.Flags().BoolVar(&smtpInsecure, "smtp-insecure", false, "Skip SMTP TLS verification")
+	cmd.Flags().StringVar(&smtpAuth, "smtp-auth", "", "SMTP auth mechanism: auto, plain, login, cram-md5, xoauth2, or none")
+	cmd.Flags().StringVar(&smtpUsername, "smtp-username", "", "SMTP username, if different from --username")
+	cmd.Flags().StringVar(&smtpPassword, "smtp-password", "", "SMTP password (or OAuth token for xoauth2)")
 
 	cmd.Flags().StringVar(&username, "username", "", "Username")
 	cmd.Flags().StringVar(&password, "password", "", "Password or app password")
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcli/internal/bounce"
+	"mailcli/internal/config"
+	"mailcli/internal/imap"
+
+	"github.com/spf13/cobra"
+)
+
+// bounceHints narrow the server-side search to likely bounces; bounce.Parse
+// decides.
+var bounceHints = []imap.HeaderMatch{
+	{Field: "Content-Type", Value: "delivery-status"},
+	{Field: "X-Failed-Recipients"},
+	{Field: "From", Value: "mailer-daemon"},
+	{Field: "From", Value: "postmaster"},
+	{Field: "Subject", Value: "undeliver"},
+	{Field: "Subject", Value: "failure notice"},
+	{Field: "Subject", Value: "delivery status notification"},
+}
+
+// bounceEntry is one recipient of one bounce, as printed and encoded.
+type bounceEntry struct {
+	UID  uint32    `json:"uid"`
+	Date time.Time `json:"date"`
+	bounce.Recipient
+	Permanent         bool   `json:"permanent"`
+	OriginalMessageID string `json:"original_message_id,omitempty"`
+}
+
+func newBouncesCmd() *cobra.Command {
+	var mailbox string
+	var since string
+	var permanent bool
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "bounces",
+		Short: "List bounced recipients",
+		Long: "List recipients from delivery status notifications (RFC 3464) and common non-standard " +
+			"bounces, with the status code, diagnostic and Message-ID of the message that bounced.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := parseSince(since, time.Now())
+			if err != nil {
+				return err
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := config.ValidateIMAP(cfg); err != nil {
+				return err
+			}
+
+			messages, err := imap.NewService().FetchMatching(cmd.Context(), cfg, mailbox, from, bounceHints)
+			if err != nil {
+				return err
+			}
+			entries := []bounceEntry{}
+			for _, msg := range messages {
+				b, ok := bounce.Parse(msg.Raw)
+				if !ok {
+					continue
+				}
+				for _, r := range b.Recipients {
+					if permanent && !r.Permanent() {
+						continue
+					}
+					entries = append(entries, bounceEntry{
+						UID:               msg.UID,
+						Date:              msg.Date,
+						Recipient:         r,
+						Permanent:         r.Permanent(),
+						OriginalMessageID: b.OriginalMessageID,
+					})
+				}
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+			if len(entries) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No bounces in %s since %s.\n", mailbox, from.Format("2006-01-02"))
+				return nil
+			}
+			printBounces(cmd.OutOrStdout(), entries)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&mailbox, "mailbox", "INBOX", "Mailbox name")
+	cmd.Flags().StringVar(&since, "since", "7d", "Only messages received since a date (2006-01-02) or within a period (7d, 48h)")
+	cmd.Flags().BoolVar(&permanent, "permanent", false, "Only list permanent failures (5.x.x)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON, one object per bounced recipient")
+
+	return cmd
+}
+
+// parseSince accepts a date or a period back from now in days ("7d") or as
+// a Go duration ("48h").
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q (use 2006-01-02, or a period like 7d or 48h)", value)
+}
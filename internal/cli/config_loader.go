@@ -13,30 +13,67 @@ func loadConfig() (config.Config, error) {
 	if err != nil {
 		return cfg, err
 	}
+	if err := loadPassword(&cfg); err != nil {
+		return cfg, err
+	}
+	if err := loadSMTPPassword(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
 
+func loadPassword(cfg *config.Config) error {
 	if _, ok := os.LookupEnv("MAILCLI_AUTH_PASSWORD"); ok {
 		cfg.Auth.PasswordSource = "env"
-		return cfg, nil
+		return nil
 	}
 
 	if cfg.Auth.Password != "" {
 		cfg.Auth.PasswordSource = "config"
-		return cfg, nil
+		return nil
 	}
 
 	if cfg.Auth.Username == "" {
-		return cfg, nil
+		return nil
 	}
 
 	password, err := secrets.GetPassword(cfg.Auth.Username)
 	if err != nil {
 		if errors.Is(err, secrets.ErrSecretNotFound) {
-			return cfg, nil
+			return nil
 		}
-		return cfg, err
+		return err
 	}
 
 	cfg.Auth.Password = password
 	cfg.Auth.PasswordSource = "keyring"
-	return cfg, nil
+	return nil
+}
+
+func loadSMTPPassword(cfg *config.Config) error {
+	if _, ok := os.LookupEnv("MAILCLI_SMTP_PASSWORD"); ok {
+		cfg.SMTP.PasswordSource = "env"
+		return nil
+	}
+
+	if cfg.SMTP.Password != "" {
+		cfg.SMTP.PasswordSource = "config"
+		return nil
+	}
+
+	if cfg.SMTP.Username == "" || cfg.SMTP.AuthMechanism == config.SMTPAuthNone {
+		return nil
+	}
+
+	password, err := secrets.GetSMTPPassword(cfg.SMTP.Username)
+	if err != nil {
+		if errors.Is(err, secrets.ErrSecretNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	cfg.SMTP.Password = password
+	cfg.SMTP.PasswordSource = "keyring"
+	return nil
 }
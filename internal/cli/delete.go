@@ -32,7 +32,7 @@ func newDeleteCmd() *cobra.Command {
 			}
 
 			service := imap.NewService()
-			if err := service.DeleteMessage(cfg, mailbox, uint32(uid)); err != nil {
+			if err := service.DeleteMessage(cmd.Context(), cfg, mailbox, uint32(uid)); err != nil {
 				return err
 			}
 
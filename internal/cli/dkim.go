@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"mailcli/internal/config"
+	"mailcli/internal/dkim"
+	"mailcli/internal/secrets"
+
+	"github.com/spf13/cobra"
+)
+
+// loadDKIMSigner returns the configured signer, or nil when DKIM is off.
+func loadDKIMSigner(cfg config.Config) (*dkim.Signer, error) {
+	if !cfg.DKIM.Enabled() {
+		return nil, nil
+	}
+	data, err := secrets.GetDKIMKey(cfg.DKIM.Selector, cfg.DKIM.Domain)
+	if errors.Is(err, secrets.ErrSecretNotFound) {
+		return nil, fmt.Errorf("no DKIM key for %s; add one with `mailcli dkim import` or `mailcli dkim generate`: %w", dkim.RecordName(cfg.DKIM.Selector, cfg.DKIM.Domain), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := dkim.ParseKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return &dkim.Signer{Domain: cfg.DKIM.Domain, Selector: cfg.DKIM.Selector, Key: key}, nil
+}
+
+// signDKIM signs the bytes about to be handed to the SMTP server. It must
+// run after Bcc and internal headers are stripped.
+func signDKIM(cfg config.Config, wire []byte) ([]byte, error) {
+	signer, err := loadDKIMSigner(cfg)
+	if err != nil || signer == nil {
+		return wire, err
+	}
+	return signer.Sign(wire)
+}
+
+func newDKIMCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dkim",
+		Short: "Manage the DKIM key used to sign outgoing mail",
+	}
+	cmd.AddCommand(newDKIMGenerateCmd())
+	cmd.AddCommand(newDKIMImportCmd())
+	cmd.AddCommand(newDKIMRecordCmd())
+	return cmd
+}
+
+func newDKIMGenerateCmd() *cobra.Command {
+	var algorithm string
+
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Create a DKIM key for dkim.selector and dkim.domain and print its DNS record",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadDKIMConfig()
+			if err != nil {
+				return err
+			}
+			key, err := dkim.GenerateKey(algorithm)
+			if err != nil {
+				return err
+			}
+			return storeDKIMKey(cmd, cfg, key)
+		},
+	}
+
+	cmd.Flags().StringVar(&algorithm, "algorithm", dkim.AlgorithmRSA, "Key algorithm: rsa or ed25519")
+
+	return cmd
+}
+
+func newDKIMImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Store an existing PEM private key for dkim.selector and dkim.domain",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadDKIMConfig()
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(args[0]) //nolint:gosec // user-supplied key file
+			if err != nil {
+				return fmt.Errorf("read key file: %w", err)
+			}
+			key, err := dkim.ParseKey(data)
+			if err != nil {
+				return err
+			}
+			return storeDKIMKey(cmd, cfg, key)
+		},
+	}
+
+	return cmd
+}
+
+func newDKIMRecordCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "record",
+		Short: "Print the DNS TXT record for the stored DKIM key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadDKIMConfig()
+			if err != nil {
+				return err
+			}
+			signer, err := loadDKIMSigner(cfg)
+			if err != nil {
+				return err
+			}
+			return printDKIMRecord(cmd, cfg, signer.Key)
+		},
+	}
+
+	return cmd
+}
+
+func loadDKIMConfig() (config.Config, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return cfg, err
+	}
+	if !cfg.DKIM.Enabled() {
+		return cfg, fmt.Errorf("dkim.domain and dkim.selector are required")
+	}
+	return cfg, nil
+}
+
+func storeDKIMKey(cmd *cobra.Command, cfg config.Config, key crypto.Signer) error {
+	data, err := dkim.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	if err := secrets.SetDKIMKey(cfg.DKIM.Selector, cfg.DKIM.Domain, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Stored DKIM key for %s in keyring. Publish this TXT record:\n\n", dkim.RecordName(cfg.DKIM.Selector, cfg.DKIM.Domain))
+	return printDKIMRecord(cmd, cfg, key)
+}
+
+func printDKIMRecord(cmd *cobra.Command, cfg config.Config, key crypto.Signer) error {
+	record, err := dkim.Record(key)
+	if err != nil {
+		return err
+	}
+	// A TXT string holds at most 255 bytes; longer RSA records are split.
+	var chunks []string
+	for len(record) > 255 {
+		chunks = append(chunks, `"`+record[:255]+`"`)
+		record = record[255:]
+	}
+	chunks = append(chunks, `"`+record+`"`)
+	fmt.Fprintf(cmd.OutOrStdout(), "%s. IN TXT %s\n", dkim.RecordName(cfg.DKIM.Selector, cfg.DKIM.Domain), strings.Join(chunks, " "))
+	return nil
+}
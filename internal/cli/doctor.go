@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"mailcli/internal/doctor"
+
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCmd() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose IMAP/SMTP connectivity, TLS, login and keyring setup",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			report := doctor.Run(cfg, doctor.Options{Timeout: timeout})
+			printDoctorReport(cmd.OutOrStdout(), report)
+
+			if failures := report.Failures(); failures > 0 {
+				return fmt.Errorf("doctor found %d failing check(s)", failures)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "Timeout for each server connection")
+
+	return cmd
+}
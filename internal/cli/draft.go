@@ -38,6 +38,9 @@ func newDraftSaveCmd() *cobra.Command {
 	var quote bool
 	var replyMailbox string
 	var attachments []string
+	var inline []string
+	var format bodyFormat
+	var ident identityFlags
 
 	cmd := &cobra.Command{
 		Use:   "save",
@@ -55,6 +58,15 @@ func newDraftSaveCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			markdown, err := format.isMarkdown(bodyHTML)
+			if err != nil {
+				return err
+			}
+			if markdown {
+				if bodyHTML, err = email.RenderMarkdown(content); err != nil {
+					return err
+				}
+			}
 
 			if replyAll && strings.TrimSpace(replyUID) == "" {
 				return fmt.Errorf("--reply-all requires --reply-uid")
@@ -76,7 +88,7 @@ func newDraftSaveCmd() *cobra.Command {
 				}
 
 				service := imap.NewService()
-				raw, err := service.FetchRawMessage(cfg, replyMailbox, uint32(uid))
+				raw, err := service.FetchRawMessage(cmd.Context(), cfg, replyMailbox, uint32(uid))
 				if err != nil {
 					return err
 				}
@@ -85,19 +97,33 @@ func newDraftSaveCmd() *cobra.Command {
 					return err
 				}
 				inReplyTo, references = email.BuildReplyHeaders(replyInfo)
-				content, bodyHTML = email.ApplyQuoteToBodies(content, bodyHTML, quote, replyInfo)
 				if strings.TrimSpace(subject) == "" && replyInfo.Subject != "" {
 					subject = email.ReplySubject(replyInfo.Subject)
 				}
 			}
 
+			from, err := resolveSender(cfg, ident, replyInfo)
+			if err != nil {
+				return err
+			}
+			signature, err := from.Signature(ident)
+			if err != nil {
+				return err
+			}
+			content, bodyHTML = email.ApplySignatureAndQuote(content, bodyHTML, signature, signatureAbove(cfg), quote, replyInfo)
+			if markdown && bodyHTML != "" {
+				if bodyHTML, err = wrapMarkdownHTML(cfg, bodyHTML); err != nil {
+					return err
+				}
+			}
+
 			var toList []string
 			var ccList []string
 			if replyInfo != nil {
 				if replyAll {
-					toList, ccList = email.BuildReplyAllRecipients(replyInfo, cfg.Auth.Username)
+					toList, ccList = email.BuildReplyAllRecipients(replyInfo, from.Self(cfg)...)
 				} else {
-					toList = email.BuildReplyRecipients(replyInfo, cfg.Auth.Username)
+					toList = email.BuildReplyRecipients(replyInfo, from.Self(cfg)...)
 				}
 				if strings.TrimSpace(to) != "" {
 					toList = splitList(to)
@@ -110,20 +136,21 @@ func newDraftSaveCmd() *cobra.Command {
 				ccList = splitList(cc)
 			}
 
-			bccList := splitList(bcc)
+			bccList := from.Bcc(splitList(bcc))
 
 			msg, err := email.BuildMessage(email.ComposeInput{
-				From:           cfg.Auth.Username,
+				From:           from.From(),
 				To:             toList,
 				Cc:             ccList,
 				Bcc:            bccList,
-				ReplyTo:        replyTo,
+				ReplyTo:        from.ReplyTo(replyTo),
 				Subject:        subject,
 				Body:           content,
 				BodyHTML:       bodyHTML,
 				InReplyTo:      inReplyTo,
 				References:     references,
 				Attachments:    attachments,
+				Inline:         inline,
 				StoreBccHeader: len(bccList) > 0,
 			})
 			if err != nil {
@@ -135,7 +162,7 @@ func newDraftSaveCmd() *cobra.Command {
 			if drafts == "" {
 				drafts = "Drafts"
 			}
-			if err := service.SaveDraft(cfg, drafts, msg); err != nil {
+			if err := service.SaveDraft(cmd.Context(), cfg, drafts, msg); err != nil {
 				return err
 			}
 
@@ -151,12 +178,15 @@ func newDraftSaveCmd() *cobra.Command {
 	cmd.Flags().StringVar(&body, "body", "", "Message body (plain text)")
 	cmd.Flags().StringVar(&bodyFile, "body-file", "", "Path to file containing message body ('-' for stdin)")
 	cmd.Flags().StringVar(&bodyHTML, "body-html", "", "Message body (HTML)")
+	addBodyFormatFlags(cmd, &format)
+	addIdentityFlags(cmd, &ident)
 	cmd.Flags().StringVar(&replyTo, "reply-to", "", "Reply-To header address")
 	cmd.Flags().StringVar(&replyUID, "reply-uid", "", "Reply to message UID (uses headers and thread)")
 	cmd.Flags().BoolVar(&replyAll, "reply-all", false, "Reply-all using original recipients (requires --reply-uid)")
 	cmd.Flags().BoolVar(&quote, "quote", false, "Include quoted original message (requires --reply-uid)")
 	cmd.Flags().StringVar(&replyMailbox, "reply-mailbox", "INBOX", "Mailbox containing the reply target")
 	cmd.Flags().StringSliceVar(&attachments, "attachment", nil, "Attachment file paths (repeatable)")
+	cmd.Flags().StringSliceVar(&inline, "inline", nil, "Inline image as path[=cid], referenced from the HTML body (repeatable)")
 
 	return cmd
 }
@@ -183,7 +213,7 @@ func newDraftListCmd() *cobra.Command {
 				drafts = "Drafts"
 			}
 
-			messages, total, err := service.ListMessages(cfg, drafts, page, pageSize)
+			messages, total, err := service.ListMessages(cmd.Context(), cfg, drafts, page, pageSize)
 			if err != nil {
 				return err
 			}
@@ -202,6 +232,8 @@ func newDraftListCmd() *cobra.Command {
 
 func newDraftSendCmd() *cobra.Command {
 	var keep bool
+	var delivery smtp.Options
+	var previewOpts previewFlags
 
 	cmd := &cobra.Command{
 		Use:   "send <uid>",
@@ -220,7 +252,12 @@ func newDraftSendCmd() *cobra.Command {
 			if err := config.ValidateIMAP(cfg); err != nil {
 				return err
 			}
-			if err := config.ValidateSMTP(cfg); err != nil {
+			if !previewOpts.dryRun {
+				if err := config.ValidateSMTP(cfg); err != nil {
+					return err
+				}
+			}
+			if err := delivery.Validate(); err != nil {
 				return err
 			}
 
@@ -230,7 +267,7 @@ func newDraftSendCmd() *cobra.Command {
 				drafts = "Drafts"
 			}
 
-			raw, err := service.FetchRawMessage(cfg, drafts, uint32(uid))
+			raw, err := service.FetchRawMessage(cmd.Context(), cfg, drafts, uint32(uid))
 			if err != nil {
 				return err
 			}
@@ -243,12 +280,30 @@ func newDraftSendCmd() *cobra.Command {
 				return fmt.Errorf("draft has no recipients")
 			}
 
-			if err := smtp.Send(cfg, cfg.Auth.Username, recipients, raw); err != nil {
+			from := cfg.Auth.Username
+			if addr, err := email.ExtractSender(raw); err == nil && addr != "" {
+				from = addr
+			}
+
+			// The draft stores Bcc recipients in a header that must not be
+			// transmitted.
+			wire, record := email.PrepareForDelivery(raw)
+			if wire, err = signDKIM(cfg, wire); err != nil {
+				return err
+			}
+			if done, err := previewOpts.preview(cmd, from, recipients, wire); done || err != nil {
+				return err
+			}
+
+			result, err := smtp.Send(cmd.Context(), cfg, from, recipients, wire, delivery)
+			reportDelivery(cmd, result, err)
+			if err != nil {
 				return err
 			}
+			fileSentCopy(cmd, cfg, record)
 
 			if !keep {
-				if err := service.DeleteMessage(cfg, drafts, uint32(uid)); err != nil {
+				if err := service.DeleteMessage(cmd.Context(), cfg, drafts, uint32(uid)); err != nil {
 					return err
 				}
 			}
@@ -259,6 +314,8 @@ func newDraftSendCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&keep, "keep", false, "Keep draft after sending")
+	addDeliveryFlags(cmd, &delivery)
+	addPreviewFlags(cmd, &previewOpts)
 
 	return cmd
 }
@@ -1,12 +1,23 @@
 package cli
 
 import (
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
+	"strings"
 	"text/tabwriter"
 	"time"
 
+	"mailcli/internal/authcheck"
+	"mailcli/internal/doctor"
 	"mailcli/internal/imap"
+	"mailcli/internal/merge"
+	"mailcli/internal/outbox"
+	"mailcli/internal/pgp"
+	"mailcli/internal/templates"
+	"mailcli/internal/textutil"
+	"mailcli/internal/tlsconfig"
 )
 
 func printMessages(out io.Writer, messages []imap.MessageSummary) {
@@ -34,3 +45,249 @@ func printThreads(out io.Writer, threads []imap.ThreadSummary) {
 	}
 	_ = tw.Flush()
 }
+
+func printMailboxStats(out io.Writer, stats []imap.MailboxStats) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAILBOX\tMESSAGES\tUNSEEN\tRECENT\tUIDNEXT\tUIDVALIDITY\tSIZE")
+	for _, st := range stats {
+		size := "-"
+		if st.HasSize {
+			size = formatBytes(st.Size)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", st.Name, st.Messages, st.Unseen, st.Recent, st.UIDNext, st.UIDValidity, size)
+	}
+	_ = tw.Flush()
+}
+
+func printQuota(out io.Writer, roots []imap.QuotaRoot) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUOTA ROOT\tRESOURCE\tUSAGE\tLIMIT\tUSED")
+	for _, root := range roots {
+		name := root.Name
+		if name == "" {
+			name = `""`
+		}
+		for _, res := range root.Resources {
+			usage := fmt.Sprintf("%d", res.Usage)
+			limit := fmt.Sprintf("%d", res.Limit)
+			// STORAGE is reported in units of 1024 octets (RFC 9208).
+			if res.Name == "STORAGE" {
+				usage = formatBytes(res.Usage * 1024)
+				limit = formatBytes(res.Limit * 1024)
+			}
+			used := "-"
+			if res.Limit > 0 {
+				used = fmt.Sprintf("%.1f%%", res.Percent())
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, res.Name, usage, limit, used)
+		}
+	}
+	_ = tw.Flush()
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func printDoctorReport(out io.Writer, report doctor.Report) {
+	for _, check := range report.Checks {
+		fmt.Fprintf(out, "[%s] %s: %s\n", check.Status, check.Name, check.Detail)
+		if check.Hint != "" && check.Status != doctor.StatusPass {
+			fmt.Fprintf(out, "       hint: %s\n", check.Hint)
+		}
+	}
+}
+
+func printCertificates(out io.Writer, certs []*x509.Certificate) {
+	for i, cert := range certs {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+		fmt.Fprintf(tw, "Certificate\t%d\n", i)
+		fmt.Fprintf(tw, "Subject\t%s\n", cert.Subject)
+		fmt.Fprintf(tw, "Issuer\t%s\n", cert.Issuer)
+		fmt.Fprintf(tw, "Valid\t%s to %s\n", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"))
+		if names := append(append([]string{}, cert.DNSNames...), ipStrings(cert.IPAddresses)...); len(names) > 0 {
+			fmt.Fprintf(tw, "Names\t%s\n", strings.Join(names, ", "))
+		}
+		fmt.Fprintf(tw, "SHA-256\t%s\n", tlsconfig.Fingerprint(cert))
+		fmt.Fprintf(tw, "Pin\t%s\n", tlsconfig.Pin(cert))
+		_ = tw.Flush()
+	}
+}
+
+func ipStrings(ips []net.IP) []string {
+	out := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, ip.String())
+	}
+	return out
+}
+
+func printOutbox(out io.Writer, entries []outbox.Entry, now time.Time) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tDUE\tATTEMPTS\tTO\tSUBJECT")
+	for _, entry := range entries {
+		due := "now"
+		if entry.Held {
+			due = "-"
+		} else if d := entry.Due(); d.After(now) {
+			due = d.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", entry.ID, entry.Status(now), due, entry.Attempts, strings.Join(entry.Recipients, ", "), entry.Subject)
+	}
+	_ = tw.Flush()
+}
+
+func printOutboxEntry(out io.Writer, entry outbox.Entry, now time.Time) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\t%s\n", entry.ID)
+	fmt.Fprintf(tw, "Status\t%s\n", entry.Status(now))
+	fmt.Fprintf(tw, "Message-ID\t%s\n", entry.MessageID)
+	fmt.Fprintf(tw, "From\t%s\n", entry.From)
+	fmt.Fprintf(tw, "Recipients\t%s\n", strings.Join(entry.Recipients, ", "))
+	fmt.Fprintf(tw, "Subject\t%s\n", entry.Subject)
+	fmt.Fprintf(tw, "Queued\t%s\n", entry.CreatedAt.Format(time.RFC3339))
+	if !entry.NotBefore.IsZero() {
+		fmt.Fprintf(tw, "Scheduled\t%s\n", entry.NotBefore.Format(time.RFC3339))
+	}
+	if entry.Attempts > 0 {
+		fmt.Fprintf(tw, "Attempts\t%d (last %s)\n", entry.Attempts, entry.LastAttempt.Format(time.RFC3339))
+		fmt.Fprintf(tw, "Last error\t%s\n", entry.LastError)
+	}
+	if !entry.NextAttempt.IsZero() {
+		fmt.Fprintf(tw, "Next attempt\t%s\n", entry.NextAttempt.Format(time.RFC3339))
+	}
+	_ = tw.Flush()
+}
+
+func printBounces(out io.Writer, entries []bounceEntry) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "UID\tDATE\tRECIPIENT\tACTION\tSTATUS\tMESSAGE-ID\tDIAGNOSTIC")
+	for _, e := range entries {
+		date := ""
+		if !e.Date.IsZero() {
+			date = e.Date.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", e.UID, date, e.Address, e.Action, textutil.FirstNonBlank(e.Status, "-"), textutil.FirstNonBlank(e.OriginalMessageID, "-"), e.Diagnostic)
+	}
+	_ = tw.Flush()
+}
+
+func printTemplates(out io.Writer, list []templates.Info) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSUBJECT\tPATH")
+	for _, t := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", t.Name, t.Subject, t.Path)
+	}
+	_ = tw.Flush()
+}
+
+func printPGPKeys(out io.Writer, keys []pgp.KeyInfo) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tFINGERPRINT\tUSAGE\tUSER IDS")
+	for _, k := range keys {
+		kind := "pub"
+		if k.Secret {
+			kind = "sec"
+		}
+		var usage []string
+		if k.CanSign {
+			usage = append(usage, "sign")
+		}
+		if k.CanEncrypt {
+			usage = append(usage, "encrypt")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", kind, k.Fingerprint, strings.Join(usage, ","), strings.Join(k.UserIDs, ", "))
+	}
+	_ = tw.Flush()
+}
+
+func printSMIMECerts(out io.Writer, addresses []string, certs map[string]*x509.Certificate) {
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tSUBJECT\tISSUER\tEXPIRES")
+	for _, addr := range addresses {
+		cert := certs[addr]
+		expires := cert.NotAfter.Format("2006-01-02")
+		if time.Now().After(cert.NotAfter) {
+			expires += " (expired)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", addr, cert.Subject.CommonName, cert.Issuer.CommonName, expires)
+	}
+	_ = tw.Flush()
+}
+
+func printAuthReport(out io.Writer, r *authcheck.Report) {
+	fmt.Fprintln(out, "Authentication:")
+	if r.FromDomain != "" {
+		fmt.Fprintf(out, "  From domain: %s\n", r.FromDomain)
+	}
+	if len(r.Results) == 0 {
+		fmt.Fprintln(out, "  No Authentication-Results headers.")
+	}
+	for _, res := range r.Results {
+		fmt.Fprintf(out, "  %s: %s\n", res.AuthServID, formatVerdicts(res.Verdicts))
+	}
+	for _, set := range r.ARC {
+		fmt.Fprintf(out, "  ARC i=%d %s cv=%s", set.Instance, set.Domain, set.Chain)
+		if set.AuthServID != "" {
+			fmt.Fprintf(out, " (%s: %s)", set.AuthServID, formatVerdicts(set.Verdicts))
+		}
+		fmt.Fprintln(out)
+	}
+	if len(r.Signatures) == 0 {
+		fmt.Fprintln(out, "  DKIM: not signed")
+	}
+	for _, sig := range r.Signatures {
+		status := "valid"
+		if sig.Err != nil {
+			status = "INVALID: " + sig.Err.Error()
+		}
+		alignment := "not aligned with From"
+		if sig.Aligned {
+			alignment = "aligned with From"
+		}
+		fmt.Fprintf(out, "  DKIM d=%s: %s, %s\n", sig.Domain, status, alignment)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(out, "  WARNING: %s\n", warning)
+	}
+}
+
+func formatVerdicts(verdicts []authcheck.Verdict) string {
+	if len(verdicts) == 0 {
+		return "no results"
+	}
+	parts := make([]string, 0, len(verdicts))
+	for _, v := range verdicts {
+		part := v.Method + "=" + v.Result
+		if v.Domain != "" {
+			part += " (" + v.Domain + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+func printMergeReport(out io.Writer, outcomes []merge.Outcome) {
+	counts := map[string]int{}
+	tw := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROW\tSTATUS\tRECIPIENTS\tDETAIL")
+	for _, o := range outcomes {
+		counts[o.Status]++
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", o.Row, o.Status, strings.Join(o.Recipients, ", "), o.Detail)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(out, "\n%d sent, %d failed, %d skipped, %d written\n",
+		counts[merge.StatusSent], counts[merge.StatusFailed], counts[merge.StatusSkipped], counts[merge.StatusWritten])
+}
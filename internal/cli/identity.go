@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+
+	"github.com/spf13/cobra"
+)
+
+type identityFlags struct {
+	from        string
+	identity    string
+	noSignature bool
+}
+
+func addIdentityFlags(cmd *cobra.Command, f *identityFlags) {
+	cmd.Flags().StringVar(&f.from, "from", "", "Send from this address (selects the identity it belongs to)")
+	cmd.Flags().StringVar(&f.identity, "identity", "", "Send as a configured identity")
+	cmd.Flags().BoolVar(&f.noSignature, "no-signature", false, "Do not append the identity's signature")
+}
+
+// sender is the resolved identity plus the address actually used, which may
+// be one of the identity's aliases.
+type sender struct {
+	identity config.Identity
+	address  string
+}
+
+// resolveSender picks the identity from --identity or --from; for replies it
+// picks the identity the original was addressed to, and otherwise falls back
+// to the default identity.
+func resolveSender(cfg config.Config, f identityFlags, reply *email.ReplyInfo) (sender, error) {
+	if err := config.ValidateIdentities(cfg); err != nil {
+		return sender{}, err
+	}
+	if f.identity != "" && f.from != "" {
+		return sender{}, fmt.Errorf("use either --from or --identity")
+	}
+
+	switch {
+	case f.identity != "":
+		id, ok := cfg.FindIdentity(f.identity)
+		if !ok {
+			return sender{}, fmt.Errorf("unknown identity %q", f.identity)
+		}
+		return sender{identity: id, address: id.Address}, nil
+	case f.from != "":
+		addr, err := mail.ParseAddress(f.from)
+		if err != nil {
+			return sender{}, fmt.Errorf("invalid --from %q: %w", f.from, err)
+		}
+		id, ok := cfg.IdentityForAddress(addr.Address)
+		if !ok {
+			id = config.Identity{Address: addr.Address}
+		}
+		if addr.Name != "" {
+			id.DisplayName = addr.Name
+		}
+		return sender{identity: id, address: addr.Address}, nil
+	}
+
+	if reply != nil {
+		for _, addr := range append(append([]string{}, reply.To...), reply.Cc...) {
+			if id, ok := cfg.IdentityForAddress(addr); ok {
+				return sender{identity: id, address: addr}, nil
+			}
+		}
+	}
+	id := cfg.DefaultIdentity()
+	return sender{identity: id, address: id.Address}, nil
+}
+
+// From returns the From header value.
+func (s sender) From() string {
+	if s.identity.DisplayName == "" {
+		return s.address
+	}
+	return (&mail.Address{Name: s.identity.DisplayName, Address: s.address}).String()
+}
+
+// ReplyTo returns the Reply-To header value, preferring the --reply-to flag.
+func (s sender) ReplyTo(flag string) string {
+	if strings.TrimSpace(flag) != "" {
+		return flag
+	}
+	return s.identity.ReplyTo
+}
+
+// Self lists the addresses to leave out of reply recipients.
+func (s sender) Self(cfg config.Config) []string {
+	return append([]string{s.address, s.identity.Address, cfg.Auth.Username}, s.identity.Aliases...)
+}
+
+// Bcc adds the sender to bcc when the identity asks for a copy.
+func (s sender) Bcc(bcc []string) []string {
+	if !s.identity.BccSelf {
+		return bcc
+	}
+	for _, addr := range bcc {
+		if strings.EqualFold(addr, s.address) {
+			return bcc
+		}
+	}
+	return append(bcc, s.address)
+}
+
+func (s sender) Signature(f identityFlags) (email.Signature, error) {
+	var sig email.Signature
+	if f.noSignature {
+		return sig, nil
+	}
+	if s.identity.SignatureFile != "" {
+		data, err := os.ReadFile(s.identity.SignatureFile) //nolint:gosec // path comes from the user's config
+		if err != nil {
+			return sig, fmt.Errorf("read signature: %w", err)
+		}
+		sig.Text = string(data)
+	}
+	if s.identity.SignatureHTMLFile != "" {
+		data, err := os.ReadFile(s.identity.SignatureHTMLFile) //nolint:gosec // path comes from the user's config
+		if err != nil {
+			return sig, fmt.Errorf("read html signature: %w", err)
+		}
+		sig.HTML = string(data)
+	}
+	return sig, nil
+}
+
+func signatureAbove(cfg config.Config) bool {
+	return !strings.EqualFold(cfg.Defaults.SignaturePlacement, config.SignatureBelow)
+}
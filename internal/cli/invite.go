@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcli/internal/calendar"
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/imap"
+	"mailcli/internal/smtp"
+	"mailcli/internal/textutil"
+
+	"github.com/spf13/cobra"
+)
+
+func newInviteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "invite",
+		Short: "Respond to meeting invitations",
+	}
+	cmd.AddCommand(newInviteReplyCmd("accept", calendar.PartStatAccepted, "Accept a meeting invitation"))
+	cmd.AddCommand(newInviteReplyCmd("decline", calendar.PartStatDeclined, "Decline a meeting invitation"))
+	cmd.AddCommand(newInviteReplyCmd("tentative", calendar.PartStatTentative, "Tentatively accept a meeting invitation"))
+	return cmd
+}
+
+func newInviteReplyCmd(name, partStat, short string) *cobra.Command {
+	var mailbox string
+	var as string
+	var comment string
+
+	cmd := &cobra.Command{
+		Use:   name + " <uid>",
+		Short: short,
+		Long:  short + ". An iTIP REPLY (RFC 5546) is sent to the organizer from the address the invitation was sent to.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			uid, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid uid: %s", args[0])
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := config.ValidateIMAP(cfg); err != nil {
+				return err
+			}
+			if err := config.ValidateSMTP(cfg); err != nil {
+				return err
+			}
+
+			detail, err := imap.NewService().ReadMessage(cmd.Context(), cfg, mailbox, uint32(uid))
+			if err != nil {
+				return err
+			}
+			if detail.Calendar == nil {
+				return fmt.Errorf("message %d has no calendar invitation", uid)
+			}
+			invite, err := calendar.Parse(detail.Calendar)
+			if err != nil {
+				return err
+			}
+			event := invite.Events[0]
+			if event.Organizer.Address == "" {
+				return fmt.Errorf("invitation has no organizer to reply to")
+			}
+
+			candidates := ownAddresses(cfg)
+			if as != "" {
+				candidates = []string{as}
+			}
+			attendee, ok := event.Attendee(candidates)
+			if !ok {
+				return fmt.Errorf("none of %s is an attendee of %q; pass --as with the invited address", strings.Join(candidates, ", "), event.Summary)
+			}
+			id, ok := cfg.IdentityForAddress(attendee.Address)
+			if !ok {
+				id = config.Identity{Address: attendee.Address, DisplayName: attendee.Name}
+			}
+			from := sender{identity: id, address: attendee.Address}
+			attendee.Name = textutil.FirstNonBlank(id.DisplayName, attendee.Name)
+
+			reply, err := invite.Reply(attendee, partStat, time.Now())
+			if err != nil {
+				return err
+			}
+			subject := calendar.ReplySubject(partStat, event.Summary)
+			body := fmt.Sprintf("%s has %s this invitation.\n", attendee, calendar.Verb(partStat))
+			if comment != "" {
+				body += "\n" + comment + "\n"
+			}
+			msg, err := email.BuildMessage(email.ComposeInput{
+				From:           from.From(),
+				To:             []string{(&mail.Address{Name: event.Organizer.Name, Address: event.Organizer.Address}).String()},
+				Subject:        subject,
+				Body:           body,
+				Calendar:       reply,
+				CalendarMethod: calendar.MethodReply,
+			})
+			if err != nil {
+				return err
+			}
+			wire, record := email.PrepareForDelivery(msg)
+			if wire, err = signDKIM(cfg, wire); err != nil {
+				return err
+			}
+
+			result, err := smtp.Send(cmd.Context(), cfg, from.address, []string{event.Organizer.Address}, wire, smtp.Options{})
+			reportDelivery(cmd, result, err)
+			if err != nil {
+				return err
+			}
+			fileSentCopy(cmd, cfg, record)
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s; reply sent to %s.\n", subject, event.Organizer.Address)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&mailbox, "mailbox", "INBOX", "Mailbox name")
+	cmd.Flags().StringVar(&as, "as", "", "Attendee address to reply as (default: your address among the attendees)")
+	cmd.Flags().StringVar(&comment, "comment", "", "Note to the organizer")
+
+	return cmd
+}
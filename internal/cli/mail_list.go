@@ -43,7 +43,7 @@ func newMailListCmd() *cobra.Command {
 
 			service := imap.NewService()
 			if threads {
-				threadSummaries, total, err := service.ListThreads(cfg, mailbox, page, pageSize)
+				threadSummaries, total, err := service.ListThreads(cmd.Context(), cfg, mailbox, page, pageSize)
 				if err != nil {
 					if !errors.Is(err, imap.ErrThreadUnsupported) {
 						return err
@@ -56,7 +56,7 @@ func newMailListCmd() *cobra.Command {
 				}
 			}
 
-			messages, total, err := service.ListMessages(cfg, mailbox, page, pageSize)
+			messages, total, err := service.ListMessages(cmd.Context(), cfg, mailbox, page, pageSize)
 			if err != nil {
 				return err
 			}
@@ -33,7 +33,7 @@ func newMailboxesListCmd() *cobra.Command {
 			}
 
 			service := imap.NewService()
-			mailboxes, err := service.ListMailboxes(cfg)
+			mailboxes, err := service.ListMailboxes(cmd.Context(), cfg)
 			if err != nil {
 				return err
 			}
@@ -62,7 +62,7 @@ func newMailboxesCreateCmd() *cobra.Command {
 			}
 
 			service := imap.NewService()
-			if err := service.CreateMailbox(cfg, args[0]); err != nil {
+			if err := service.CreateMailbox(cmd.Context(), cfg, args[0]); err != nil {
 				return err
 			}
 
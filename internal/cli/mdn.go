@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/imap"
+	"mailcli/internal/smtp"
+	"mailcli/internal/textutil"
+
+	"github.com/spf13/cobra"
+)
+
+func newMDNCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mdn",
+		Short: "Answer read receipt requests",
+	}
+	cmd.AddCommand(newMDNSendCmd())
+	return cmd
+}
+
+func newMDNSendCmd() *cobra.Command {
+	var mailbox string
+	var ident identityFlags
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "send <uid>",
+		Short: "Send the read receipt a message asks for",
+		Long: "Send the read receipt a message asks for with Disposition-Notification-To: an RFC 8098 " +
+			"message disposition notification saying the message was displayed. The message is then " +
+			"marked with the " + imap.MDNSentFlag + " keyword so it is not answered twice.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			uid, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid uid: %s", args[0])
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := config.ValidateIMAP(cfg); err != nil {
+				return err
+			}
+			if err := config.ValidateSMTP(cfg); err != nil {
+				return err
+			}
+
+			service := imap.NewService()
+			detail, err := service.ReadMessage(cmd.Context(), cfg, mailbox, uint32(uid))
+			if err != nil {
+				return err
+			}
+			req := email.ParseReceiptRequest(detail.Raw)
+			if req == nil {
+				return fmt.Errorf("message %d does not request a read receipt", uid)
+			}
+			if !force {
+				if hasFlag(detail.Flags, imap.MDNSentFlag) {
+					return fmt.Errorf("a read receipt for message %d was already sent; use --force to send another", uid)
+				}
+				if req.NeedsConfirmation() {
+					return fmt.Errorf("message %d asks for a receipt to %s, not to its sender %s; use --force to send it anyway",
+						uid, strings.Join(req.To, ", "), textutil.FirstNonBlank(req.ReturnPath, "(unknown)"))
+				}
+			}
+
+			info, err := email.ExtractReplyInfo(detail.Raw, false)
+			if err != nil {
+				return err
+			}
+			from, err := resolveSender(cfg, ident, info)
+			if err != nil {
+				return err
+			}
+			msg, err := email.BuildMDN(detail.Raw, email.MDNInput{
+				From:           from.From(),
+				FinalRecipient: from.address,
+				Date:           time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+			wire, _ := email.PrepareForDelivery(msg)
+			if wire, err = signDKIM(cfg, wire); err != nil {
+				return err
+			}
+
+			// RFC 8098 section 3: the envelope sender of an MDN is null, so
+			// that it can never cause a bounce or another notification.
+			result, err := smtp.Send(cmd.Context(), cfg, "", req.To, wire, smtp.Options{})
+			reportDelivery(cmd, result, err)
+			if err != nil {
+				return err
+			}
+			if err := service.AddTag(cmd.Context(), cfg, mailbox, uint32(uid), imap.MDNSentFlag); err != nil {
+				return fmt.Errorf("read receipt sent, but marking message %d failed: %w", uid, err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Read receipt sent to %s.\n", strings.Join(req.To, ", "))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&mailbox, "mailbox", "INBOX", "Mailbox name")
+	cmd.Flags().StringVar(&ident.from, "from", "", "Send from this address (default: the address the message was sent to)")
+	cmd.Flags().StringVar(&ident.identity, "identity", "", "Send as a configured identity")
+	cmd.Flags().BoolVar(&force, "force", false, "Send even if a receipt was already sent or the request does not come from the sender")
+
+	return cmd
+}
+
+// receiptTo is the Disposition-Notification-To address for send
+// --request-receipt: the sender.
+func receiptTo(request bool, from sender) string {
+	if !request {
+		return ""
+	}
+	return from.From()
+}
+
+// hasFlag reports whether flags contains flag, ignoring case as IMAP does.
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
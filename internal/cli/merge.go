@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/merge"
+	"mailcli/internal/smtp"
+	"mailcli/internal/templates"
+
+	"github.com/spf13/cobra"
+)
+
+func newMergeCmd() *cobra.Command {
+	var templateName string
+	var dataPath string
+	var vars []string
+	var dryRun bool
+	var outDir string
+	var rate string
+	var progressPath string
+	var reportPath string
+	var ident identityFlags
+	var delivery smtp.Options
+
+	cmd := &cobra.Command{
+		Use:   "merge",
+		Short: "Send one templated message per row of a CSV or JSON file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if templateName == "" || dataPath == "" {
+				return fmt.Errorf("--template and --data are required")
+			}
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if !dryRun {
+				if err := config.ValidateSMTP(cfg); err != nil {
+					return err
+				}
+			}
+			if err := delivery.Validate(); err != nil {
+				return err
+			}
+			limiter := merge.NewLimiter(0)
+			if rate != "" {
+				r, err := merge.ParseRate(rate)
+				if err != nil {
+					return err
+				}
+				limiter = merge.NewLimiter(r.Interval())
+			}
+
+			tmpl, err := resolveTemplate(templateName)
+			if err != nil {
+				return err
+			}
+			globals, err := templates.ParseVars(vars)
+			if err != nil {
+				return err
+			}
+			rows, err := merge.LoadData(dataPath)
+			if err != nil {
+				return err
+			}
+
+			var progress *merge.Progress
+			if dryRun {
+				if err := os.MkdirAll(outDir, 0o750); err != nil {
+					return err
+				}
+			} else {
+				if progressPath == "" {
+					progressPath = dataPath + ".progress"
+				}
+				if progress, err = merge.OpenProgress(progressPath); err != nil {
+					return err
+				}
+			}
+
+			signer, err := loadDKIMSigner(cfg)
+			if err != nil {
+				return err
+			}
+
+			var session *smtp.Session
+			defer func() {
+				if session != nil {
+					_ = session.Close()
+				}
+			}()
+			sent := &sentFiler{cmd: cmd, cfg: cfg}
+			defer sent.close()
+
+			outcomes := make([]merge.Outcome, 0, len(rows))
+			var runErr error
+			for i, row := range rows {
+				n := i + 1
+				data := make(map[string]any, len(globals)+len(row))
+				for k, v := range globals {
+					data[k] = v
+				}
+				for k, v := range row {
+					data[k] = v
+				}
+
+				outcome := merge.Outcome{Row: n}
+				msg, err := tmpl.Render(data)
+				if err == nil {
+					var composed composedMessage
+					composed, err = composeTemplate(cfg, msg, ident)
+					if err == nil && signer != nil {
+						composed.raw, err = signer.Sign(composed.raw)
+					}
+					if err == nil {
+						outcome.Recipients = composed.recipients
+						if len(composed.recipients) == 0 {
+							err = fmt.Errorf("no recipients")
+						} else if dryRun {
+							path := filepath.Join(outDir, fmt.Sprintf("%04d.eml", n))
+							err = os.WriteFile(path, composed.raw, 0o600)
+							outcome.Status, outcome.Detail = merge.StatusWritten, path
+						} else if key := merge.Key(composed.recipients, msg); progress.Done(key) {
+							outcome.Status, outcome.Detail = merge.StatusSkipped, "already sent"
+						} else {
+							var result smtp.Result
+							result, err = sendMerged(cmd, cfg, &session, limiter, composed, delivery)
+							if err == nil {
+								outcome.Status = merge.StatusSent
+								if len(result.Rejected) > 0 {
+									outcome.Detail = fmt.Sprintf("rejected %v", result.Rejected)
+								}
+								sent.file(composed.record)
+								err = progress.Mark(key, n, time.Now())
+							}
+						}
+					}
+				}
+				if err != nil {
+					outcome.Status, outcome.Detail = merge.StatusFailed, err.Error()
+				}
+				outcomes = append(outcomes, outcome)
+				fmt.Fprintf(cmd.ErrOrStderr(), "[%d/%d] %s %s\n", n, len(rows), outcome.Status, strings.Join(outcome.Recipients, ", "))
+
+				if err != nil && (cmd.Context().Err() != nil || errors.Is(err, errSMTPUnavailable)) {
+					runErr = err
+					break
+				}
+			}
+
+			printMergeReport(cmd.OutOrStdout(), outcomes)
+			if reportPath != "" {
+				data, err := json.MarshalIndent(outcomes, "", "  ")
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(reportPath, append(data, '\n'), 0o600); err != nil {
+					return err
+				}
+			}
+			if runErr != nil {
+				return fmt.Errorf("merge stopped after row %d: %w", len(outcomes), runErr)
+			}
+			failed := 0
+			for _, o := range outcomes {
+				if o.Status == merge.StatusFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d message(s) failed", failed, len(outcomes))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&templateName, "template", "", "Template file or name in the templates directory")
+	cmd.Flags().StringVar(&dataPath, "data", "", "CSV (with header row), JSON array or JSON lines file with one row per message")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Variable shared by all rows as key=value (repeatable)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Write .eml files instead of sending")
+	cmd.Flags().StringVar(&outDir, "out-dir", "merge-out", "Directory for --dry-run output")
+	cmd.Flags().StringVar(&rate, "rate", "", "Maximum send rate, e.g. 30/min or 1/s")
+	cmd.Flags().StringVar(&progressPath, "progress", "", "Progress file used to resume (default <data>.progress)")
+	cmd.Flags().StringVar(&reportPath, "report", "", "Also write the per-row report as JSON to this file")
+	addIdentityFlags(cmd, &ident)
+	addDeliveryFlags(cmd, &delivery)
+
+	return cmd
+}
+
+var errSMTPUnavailable = errors.New("smtp server unavailable")
+
+// sendMerged delivers one message over the shared session, reconnecting once
+// if the connection was lost since the previous message.
+func sendMerged(cmd *cobra.Command, cfg config.Config, session **smtp.Session, limiter *merge.Limiter, msg composedMessage, delivery smtp.Options) (smtp.Result, error) {
+	if err := limiter.Wait(cmd.Context()); err != nil {
+		return smtp.Result{}, err
+	}
+	for attempt := 0; ; attempt++ {
+		if *session == nil {
+			s, err := smtp.Open(cmd.Context(), cfg)
+			if err != nil {
+				return smtp.Result{}, fmt.Errorf("%w: %v", errSMTPUnavailable, err)
+			}
+			*session = s
+		}
+		result, err := (*session).Send(msg.from.address, msg.recipients, msg.raw, delivery)
+		// Only a connection lost before any recipient was given is retried;
+		// later the message may already have been delivered.
+		if err == nil || len(result.Accepted)+len(result.Rejected) > 0 || !smtp.IsConnectionError(err) || attempt > 0 {
+			return result, err
+		}
+		_ = (*session).Close()
+		*session = nil
+	}
+}
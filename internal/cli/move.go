@@ -33,7 +33,7 @@ func newMoveCmd() *cobra.Command {
 			}
 
 			service := imap.NewService()
-			if err := service.MoveMessage(cfg, mailbox, uint32(uid), dest); err != nil {
+			if err := service.MoveMessage(cmd.Context(), cfg, mailbox, uint32(uid), dest); err != nil {
 				return err
 			}
 
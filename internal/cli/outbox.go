@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/outbox"
+	"mailcli/internal/smtp"
+
+	"github.com/spf13/cobra"
+)
+
+func newOutboxCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "outbox",
+		Short: "Manage messages queued for later delivery",
+	}
+	cmd.AddCommand(newOutboxListCmd())
+	cmd.AddCommand(newOutboxShowCmd())
+	cmd.AddCommand(newOutboxDropCmd())
+	cmd.AddCommand(newOutboxFlushCmd())
+	return cmd
+}
+
+func newOutboxListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List queued messages",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queue, err := outbox.Open()
+			if err != nil {
+				return err
+			}
+			entries, err := queue.List()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "Outbox is empty.")
+				return nil
+			}
+			printOutbox(cmd.OutOrStdout(), entries, time.Now())
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newOutboxShowCmd() *cobra.Command {
+	var raw bool
+
+	cmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a queued message",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queue, err := outbox.Open()
+			if err != nil {
+				return err
+			}
+			entry, msg, err := queue.Get(args[0])
+			if err != nil {
+				return err
+			}
+			if raw {
+				_, err := cmd.OutOrStdout().Write(msg)
+				return err
+			}
+			printOutboxEntry(cmd.OutOrStdout(), entry, time.Now())
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&raw, "raw", false, "Print the queued RFC 822 message instead of its metadata")
+
+	return cmd
+}
+
+func newOutboxDropCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drop <id>...",
+		Short: "Remove queued messages without sending them",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queue, err := outbox.Open()
+			if err != nil {
+				return err
+			}
+			for _, id := range args {
+				entry, _, err := queue.Get(id)
+				if err != nil {
+					return err
+				}
+				if err := queue.Remove(entry.ID); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Dropped %s.\n", entry.ID)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newOutboxFlushCmd() *cobra.Command {
+	var daemon bool
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "flush [id...]",
+		Short: "Send due messages, or the given ones immediately",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if daemon && len(args) > 0 {
+				return fmt.Errorf("--daemon cannot be combined with message ids")
+			}
+			if interval <= 0 {
+				return fmt.Errorf("--interval must be positive")
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := config.ValidateSMTP(cfg); err != nil {
+				return err
+			}
+			queue, err := outbox.Open()
+			if err != nil {
+				return err
+			}
+			send := func(ctx context.Context, entry outbox.Entry, raw []byte) (smtp.Result, error) {
+				wire, record := email.PrepareForDelivery(raw)
+				wire, err := signDKIM(cfg, wire)
+				if err != nil {
+					return smtp.Result{}, err
+				}
+				result, err := smtp.Send(ctx, cfg, entry.From, entry.Recipients, wire, entry.Delivery)
+				if err == nil {
+					fileSentCopy(cmd, cfg, record)
+				}
+				return result, err
+			}
+
+			if !daemon {
+				outcomes, err := queue.Flush(cmd.Context(), args, send)
+				printFlushOutcomes(cmd, outcomes)
+				if err != nil {
+					return err
+				}
+				if len(outcomes) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "Nothing due.")
+				}
+				if failed := countFailed(outcomes); failed > 0 {
+					return fmt.Errorf("%d message(s) could not be sent", failed)
+				}
+				return nil
+			}
+
+			ctx := cmd.Context()
+			for {
+				outcomes, err := queue.Flush(ctx, nil, send)
+				printFlushOutcomes(cmd, outcomes)
+				if ctx.Err() != nil {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+
+				wait := interval
+				if next, ok, err := queue.NextDue(); err != nil {
+					return err
+				} else if ok {
+					if until := time.Until(next); until < wait {
+						wait = max(until, time.Second)
+					}
+				}
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil
+				case <-timer.C:
+				}
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&daemon, "daemon", false, "Keep running and send messages as they become due")
+	cmd.Flags().DurationVar(&interval, "interval", time.Minute, "How often the daemon checks for newly queued messages")
+
+	return cmd
+}
+
+func printFlushOutcomes(cmd *cobra.Command, outcomes []outbox.Outcome) {
+	for _, outcome := range outcomes {
+		entry := outcome.Entry
+		switch {
+		case outcome.Err == nil:
+			fmt.Fprintf(cmd.OutOrStdout(), "Sent %s (%s).\n", entry.ID, entry.Subject)
+			reportDelivery(cmd, outcome.Result, nil)
+		case entry.Held:
+			fmt.Fprintf(cmd.ErrOrStderr(), "Held %s: %v\n", entry.ID, outcome.Err)
+			reportDelivery(cmd, outcome.Result, outcome.Err)
+		default:
+			fmt.Fprintf(cmd.ErrOrStderr(), "Failed %s: %v (next attempt %s)\n", entry.ID, outcome.Err, entry.NextAttempt.Format(time.RFC3339))
+		}
+	}
+}
+
+func countFailed(outcomes []outbox.Outcome) int {
+	n := 0
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// queueMessage stores a message in the outbox, for send --later or after a
+// temporary delivery failure.
+func queueMessage(entry outbox.Entry, raw []byte) (outbox.Entry, error) {
+	queue, err := outbox.Open()
+	if err != nil {
+		return entry, err
+	}
+	return queue.Add(entry, raw)
+}
+
+// queueAfterFailure puts a message whose delivery failed temporarily in the
+// outbox for a later retry.
+func queueAfterFailure(cmd *cobra.Command, entry outbox.Entry, raw []byte, sendErr error) error {
+	now := time.Now()
+	entry.Attempts = 1
+	entry.LastAttempt = now
+	entry.LastError = sendErr.Error()
+	entry.NextAttempt = now.Add(outbox.Backoff(1))
+	queued, err := queueMessage(entry, raw)
+	if err != nil {
+		return fmt.Errorf("%w (queueing failed: %v)", sendErr, err)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Delivery failed: %v\n", sendErr)
+	fmt.Fprintf(cmd.OutOrStdout(), "Queued %s in the outbox; run `mailcli outbox flush` to retry.\n", queued.ID)
+	return nil
+}
+
+var laterLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseLater accepts an absolute local time or a delay such as "2h30m".
+func parseLater(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+	for _, layout := range laterLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --later value %q (use \"2006-01-02 15:04\", RFC 3339, or a delay like 2h)", value)
+}
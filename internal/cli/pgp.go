@@ -0,0 +1,283 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/imap"
+	"mailcli/internal/pgp"
+	"mailcli/internal/secrets"
+	"mailcli/internal/textutil"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+type pgpFlags struct {
+	sign    bool
+	encrypt bool
+}
+
+func addPGPFlags(cmd *cobra.Command, f *pgpFlags) {
+	cmd.Flags().BoolVar(&f.sign, "sign", false, "Sign the message with OpenPGP (PGP/MIME)")
+	cmd.Flags().BoolVar(&f.encrypt, "encrypt", false, "Encrypt the message with OpenPGP to every recipient (PGP/MIME)")
+}
+
+// protect signs and/or encrypts a built message. It runs before Bcc and
+// internal headers are stripped, which only touches the outer headers.
+func (f pgpFlags) protect(cfg config.Config, from string, recipients []string, msg []byte) ([]byte, error) {
+	if !f.sign && !f.encrypt {
+		return msg, nil
+	}
+	ring, err := loadPGPKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ring.Protect(msg, pgp.Options{
+		Sign:          f.sign,
+		Encrypt:       f.encrypt,
+		Signer:        textutil.FirstNonBlank(cfg.PGP.SigningKey, from),
+		Recipients:    recipients,
+		EncryptToSelf: cfg.PGP.EncryptToSelf,
+		Passphrase:    pgpPassphrase,
+	})
+}
+
+// encryptionRecipients lists the addresses to encrypt a message to. An
+// encrypted message names the key of everyone who can read it, so Bcc
+// recipients other than the sender would be revealed to all the others.
+func encryptionRecipients(from string, visible, bcc []string) ([]string, error) {
+	out := visible
+	for _, addr := range bcc {
+		if !strings.EqualFold(addr, from) {
+			return nil, fmt.Errorf("cannot encrypt to Bcc recipient %s: every recipient could see their key; send them a separate message", addr)
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
+
+func loadPGPKeyring(cfg config.Config) (*pgp.Keyring, error) {
+	public, secret, err := cfg.PGP.KeyringPaths()
+	if err != nil {
+		return nil, err
+	}
+	return pgp.LoadKeyring(public, secret)
+}
+
+// pgpPassphrase checks MAILCLI_PGP_PASSPHRASE, then the secrets keyring, and
+// finally prompts when stdin is a terminal.
+func pgpPassphrase(fingerprint string) ([]byte, error) {
+	if value, ok := os.LookupEnv("MAILCLI_PGP_PASSPHRASE"); ok {
+		return []byte(value), nil
+	}
+	if stored, err := secrets.GetPGPPassphrase(fingerprint); err == nil {
+		return []byte(stored), nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("OpenPGP key %s needs a passphrase: set MAILCLI_PGP_PASSPHRASE or run `mailcli pgp passphrase %s`", fingerprint, fingerprint)
+	}
+	return promptPassphrase(fmt.Sprintf("Passphrase for OpenPGP key %s: ", fingerprint))
+}
+
+// openPGP replaces the body of a PGP/MIME or inline PGP message with the
+// decrypted content and returns a verification summary, or "" when the
+// message does not use PGP. A message that cannot be opened is reported in
+// the summary and its body is left as it is.
+func openPGP(cfg config.Config, detail *imap.MessageDetail) string {
+	if !bytes.Contains(detail.Raw, []byte("application/pgp-")) && !strings.Contains(detail.TextBody, "-----BEGIN PGP ") {
+		return ""
+	}
+	ring, err := loadPGPKeyring(cfg)
+	if err != nil {
+		return fmt.Sprintf("could not read: %v", err)
+	}
+	entity, v, err := ring.Open(detail.Raw, pgpPassphrase)
+	if err != nil {
+		return fmt.Sprintf("could not read: %v", err)
+	}
+	if v == nil {
+		text, inline, ok := ring.OpenInline(detail.TextBody, pgpPassphrase)
+		if !ok {
+			return ""
+		}
+		detail.TextBody = text
+		return pgpSummary(detail, inline)
+	}
+	if entity != nil {
+		body, err := email.ParseBody(entity)
+		if err != nil {
+			return fmt.Sprintf("%s, could not read the content: %v", v, err)
+		}
+		detail.TextBody, detail.HTMLBody, detail.Attachments, detail.Calendar = body.Text, body.HTML, body.Attachments, body.Calendar
+	}
+	return pgpSummary(detail, v)
+}
+
+// pgpSummary summarises v, warning when a good signature comes from a key
+// that does not carry the From address.
+func pgpSummary(detail *imap.MessageDetail, v *pgp.Verification) string {
+	status := v.String()
+	if v.Signature != pgp.SignatureGood {
+		return status
+	}
+	if from, err := email.ExtractSender(detail.Raw); err == nil && !v.SignedBy(from) {
+		status += fmt.Sprintf(", but the key has no user ID for the sender %s", textutil.FirstNonBlank(from, "(none)"))
+	}
+	return status
+}
+
+func promptPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+	return pass, nil
+}
+
+func newPGPCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pgp",
+		Short: "Manage OpenPGP keys used to sign and encrypt mail",
+	}
+	cmd.AddCommand(newPGPKeysCmd())
+	cmd.AddCommand(newPGPImportCmd())
+	cmd.AddCommand(newPGPPassphraseCmd())
+	return cmd
+}
+
+func newPGPKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "List keys in the public and secret keyrings",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			ring, err := loadPGPKeyring(cfg)
+			if err != nil {
+				return err
+			}
+			keys := ring.List()
+			if len(keys) == 0 {
+				public, secret, _ := cfg.PGP.KeyringPaths()
+				fmt.Fprintf(cmd.OutOrStdout(), "No keys in %s or %s.\n", public, secret)
+				return nil
+			}
+			printPGPKeys(cmd.OutOrStdout(), keys)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newPGPImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file>...",
+		Short: "Add public or secret keys to the keyrings",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			public, secret, err := cfg.PGP.KeyringPaths()
+			if err != nil {
+				return err
+			}
+			ring, err := pgp.LoadKeyring(public, secret)
+			if err != nil {
+				return err
+			}
+			count := 0
+			for _, path := range args {
+				data, err := os.ReadFile(path) //nolint:gosec // user-supplied key file
+				if err != nil {
+					return fmt.Errorf("read key file: %w", err)
+				}
+				keys, err := pgp.ReadKeys(data)
+				if err != nil {
+					return fmt.Errorf("read keys from %s: %w", path, err)
+				}
+				ring.Add(keys)
+				count += len(keys)
+			}
+			if err := ring.Save(public, secret); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported %d key(s).\n", count)
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newPGPPassphraseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "passphrase <key>",
+		Short: "Store the passphrase of a secret key in the keyring",
+		Long:  "Store the passphrase of a secret key, selected by fingerprint, key ID or address, so signing and decryption do not prompt. The passphrase is read from the terminal or the first line of stdin.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			ring, err := loadPGPKeyring(cfg)
+			if err != nil {
+				return err
+			}
+
+			var pass []byte
+			if term.IsTerminal(int(os.Stdin.Fd())) {
+				pass, err = promptPassphrase("Passphrase: ")
+			} else {
+				var line string
+				line, err = bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				pass = []byte(strings.TrimRight(line, "\r\n"))
+			}
+			if err != nil {
+				return err
+			}
+			if len(pass) == 0 {
+				return fmt.Errorf("passphrase is required")
+			}
+
+			protected := false
+			key, err := ring.SigningKey(args[0], func(string) ([]byte, error) {
+				protected = true
+				return pass, nil
+			})
+			if err != nil {
+				return err
+			}
+			fingerprint := pgp.Fingerprint(key)
+			if !protected {
+				fmt.Fprintf(cmd.OutOrStdout(), "Key %s is not protected by a passphrase; nothing stored.\n", fingerprint)
+				return nil
+			}
+			if err := secrets.SetPGPPassphrase(fingerprint, string(pass)); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Passphrase for %s stored in keyring.\n", fingerprint)
+			return nil
+		},
+	}
+
+	return cmd
+}
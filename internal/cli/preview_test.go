@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+)
+
+func TestSendDryRunMatchesGolden(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.DefaultConfig()
+	cfg.Auth.Username = "me@example.com"
+	cfg.Auth.Password = "secret"
+	if _, err := config.Save(cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+	t.Setenv("MAILCLI_PREVIEW_DATE", "2026-10-18T09:00:00Z")
+	t.Setenv("MAILCLI_PREVIEW_MESSAGE_ID", "<preview@example.com>")
+
+	var out bytes.Buffer
+	root := NewRootCmd()
+	root.SetOut(&out)
+	root.SetArgs([]string{"send", "--dry-run",
+		"--to", "alice@example.com", "--bcc", "audit@example.com",
+		"--subject", "Grüße", "--body", "Hello Alice,\n\nsee you at 10.\n"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("send --dry-run: %v", err)
+	}
+
+	want, err := os.ReadFile(filepath.Join("testdata", "send-dry-run.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("preview differs from testdata/send-dry-run.golden:\n%s", out.String())
+	}
+}
+
+func TestPinOnlyAppliesToDryRun(t *testing.T) {
+	t.Setenv("MAILCLI_PREVIEW_DATE", "2026-10-18T09:00:00Z")
+	t.Setenv("MAILCLI_PREVIEW_MESSAGE_ID", "<preview@example.com>")
+
+	var in email.ComposeInput
+	if err := (previewFlags{outputEML: "out.eml"}).pin(&in); err != nil {
+		t.Fatal(err)
+	}
+	if !in.Date.IsZero() || in.MessageID != "" {
+		t.Fatalf("a message that is sent was pinned: %+v", in)
+	}
+}
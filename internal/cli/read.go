@@ -3,8 +3,12 @@ package cli
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
+	"mailcli/internal/authcheck"
+	"mailcli/internal/calendar"
 	"mailcli/internal/config"
+	"mailcli/internal/email"
 	"mailcli/internal/imap"
 
 	"github.com/spf13/cobra"
@@ -13,6 +17,7 @@ import (
 func newReadCmd() *cobra.Command {
 	var mailbox string
 	var showHTML bool
+	var showAuth bool
 
 	cmd := &cobra.Command{
 		Use:   "read <uid>",
@@ -33,10 +38,12 @@ func newReadCmd() *cobra.Command {
 			}
 
 			service := imap.NewService()
-			detail, err := service.ReadMessage(cfg, mailbox, uint32(uid))
+			detail, err := service.ReadMessage(cmd.Context(), cfg, mailbox, uint32(uid))
 			if err != nil {
 				return err
 			}
+			pgpStatus := openPGP(cfg, &detail)
+			smimeStatus := openSMIME(cfg, &detail)
 
 			fmt.Fprintf(cmd.OutOrStdout(), "UID: %d\n", detail.UID)
 			if detail.Subject != "" {
@@ -57,7 +64,31 @@ func newReadCmd() *cobra.Command {
 			if len(detail.Attachments) > 0 {
 				fmt.Fprintf(cmd.OutOrStdout(), "Attachments: %s\n", detail.Attachments)
 			}
+			if showAuth {
+				report, err := authcheck.Check(cmd.Context(), detail.Raw, authcheck.Options{KnownDomains: ownDomains(cfg)})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "")
+				printAuthReport(cmd.OutOrStdout(), report)
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), "")
+			if pgpStatus != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "[PGP: %s]\n\n", pgpStatus)
+			}
+			if smimeStatus != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "[S/MIME: %s]\n\n", smimeStatus)
+			}
+			if req := email.ParseReceiptRequest(detail.Raw); req != nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "[%s]\n\n", receiptStatus(req, detail))
+			}
+			if detail.Calendar != nil {
+				if invite, err := calendar.Parse(detail.Calendar); err == nil {
+					fmt.Fprintln(cmd.OutOrStdout(), invite.Describe())
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "[Calendar: %v]\n\n", err)
+				}
+			}
 			body := detail.TextBody
 			if showHTML && detail.HTMLBody != "" {
 				body = detail.HTMLBody
@@ -69,6 +100,19 @@ func newReadCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&mailbox, "mailbox", "INBOX", "Mailbox name")
 	cmd.Flags().BoolVar(&showHTML, "html", false, "Show raw HTML body when available")
+	cmd.Flags().BoolVar(&showAuth, "auth", false, "Show SPF/DKIM/DMARC results, verify DKIM signatures and flag spoofing signs")
 
 	return cmd
 }
+
+// receiptStatus describes a read receipt request and how to answer it.
+func receiptStatus(req *email.ReceiptRequest, detail imap.MessageDetail) string {
+	status := "Read receipt requested by " + strings.Join(req.To, ", ")
+	switch {
+	case hasFlag(detail.Flags, imap.MDNSentFlag):
+		return status + "; already sent"
+	case req.NeedsConfirmation():
+		return status + fmt.Sprintf(", not the sender; send it with `mailcli mdn send %d --force`", detail.UID)
+	}
+	return status + fmt.Sprintf("; send it with `mailcli mdn send %d`", detail.UID)
+}
@@ -1,19 +1,50 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"mailcli/internal/trace"
 
 	"github.com/spf13/cobra"
 )
 
 func NewRootCmd() *cobra.Command {
+	var debug bool
+	var debugProtocol string
+	var debugFile string
+
 	cmd := &cobra.Command{
 		Use:          "mailcli",
 		Short:        "mailcli is a CLI for IMAP/SMTP mail servers",
 		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			spec := os.Getenv("MAILCLI_DEBUG")
+			switch {
+			case cmd.Flags().Changed("debug-protocol"):
+				spec = debugProtocol
+			case cmd.Flags().Changed("debug"):
+				spec = ""
+				if debug {
+					spec = "all"
+				}
+			}
+			if !cmd.Flags().Changed("debug-file") {
+				debugFile = os.Getenv("MAILCLI_DEBUG_FILE")
+			}
+			return trace.Configure(spec, debugFile)
+		},
 	}
 
+	cmd.PersistentFlags().BoolVar(&debug, "debug", false, "Trace IMAP and SMTP traffic with credentials redacted")
+	cmd.PersistentFlags().StringVar(&debugProtocol, "debug-protocol", "", "Trace only these protocols (imap, smtp, or all; comma-separated)")
+	cmd.PersistentFlags().StringVar(&debugFile, "debug-file", "", "Write protocol traces to this file instead of stderr")
+
 	cmd.AddCommand(newAuthCmd())
 	cmd.AddCommand(newStatusCmd())
 	cmd.AddCommand(newInboxCmd())
@@ -28,6 +59,18 @@ func NewRootCmd() *cobra.Command {
 	cmd.AddCommand(newMailboxesCmd())
 	cmd.AddCommand(newAttachmentsCmd())
 	cmd.AddCommand(newConfigCmd())
+	cmd.AddCommand(newDoctorCmd())
+	cmd.AddCommand(newTLSCmd())
+	cmd.AddCommand(newOutboxCmd())
+	cmd.AddCommand(newTemplatesCmd())
+	cmd.AddCommand(newMergeCmd())
+	cmd.AddCommand(newSendmailCmd())
+	cmd.AddCommand(newPGPCmd())
+	cmd.AddCommand(newSMIMECmd())
+	cmd.AddCommand(newDKIMCmd())
+	cmd.AddCommand(newInviteCmd())
+	cmd.AddCommand(newMDNCmd())
+	cmd.AddCommand(newBouncesCmd())
 
 	cmd.SetErr(os.Stderr)
 	cmd.SetOut(os.Stdout)
@@ -36,7 +79,25 @@ func NewRootCmd() *cobra.Command {
 }
 
 func Execute() {
-	if err := NewRootCmd().Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// Restore default signal handling so a second Ctrl-C exits immediately.
+		<-ctx.Done()
+		stop()
+	}()
+
+	root := NewRootCmd()
+	// Installed or linked as "sendmail", behave like `mailcli sendmail`.
+	if filepath.Base(os.Args[0]) == "sendmail" {
+		root.SetArgs(append([]string{"sendmail"}, os.Args[1:]...))
+	}
+	err := root.ExecuteContext(ctx)
+	_ = trace.Close()
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Interrupted.")
+			os.Exit(130)
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -33,7 +33,7 @@ func newSearchCmd() *cobra.Command {
 
 			service := imap.NewService()
 			if threads {
-				threadSummaries, total, err := service.SearchThreads(cfg, mailbox, query, page, pageSize)
+				threadSummaries, total, err := service.SearchThreads(cmd.Context(), cfg, mailbox, query, page, pageSize)
 				if err != nil {
 					if !errors.Is(err, imap.ErrThreadUnsupported) {
 						return err
@@ -46,7 +46,7 @@ func newSearchCmd() *cobra.Command {
 				}
 			}
 
-			messages, total, err := service.SearchMessages(cfg, mailbox, query, page, pageSize)
+			messages, total, err := service.SearchMessages(cmd.Context(), cfg, mailbox, query, page, pageSize)
 			if err != nil {
 				return err
 			}
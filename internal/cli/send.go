@@ -2,13 +2,18 @@ package cli
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"mailcli/internal/calendar"
 	"mailcli/internal/config"
 	"mailcli/internal/email"
 	"mailcli/internal/imap"
+	"mailcli/internal/outbox"
 	"mailcli/internal/smtp"
+	"mailcli/internal/textutil"
 
 	"github.com/spf13/cobra"
 )
@@ -27,6 +32,18 @@ func newSendCmd() *cobra.Command {
 	var quote bool
 	var replyMailbox string
 	var attachments []string
+	var inline []string
+	var format bodyFormat
+	var ident identityFlags
+	var delivery smtp.Options
+	var later string
+	var templateName string
+	var vars []string
+	var previewOpts previewFlags
+	var pgpOpts pgpFlags
+	var smimeOpts smimeFlags
+	var icsFile string
+	var requestReceipt bool
 
 	cmd := &cobra.Command{
 		Use:   "send",
@@ -36,14 +53,57 @@ func newSendCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			if err := config.ValidateSMTP(cfg); err != nil {
+			if !previewOpts.dryRun {
+				if err := config.ValidateSMTP(cfg); err != nil {
+					return err
+				}
+			}
+			if err := delivery.Validate(); err != nil {
 				return err
 			}
+			var notBefore time.Time
+			if later != "" {
+				notBefore, err = parseLater(later, time.Now())
+				if err != nil {
+					return err
+				}
+			}
 
 			content, err := loadBody(body, bodyFile)
 			if err != nil {
 				return err
 			}
+			if templateName != "" {
+				tmpl, err := renderTemplate(templateName, vars)
+				if err != nil {
+					return err
+				}
+				to = textutil.FirstNonBlank(to, strings.Join(tmpl.To, ", "))
+				cc = textutil.FirstNonBlank(cc, strings.Join(tmpl.Cc, ", "))
+				bcc = textutil.FirstNonBlank(bcc, strings.Join(tmpl.Bcc, ", "))
+				subject = textutil.FirstNonBlank(subject, tmpl.Subject)
+				replyTo = textutil.FirstNonBlank(replyTo, tmpl.ReplyTo)
+				if ident.identity == "" && ident.from == "" {
+					ident.identity, ident.from = tmpl.Identity, tmpl.From
+				}
+				if strings.TrimSpace(content) == "" && strings.TrimSpace(bodyHTML) == "" {
+					content, bodyHTML = tmpl.Body, tmpl.BodyHTML
+					if bodyHTML == "" && !cmd.Flags().Changed("body-format") {
+						format.format = tmpl.Format
+					}
+				}
+				attachments = append(tmpl.Attachments, attachments...)
+				inline = append(tmpl.Inline, inline...)
+			}
+			markdown, err := format.isMarkdown(bodyHTML)
+			if err != nil {
+				return err
+			}
+			if markdown {
+				if bodyHTML, err = email.RenderMarkdown(content); err != nil {
+					return err
+				}
+			}
 
 			if replyAll && strings.TrimSpace(replyUID) == "" {
 				return fmt.Errorf("--reply-all requires --reply-uid")
@@ -51,6 +111,9 @@ func newSendCmd() *cobra.Command {
 			if quote && strings.TrimSpace(replyUID) == "" {
 				return fmt.Errorf("--quote requires --reply-uid")
 			}
+			if (pgpOpts.sign || pgpOpts.encrypt) && (smimeOpts.sign || smimeOpts.encrypt) {
+				return fmt.Errorf("OpenPGP and S/MIME options cannot be combined")
+			}
 
 			var replyInfo *email.ReplyInfo
 			var inReplyTo string
@@ -68,7 +131,7 @@ func newSendCmd() *cobra.Command {
 				}
 
 				service := imap.NewService()
-				raw, err := service.FetchRawMessage(cfg, replyMailbox, uint32(uid))
+				raw, err := service.FetchRawMessage(cmd.Context(), cfg, replyMailbox, uint32(uid))
 				if err != nil {
 					return err
 				}
@@ -77,23 +140,56 @@ func newSendCmd() *cobra.Command {
 					return err
 				}
 				inReplyTo, references = email.BuildReplyHeaders(replyInfo)
-				content, bodyHTML = email.ApplyQuoteToBodies(content, bodyHTML, quote, replyInfo)
 				if strings.TrimSpace(subject) == "" && replyInfo.Subject != "" {
 					subject = email.ReplySubject(replyInfo.Subject)
 				}
 			}
 
-			if strings.TrimSpace(content) == "" && strings.TrimSpace(bodyHTML) == "" {
+			var invite []byte
+			if icsFile != "" {
+				data, err := os.ReadFile(icsFile) //nolint:gosec // user-supplied calendar file
+				if err != nil {
+					return fmt.Errorf("read calendar file: %w", err)
+				}
+				var parsed *calendar.Invite
+				if invite, parsed, err = calendar.AsRequest(data); err != nil {
+					return err
+				}
+				if strings.TrimSpace(to) == "" && strings.TrimSpace(cc) == "" && replyInfo == nil {
+					to = strings.Join(parsed.Recipients(), ", ")
+				}
+				subject = textutil.FirstNonBlank(subject, parsed.Events[0].Summary)
+				if strings.TrimSpace(content) == "" && strings.TrimSpace(bodyHTML) == "" {
+					content = parsed.Describe()
+				}
+			}
+
+			if strings.TrimSpace(content) == "" && strings.TrimSpace(bodyHTML) == "" && !quote {
 				return fmt.Errorf("message body required (use --body, --body-file, --body-html, or --quote)")
 			}
 
+			from, err := resolveSender(cfg, ident, replyInfo)
+			if err != nil {
+				return err
+			}
+			signature, err := from.Signature(ident)
+			if err != nil {
+				return err
+			}
+			content, bodyHTML = email.ApplySignatureAndQuote(content, bodyHTML, signature, signatureAbove(cfg), quote, replyInfo)
+			if markdown && bodyHTML != "" {
+				if bodyHTML, err = wrapMarkdownHTML(cfg, bodyHTML); err != nil {
+					return err
+				}
+			}
+
 			var toList []string
 			var ccList []string
 			if replyInfo != nil {
 				if replyAll {
-					toList, ccList = email.BuildReplyAllRecipients(replyInfo, cfg.Auth.Username)
+					toList, ccList = email.BuildReplyAllRecipients(replyInfo, from.Self(cfg)...)
 				} else {
-					toList = email.BuildReplyRecipients(replyInfo, cfg.Auth.Username)
+					toList = email.BuildReplyRecipients(replyInfo, from.Self(cfg)...)
 				}
 				if strings.TrimSpace(to) != "" {
 					toList = splitList(to)
@@ -106,34 +202,89 @@ func newSendCmd() *cobra.Command {
 				ccList = splitList(cc)
 			}
 
-			bccList := splitList(bcc)
+			bccList := from.Bcc(splitList(bcc))
 			recipients := append(append([]string{}, toList...), ccList...)
 			recipients = append(recipients, bccList...)
 			if len(recipients) == 0 {
 				return fmt.Errorf("at least one recipient is required")
 			}
 
-			msg, err := email.BuildMessage(email.ComposeInput{
-				From:        cfg.Auth.Username,
-				To:          toList,
-				Cc:          ccList,
-				Bcc:         bccList,
-				ReplyTo:     replyTo,
-				Subject:     subject,
-				Body:        content,
-				BodyHTML:    bodyHTML,
-				InReplyTo:   inReplyTo,
-				References:  references,
-				Attachments: attachments,
-			})
+			input := email.ComposeInput{
+				From:           from.From(),
+				To:             toList,
+				Cc:             ccList,
+				Bcc:            bccList,
+				ReplyTo:        from.ReplyTo(replyTo),
+				Subject:        subject,
+				Body:           content,
+				BodyHTML:       bodyHTML,
+				InReplyTo:      inReplyTo,
+				References:     references,
+				Attachments:    attachments,
+				Inline:         inline,
+				Calendar:       invite,
+				CalendarMethod: calendar.MethodRequest,
+				ReceiptTo:      receiptTo(requestReceipt, from),
+				StoreBccHeader: len(bccList) > 0,
+			}
+			if err := previewOpts.pin(&input); err != nil {
+				return err
+			}
+			msg, err := email.BuildMessage(input)
 			if err != nil {
 				return err
 			}
+			encryptTo := recipients
+			if pgpOpts.encrypt || smimeOpts.encrypt {
+				if encryptTo, err = encryptionRecipients(from.address, append(append([]string{}, toList...), ccList...), bccList); err != nil {
+					return err
+				}
+			}
+			if msg, err = pgpOpts.protect(cfg, from.address, encryptTo, msg); err != nil {
+				return err
+			}
+			if msg, err = smimeOpts.protect(cfg, from.address, encryptTo, msg); err != nil {
+				return err
+			}
+			wire, record := email.PrepareForDelivery(msg)
+			if wire, err = signDKIM(cfg, wire); err != nil {
+				return err
+			}
 
-			if err := smtp.Send(cfg, cfg.Auth.Username, recipients, msg); err != nil {
+			if done, err := previewOpts.preview(cmd, from.address, recipients, wire); done || err != nil {
 				return err
 			}
 
+			entry := outbox.Entry{
+				From:       from.address,
+				Recipients: recipients,
+				Subject:    subject,
+				Delivery:   delivery,
+				NotBefore:  notBefore,
+			}
+			if !notBefore.IsZero() {
+				entry, err = queueMessage(entry, record)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Scheduled %s for %s.\n", entry.ID, notBefore.Format(time.RFC3339))
+				return nil
+			}
+
+			result, err := smtp.Send(cmd.Context(), cfg, from.address, recipients, wire, delivery)
+			if smtp.IsTemporary(err) {
+				return queueAfterFailure(cmd, entry, record, err)
+			}
+			reportDelivery(cmd, result, err)
+			if err != nil {
+				return err
+			}
+			fileSentCopy(cmd, cfg, record)
+
+			if len(result.Rejected) > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "Sent to %d of %d recipients.\n", len(result.Accepted), len(recipients))
+				return nil
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), "Sent.")
 			return nil
 		},
@@ -146,12 +297,24 @@ func newSendCmd() *cobra.Command {
 	cmd.Flags().StringVar(&body, "body", "", "Message body (plain text)")
 	cmd.Flags().StringVar(&bodyFile, "body-file", "", "Path to file containing message body ('-' for stdin)")
 	cmd.Flags().StringVar(&bodyHTML, "body-html", "", "Message body (HTML)")
+	addBodyFormatFlags(cmd, &format)
+	addIdentityFlags(cmd, &ident)
 	cmd.Flags().StringVar(&replyTo, "reply-to", "", "Reply-To header address")
 	cmd.Flags().StringVar(&replyUID, "reply-uid", "", "Reply to message UID (uses headers and thread)")
 	cmd.Flags().BoolVar(&replyAll, "reply-all", false, "Reply-all using original recipients (requires --reply-uid)")
 	cmd.Flags().BoolVar(&quote, "quote", false, "Include quoted original message (requires --reply-uid)")
 	cmd.Flags().StringVar(&replyMailbox, "reply-mailbox", "INBOX", "Mailbox containing the reply target")
 	cmd.Flags().StringSliceVar(&attachments, "attachment", nil, "Attachment file paths (repeatable)")
+	cmd.Flags().StringVar(&icsFile, "ics", "", "Send an iCalendar file as a meeting invitation (METHOD:REQUEST); attendees are the default recipients")
+	cmd.Flags().StringSliceVar(&inline, "inline", nil, "Inline image as path[=cid], referenced from the HTML body (repeatable)")
+	cmd.Flags().BoolVar(&requestReceipt, "request-receipt", false, "Ask recipients for a read receipt (Disposition-Notification-To)")
+	addDeliveryFlags(cmd, &delivery)
+	addPreviewFlags(cmd, &previewOpts)
+	addPGPFlags(cmd, &pgpOpts)
+	addSMIMEFlags(cmd, &smimeOpts)
+	cmd.Flags().StringVar(&templateName, "template", "", "Compose from a template file or a name in the templates directory")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Template variable as key=value (repeatable)")
+	cmd.Flags().StringVar(&later, "later", "", "Queue the message for delivery at a local time (\"2026-10-20 09:00\") or after a delay (2h)")
 
 	return cmd
 }
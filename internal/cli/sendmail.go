@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/outbox"
+	"mailcli/internal/smtp"
+
+	"github.com/spf13/cobra"
+)
+
+func newSendmailCmd() *cobra.Command {
+	var extract bool
+	var envelopeFrom string
+	var fullName string
+	var ignored []string
+	var ignoredBool bool
+
+	cmd := &cobra.Command{
+		Use:   "sendmail [recipients...]",
+		Short: "Send a complete message from stdin, like sendmail",
+		Long: "Reads an RFC 822 message from stdin and delivers it. With -t, recipients are also taken\n" +
+			"from the To, Cc and Bcc headers; Bcc is removed before the message is sent. Missing From,\n" +
+			"Date and Message-ID headers are added. Common sendmail options such as -i and -oi are accepted\n" +
+			"and ignored, so mailcli can be used as a user's sendmail.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := config.ValidateSMTP(cfg); err != nil {
+				return err
+			}
+
+			raw, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("read message: %w", err)
+			}
+			if len(bytes.TrimSpace(raw)) == 0 {
+				return fmt.Errorf("no message on stdin")
+			}
+
+			var recipients []string
+			for _, arg := range args {
+				recipients = append(recipients, splitList(arg)...)
+			}
+			if extract {
+				fromHeaders, err := email.ExtractRecipients(raw)
+				if err != nil {
+					return fmt.Errorf("read recipients: %w", err)
+				}
+				recipients = append(recipients, fromHeaders...)
+			}
+			recipients = uniqueAddresses(recipients)
+			if len(recipients) == 0 {
+				return fmt.Errorf("no recipients (pass addresses or use -t)")
+			}
+
+			identity := cfg.DefaultIdentity()
+			from := identity.Address
+			headerFrom := sender{identity: identity, address: identity.Address}.From()
+			if envelopeFrom != "" {
+				addr, err := mail.ParseAddress(envelopeFrom)
+				if err != nil {
+					return fmt.Errorf("invalid -f address %q: %w", envelopeFrom, err)
+				}
+				from, headerFrom = addr.Address, addr.Address
+			} else if addr, err := email.ExtractSender(raw); err == nil && addr != "" {
+				// A From header may name anyone; use it as the envelope sender
+				// only if it is one of the configured identities.
+				if _, ok := cfg.IdentityForAddress(addr); ok {
+					from = addr
+				}
+			}
+			if fullName != "" {
+				headerFrom = (&mail.Address{Name: fullName, Address: from}).String()
+			}
+
+			raw, err = email.CompleteHeaders(raw, headerFrom, time.Now())
+			if err != nil {
+				return err
+			}
+			wire, record := email.PrepareForDelivery(raw)
+			if wire, err = signDKIM(cfg, wire); err != nil {
+				return err
+			}
+
+			result, err := smtp.Send(cmd.Context(), cfg, from, recipients, wire, smtp.Options{})
+			if smtp.IsTemporary(err) {
+				subject := ""
+				if info, infoErr := email.ExtractReplyInfo(raw, false); infoErr == nil {
+					subject = info.Subject
+				}
+				return queueAfterFailure(cmd, outbox.Entry{From: from, Recipients: recipients, Subject: subject}, record, err)
+			}
+			reportDelivery(cmd, result, err)
+			if err != nil {
+				return err
+			}
+			fileSentCopy(cmd, cfg, record)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&extract, "read-recipients", "t", false, "Read recipients from the To, Cc and Bcc headers")
+	cmd.Flags().StringVarP(&envelopeFrom, "from", "f", "", "Envelope sender address")
+	cmd.Flags().StringVarP(&envelopeFrom, "sender", "r", "", "Same as -f")
+	cmd.Flags().StringVarP(&fullName, "full-name", "F", "", "Sender's full name, used if the message has no From header")
+	cmd.Flags().StringArrayVarP(&ignored, "option", "o", nil, "Ignored, for sendmail compatibility")
+	cmd.Flags().StringArrayVarP(&ignored, "body-type", "B", nil, "Ignored, for sendmail compatibility")
+	cmd.Flags().BoolVarP(&ignoredBool, "ignore-dots", "i", false, "Ignored; a lone dot never ends the message")
+	return cmd
+}
+
+func uniqueAddresses(addrs []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if parsed, err := mail.ParseAddress(addr); err == nil {
+			addr = parsed.Address
+		}
+		key := strings.ToLower(addr)
+		if addr == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, addr)
+	}
+	return out
+}
@@ -0,0 +1,269 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/imap"
+	"mailcli/internal/secrets"
+	"mailcli/internal/smime"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+type smimeFlags struct {
+	sign    bool
+	encrypt bool
+}
+
+func addSMIMEFlags(cmd *cobra.Command, f *smimeFlags) {
+	cmd.Flags().BoolVar(&f.sign, "smime-sign", false, "Sign the message with the sender's S/MIME certificate")
+	cmd.Flags().BoolVar(&f.encrypt, "smime-encrypt", false, "Encrypt the message with S/MIME to every recipient")
+}
+
+// protect signs and/or encrypts a built message with S/MIME.
+func (f smimeFlags) protect(cfg config.Config, from string, recipients []string, msg []byte) ([]byte, error) {
+	if !f.sign && !f.encrypt {
+		return msg, nil
+	}
+	opts := smime.Options{Sign: f.sign, Encrypt: f.encrypt}
+	if f.encrypt {
+		dir, err := cfg.SMIME.CertsDir()
+		if err != nil {
+			return nil, err
+		}
+		if opts.Recipients, err = (smime.CertStore{Dir: dir}).Lookup(recipients); err != nil {
+			return nil, err
+		}
+	}
+	id, err := loadSMIMEIdentity(from)
+	switch {
+	case err == nil:
+		opts.Identity = id
+	case f.sign || !errors.Is(err, secrets.ErrSecretNotFound):
+		return nil, err
+	}
+	return smime.Protect(msg, opts)
+}
+
+func loadSMIMEIdentity(address string) (*smime.Identity, error) {
+	data, err := secrets.GetSMIMEIdentity(address)
+	if errors.Is(err, secrets.ErrSecretNotFound) {
+		return nil, fmt.Errorf("no S/MIME certificate for %s; add one with `mailcli smime import`: %w", address, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return smime.ParseIdentity(data, "")
+}
+
+// openSMIME replaces the body of an S/MIME message with the decrypted or
+// verified content and returns a verification summary, or "" when the
+// message does not use S/MIME. A message that cannot be opened is reported
+// in the summary and its body is left as it is.
+func openSMIME(cfg config.Config, detail *imap.MessageDetail) string {
+	if !bytes.Contains(bytes.ToLower(detail.Raw), []byte("pkcs7-")) {
+		return ""
+	}
+	var opts smime.OpenOptions
+	if cfg.SMIME.TrustStore != "" {
+		data, err := os.ReadFile(cfg.SMIME.TrustStore) //nolint:gosec // trust store path comes from the user's config
+		if err != nil {
+			return fmt.Sprintf("could not read: read S/MIME trust store: %v", err)
+		}
+		opts.Roots = x509.NewCertPool()
+		if !opts.Roots.AppendCertsFromPEM(data) {
+			return fmt.Sprintf("could not read: no certificates in S/MIME trust store %s", cfg.SMIME.TrustStore)
+		}
+	}
+	if smime.IsEncrypted(detail.Raw) {
+		for _, addr := range ownAddresses(cfg) {
+			if id, err := loadSMIMEIdentity(addr); err == nil {
+				opts.Identities = append(opts.Identities, id)
+			}
+		}
+	}
+	entity, v, err := smime.Open(detail.Raw, opts)
+	if err != nil {
+		return fmt.Sprintf("could not read: %v", err)
+	}
+	if v == nil {
+		return ""
+	}
+	if entity != nil {
+		body, err := email.ParseBody(entity)
+		if err != nil {
+			return fmt.Sprintf("%s, could not read the content: %v", v, err)
+		}
+		detail.TextBody, detail.HTMLBody, detail.Attachments, detail.Calendar = body.Text, body.HTML, body.Attachments, body.Calendar
+	}
+	return v.String()
+}
+
+// ownAddresses lists the login and every identity address and alias.
+func ownAddresses(cfg config.Config) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(addr string) {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+	add(cfg.Auth.Username)
+	for _, id := range cfg.Identities {
+		add(id.Address)
+		for _, alias := range id.Aliases {
+			add(alias)
+		}
+	}
+	return out
+}
+
+// ownDomains lists the domains of ownAddresses.
+func ownDomains(cfg config.Config) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, addr := range ownAddresses(cfg) {
+		if _, domain, ok := strings.Cut(addr, "@"); ok && !seen[domain] {
+			seen[domain] = true
+			out = append(out, domain)
+		}
+	}
+	return out
+}
+
+func newSMIMECmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "smime",
+		Short: "Manage S/MIME certificates",
+	}
+	cmd.AddCommand(newSMIMEImportCmd())
+	cmd.AddCommand(newSMIMEAddCertCmd())
+	cmd.AddCommand(newSMIMECertsCmd())
+	return cmd
+}
+
+func newSMIMEImportCmd() *cobra.Command {
+	var addresses []string
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Store your certificate and private key (PKCS#12 or PEM) in the keyring",
+		Long:  "Store your S/MIME certificate and private key in the keyring. A PKCS#12 password is taken from MAILCLI_SMIME_PASSWORD or prompted for on the terminal.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0]) //nolint:gosec // user-supplied certificate file
+			if err != nil {
+				return fmt.Errorf("read certificate file: %w", err)
+			}
+			password := os.Getenv("MAILCLI_SMIME_PASSWORD")
+			if smime.IsPKCS12(data) && password == "" && term.IsTerminal(int(os.Stdin.Fd())) {
+				pass, err := promptPassphrase("PKCS#12 password: ")
+				if err != nil {
+					return err
+				}
+				password = string(pass)
+			}
+			id, err := smime.ParseIdentity(data, password)
+			if err != nil {
+				return err
+			}
+			pemData, err := id.PEM()
+			if err != nil {
+				return err
+			}
+			if len(addresses) == 0 {
+				addresses = smime.Addresses(id.Certificate)
+			}
+			if len(addresses) == 0 {
+				return fmt.Errorf("the certificate names no e-mail address; pass --address")
+			}
+			for _, addr := range addresses {
+				if err := secrets.SetSMIMEIdentity(addr, pemData); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Stored S/MIME identity %s for %s.\n", id.Certificate.Subject.CommonName, strings.Join(addresses, ", "))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&addresses, "address", nil, "Address to use the certificate for (default: the addresses in the certificate)")
+
+	return cmd
+}
+
+func newSMIMEAddCertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add-cert <file>...",
+		Short: "Add correspondents' certificates used for encryption",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			dir, err := cfg.SMIME.CertsDir()
+			if err != nil {
+				return err
+			}
+			store := smime.CertStore{Dir: dir}
+			for _, path := range args {
+				data, err := os.ReadFile(path) //nolint:gosec // user-supplied certificate file
+				if err != nil {
+					return fmt.Errorf("read certificate file: %w", err)
+				}
+				certs, err := smime.ReadCertificates(data)
+				if err != nil {
+					return fmt.Errorf("read %s: %w", path, err)
+				}
+				addresses, err := store.Add(certs[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Added certificate for %s.\n", strings.Join(addresses, ", "))
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newSMIMECertsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "certs",
+		Short: "List correspondents' certificates",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			dir, err := cfg.SMIME.CertsDir()
+			if err != nil {
+				return err
+			}
+			certs, addresses, err := (smime.CertStore{Dir: dir}).List()
+			if err != nil {
+				return err
+			}
+			if len(addresses) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No certificates in %s.\n", dir)
+				return nil
+			}
+			printSMIMECerts(cmd.OutOrStdout(), addresses, certs)
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -10,10 +10,21 @@ import (
 )
 
 func newStatusCmd() *cobra.Command {
+	var mailboxes []string
+	var all bool
+	var quotaThreshold float64
+
 	cmd := &cobra.Command{
 		Use:   "status",
-		Short: "Show mailbox status",
+		Short: "Show mailbox status and quota usage",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if all && len(mailboxes) > 0 {
+				return fmt.Errorf("use either --all or --mailbox")
+			}
+			if quotaThreshold < 0 || quotaThreshold > 100 {
+				return fmt.Errorf("--quota-threshold must be between 0 and 100")
+			}
+
 			cfg, err := loadConfig()
 			if err != nil {
 				return err
@@ -22,15 +33,45 @@ func newStatusCmd() *cobra.Command {
 				return err
 			}
 
-			service := imap.NewService()
-			status, err := service.Status(cfg, "INBOX")
+			names := mailboxes
+			if !all && len(names) == 0 {
+				names = []string{"INBOX"}
+			}
+
+			status, err := imap.NewService().MailboxStats(cmd.Context(), cfg, names)
 			if err != nil {
 				return err
 			}
+			printMailboxStats(cmd.OutOrStdout(), status.Mailboxes)
 
-			fmt.Fprintf(cmd.OutOrStdout(), "INBOX: %d messages, %d unseen\n", status.Messages, status.Unseen)
+			if !status.QuotaSupported {
+				if quotaThreshold > 0 {
+					return imap.ErrQuotaUnsupported
+				}
+				fmt.Fprintln(cmd.ErrOrStderr(), "Server does not support QUOTA; skipping storage usage.")
+				return nil
+			}
+			roots := status.Quota
+
+			fmt.Fprintln(cmd.OutOrStdout(), "")
+			printQuota(cmd.OutOrStdout(), roots)
+
+			if quotaThreshold > 0 {
+				for _, root := range roots {
+					for _, res := range root.Resources {
+						if res.Limit > 0 && res.Percent() >= quotaThreshold {
+							return fmt.Errorf("quota %s usage %.1f%% exceeds threshold %.1f%%", res.Name, res.Percent(), quotaThreshold)
+						}
+					}
+				}
+			}
 			return nil
 		},
 	}
+
+	cmd.Flags().StringSliceVar(&mailboxes, "mailbox", nil, "Mailbox names (repeatable; default INBOX)")
+	cmd.Flags().BoolVar(&all, "all", false, "Show status for all selectable mailboxes")
+	cmd.Flags().Float64Var(&quotaThreshold, "quota-threshold", 0, "Exit non-zero when any quota resource reaches this percentage (0 disables)")
+
 	return cmd
 }
@@ -33,7 +33,7 @@ func newTagCmd() *cobra.Command {
 			}
 
 			service := imap.NewService()
-			if err := service.AddTag(cfg, mailbox, uint32(uid), tag); err != nil {
+			if err := service.AddTag(cmd.Context(), cfg, mailbox, uint32(uid), tag); err != nil {
 				return err
 			}
 
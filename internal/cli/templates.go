@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/templates"
+
+	"github.com/spf13/cobra"
+)
+
+func newTemplatesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "templates",
+		Short: "Message templates",
+	}
+	cmd.AddCommand(newTemplatesListCmd())
+	cmd.AddCommand(newTemplatesShowCmd())
+	cmd.AddCommand(newTemplatesRenderCmd())
+	return cmd
+}
+
+func newTemplatesListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List templates in the templates directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := config.TemplatesDir()
+			if err != nil {
+				return err
+			}
+			list, err := templates.List(dir)
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No templates in %s.\n", dir)
+				return nil
+			}
+			printTemplates(cmd.OutOrStdout(), list)
+			return nil
+		},
+	}
+}
+
+func newTemplatesShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <name>",
+		Short: "Print a template's source",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tmpl, err := resolveTemplate(args[0])
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(tmpl.Path) //nolint:gosec // template path is chosen by the user
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		},
+	}
+}
+
+func newTemplatesRenderCmd() *cobra.Command {
+	var vars []string
+	var ident identityFlags
+
+	cmd := &cobra.Command{
+		Use:   "render <name>",
+		Short: "Render a template to an RFC 822 message without sending it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			msg, err := renderTemplate(args[0], vars)
+			if err != nil {
+				return err
+			}
+			composed, err := composeTemplate(cfg, msg, ident)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(composed.raw)
+			return err
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "Template variable as key=value (repeatable)")
+	addIdentityFlags(cmd, &ident)
+
+	return cmd
+}
+
+func resolveTemplate(name string) (*templates.Template, error) {
+	dir, err := config.TemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+	path, err := templates.Resolve(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return templates.Load(path)
+}
+
+func renderTemplate(name string, pairs []string) (templates.Message, error) {
+	tmpl, err := resolveTemplate(name)
+	if err != nil {
+		return templates.Message{}, err
+	}
+	vars, err := templates.ParseVars(pairs)
+	if err != nil {
+		return templates.Message{}, err
+	}
+	return tmpl.Render(vars)
+}
+
+type composedMessage struct {
+	from       sender
+	recipients []string
+	subject    string
+	raw        []byte
+	record     []byte
+}
+
+// composeTemplate builds the message a rendered template describes, using the
+// identity from the flags or the template's front matter.
+func composeTemplate(cfg config.Config, msg templates.Message, ident identityFlags) (composedMessage, error) {
+	if ident.identity == "" && ident.from == "" {
+		ident.identity, ident.from = msg.Identity, msg.From
+	}
+	from, err := resolveSender(cfg, ident, nil)
+	if err != nil {
+		return composedMessage{}, err
+	}
+	signature, err := from.Signature(ident)
+	if err != nil {
+		return composedMessage{}, err
+	}
+
+	markdown, err := bodyFormat{format: msg.Format}.isMarkdown("")
+	if err != nil {
+		return composedMessage{}, fmt.Errorf("template format: %w", err)
+	}
+	content, bodyHTML := msg.Body, msg.BodyHTML
+	markdown = markdown && bodyHTML == ""
+	if markdown {
+		if bodyHTML, err = email.RenderMarkdown(content); err != nil {
+			return composedMessage{}, err
+		}
+	}
+	content, bodyHTML = email.AppendSignature(content, bodyHTML, signature)
+	if markdown && bodyHTML != "" {
+		if bodyHTML, err = wrapMarkdownHTML(cfg, bodyHTML); err != nil {
+			return composedMessage{}, err
+		}
+	}
+
+	bcc := from.Bcc(msg.Bcc)
+	recipients := append(append(append([]string{}, msg.To...), msg.Cc...), bcc...)
+	raw, err := email.BuildMessage(email.ComposeInput{
+		From:           from.From(),
+		To:             msg.To,
+		Cc:             msg.Cc,
+		Bcc:            bcc,
+		ReplyTo:        from.ReplyTo(msg.ReplyTo),
+		Subject:        msg.Subject,
+		Body:           content,
+		BodyHTML:       bodyHTML,
+		Attachments:    msg.Attachments,
+		Inline:         msg.Inline,
+		StoreBccHeader: len(bcc) > 0,
+	})
+	if err != nil {
+		return composedMessage{}, err
+	}
+	wire, record := email.PrepareForDelivery(raw)
+	return composedMessage{from: from, recipients: recipients, subject: msg.Subject, raw: wire, record: record}, nil
+}
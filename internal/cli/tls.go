@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"crypto/x509"
+	"fmt"
+	"slices"
+
+	"mailcli/internal/config"
+	"mailcli/internal/imap"
+	"mailcli/internal/smtp"
+	"mailcli/internal/tlsconfig"
+
+	"github.com/spf13/cobra"
+)
+
+func newTLSCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tls",
+		Short: "Inspect server certificates",
+	}
+	cmd.AddCommand(newTLSFetchCertCmd())
+	return cmd
+}
+
+func newTLSFetchCertCmd() *cobra.Command {
+	var useSMTP bool
+	var pin bool
+
+	cmd := &cobra.Command{
+		Use:   "fetch-cert",
+		Short: "Show the certificate presented by the IMAP or SMTP server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			section := "imap"
+			host, opts, insecure := cfg.IMAP.Host, cfg.IMAP.TLSOptions, cfg.IMAP.InsecureSkipVerify
+			if useSMTP {
+				section = "smtp"
+				host, opts, insecure = cfg.SMTP.Host, cfg.SMTP.TLSOptions, cfg.SMTP.InsecureSkipVerify
+			}
+			if host == "" {
+				return fmt.Errorf("%s.host is required", section)
+			}
+
+			var certs []*x509.Certificate
+			if useSMTP {
+				certs, err = smtp.PeerCertificates(cmd.Context(), cfg)
+			} else {
+				certs, err = imap.PeerCertificates(cmd.Context(), cfg)
+			}
+			if err != nil {
+				return err
+			}
+			if len(certs) == 0 {
+				return fmt.Errorf("%s server presented no certificate", section)
+			}
+
+			printCertificates(cmd.OutOrStdout(), certs)
+
+			base, err := tlsconfig.New(opts, host, insecure)
+			if err != nil {
+				return err
+			}
+			if err := tlsconfig.Verify(base, certs); err != nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "\nVerification: failed: %v\n", err)
+			} else {
+				fmt.Fprintln(cmd.OutOrStdout(), "\nVerification: ok")
+			}
+
+			if !pin {
+				return nil
+			}
+			fileCfg, err := config.LoadFile()
+			if err != nil {
+				return err
+			}
+			pins := &fileCfg.IMAP.PinSHA256
+			if useSMTP {
+				pins = &fileCfg.SMTP.PinSHA256
+			}
+			leafPin := tlsconfig.Pin(certs[0])
+			if slices.Contains(*pins, leafPin) {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is already pinned for %s\n", leafPin, section)
+				return nil
+			}
+			*pins = append(*pins, leafPin)
+			path, err := config.Save(fileCfg)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Pinned %s for %s in %s\n", leafPin, section, path)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&useSMTP, "smtp", false, "Fetch the SMTP server certificate instead of IMAP")
+	cmd.Flags().BoolVar(&pin, "pin", false, "Add the leaf certificate's public key to pin_sha256 in the config file")
+
+	return cmd
+}
@@ -5,6 +5,14 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/imap"
+	"mailcli/internal/smtp"
+
+	"github.com/spf13/cobra"
 )
 
 func splitList(value string) []string {
@@ -42,3 +50,173 @@ func loadBody(body, bodyFile string) (string, error) {
 	}
 	return string(data), nil
 }
+
+func addDeliveryFlags(cmd *cobra.Command, opts *smtp.Options) {
+	cmd.Flags().StringSliceVar(&opts.Notify, "notify", nil, "Request delivery status notifications: success, failure, delay, or never")
+	cmd.Flags().StringVar(&opts.Return, "ret", "", "How much of the message DSNs return: full or hdrs")
+	cmd.Flags().BoolVar(&opts.Partial, "partial", false, "Send to accepted recipients even if others are rejected")
+}
+
+// reportDelivery prints rejected recipients and DSN notes from an SMTP send.
+// Rejections go to stdout after a partial send, and to stderr when the send
+// failed.
+func reportDelivery(cmd *cobra.Command, result smtp.Result, err error) {
+	out := cmd.OutOrStdout()
+	if err != nil {
+		out = cmd.ErrOrStderr()
+	}
+	for _, rejected := range result.Rejected {
+		fmt.Fprintf(out, "Rejected %s\n", rejected)
+	}
+	if result.DSNIgnored && err == nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), "note: server does not support DSN; --notify and --ret were ignored")
+	}
+}
+
+type bodyFormat struct {
+	format   string
+	markdown bool
+}
+
+func addBodyFormatFlags(cmd *cobra.Command, f *bodyFormat) {
+	cmd.Flags().StringVar(&f.format, "body-format", "text", "Format of --body/--body-file: text or markdown")
+	cmd.Flags().BoolVar(&f.markdown, "markdown", false, "Render the body as Markdown into an HTML alternative (same as --body-format markdown)")
+}
+
+func (f bodyFormat) isMarkdown(bodyHTML string) (bool, error) {
+	var md bool
+	switch strings.ToLower(f.format) {
+	case "", "text", "plain":
+		md = f.markdown
+	case "markdown", "md":
+		md = true
+	default:
+		return false, fmt.Errorf("invalid --body-format %q (use text or markdown)", f.format)
+	}
+	if md && bodyHTML != "" {
+		return false, fmt.Errorf("use either --markdown or --body-html")
+	}
+	return md, nil
+}
+
+// wrapMarkdownHTML places a rendered Markdown fragment (plus any reply quote)
+// in the configured HTML template and stylesheet.
+func wrapMarkdownHTML(cfg config.Config, fragment string) (string, error) {
+	var tmpl, css string
+	if cfg.Markdown.TemplateFile != "" {
+		data, err := os.ReadFile(cfg.Markdown.TemplateFile) //nolint:gosec // path comes from the user's config
+		if err != nil {
+			return "", fmt.Errorf("read markdown template: %w", err)
+		}
+		tmpl = string(data)
+	}
+	if cfg.Markdown.CSSFile != "" {
+		data, err := os.ReadFile(cfg.Markdown.CSSFile) //nolint:gosec // path comes from the user's config
+		if err != nil {
+			return "", fmt.Errorf("read markdown css: %w", err)
+		}
+		css = string(data)
+	}
+	return email.WrapHTML(fragment, tmpl, css)
+}
+
+type previewFlags struct {
+	dryRun    bool
+	outputEML string
+}
+
+func addPreviewFlags(cmd *cobra.Command, f *previewFlags) {
+	cmd.Flags().BoolVar(&f.dryRun, "dry-run", false, "Print the SMTP envelope and message instead of sending")
+	cmd.Flags().StringVar(&f.outputEML, "output-eml", "", "Also save the message exactly as it would be sent to this .eml file")
+}
+
+// pin gives a --dry-run message the Date in MAILCLI_PREVIEW_DATE (RFC 3339)
+// and the Message-ID in MAILCLI_PREVIEW_MESSAGE_ID, so previews can be
+// compared between runs. Messages that are sent are never pinned.
+func (f previewFlags) pin(in *email.ComposeInput) error {
+	if !f.dryRun {
+		return nil
+	}
+	if v := os.Getenv("MAILCLI_PREVIEW_DATE"); v != "" {
+		date, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("invalid MAILCLI_PREVIEW_DATE %q: %w", v, err)
+		}
+		in.Date = date
+	}
+	in.MessageID = os.Getenv("MAILCLI_PREVIEW_MESSAGE_ID")
+	return nil
+}
+
+// preview saves the message for --output-eml and prints it for --dry-run.
+// It reports whether the caller should stop instead of sending.
+func (f previewFlags) preview(cmd *cobra.Command, from string, recipients []string, msg []byte) (bool, error) {
+	if f.outputEML != "" {
+		if err := os.WriteFile(f.outputEML, msg, 0o600); err != nil {
+			return false, fmt.Errorf("write eml: %w", err)
+		}
+	}
+	if !f.dryRun {
+		return false, nil
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "MAIL FROM:<%s>\n", from)
+	for _, rcpt := range recipients {
+		fmt.Fprintf(out, "RCPT TO:<%s>\n", rcpt)
+	}
+	fmt.Fprintln(out)
+	_, err := out.Write(msg)
+	return true, err
+}
+
+// fileSentCopy appends the kept copy of a delivered message to
+// defaults.sent_mailbox, if configured. The message has already gone out, so
+// failures are only reported.
+func fileSentCopy(cmd *cobra.Command, cfg config.Config, record []byte) {
+	mailbox := cfg.Defaults.SentMailbox
+	if mailbox == "" {
+		return
+	}
+	err := config.ValidateIMAP(cfg)
+	if err == nil {
+		err = imap.NewService().SaveSent(cmd.Context(), cfg, mailbox, record)
+	}
+	if err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: message sent, but saving a copy to %s failed: %v\n", mailbox, err)
+	}
+}
+
+// sentFiler is fileSentCopy for commands that send many messages: the
+// copies are filed over one IMAP connection, opened on first use and
+// reopened after a failure.
+type sentFiler struct {
+	cmd     *cobra.Command
+	cfg     config.Config
+	session *imap.Session
+}
+
+func (f *sentFiler) file(record []byte) {
+	mailbox := f.cfg.Defaults.SentMailbox
+	if mailbox == "" {
+		return
+	}
+	err := config.ValidateIMAP(f.cfg)
+	if err == nil && f.session == nil {
+		f.session, err = imap.NewService().Open(f.cmd.Context(), f.cfg)
+	}
+	if err == nil {
+		if err = f.session.SaveSent(mailbox, record); err != nil {
+			f.close()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(f.cmd.ErrOrStderr(), "warning: message sent, but saving a copy to %s failed: %v\n", mailbox, err)
+	}
+}
+
+func (f *sentFiler) close() {
+	if f.session != nil {
+		_ = f.session.Close()
+		f.session = nil
+	}
+}
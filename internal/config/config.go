@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -17,22 +18,60 @@ type Config struct {
 	SMTP           SMTPConfig     `mapstructure:"smtp" yaml:"smtp"`
 	Auth           AuthConfig     `mapstructure:"auth" yaml:"auth"`
 	Defaults       DefaultsConfig `mapstructure:"defaults" yaml:"defaults"`
+	Markdown       MarkdownConfig `mapstructure:"markdown" yaml:"markdown,omitempty"`
+	Identities     []Identity     `mapstructure:"identities" yaml:"identities,omitempty"`
+	PGP            PGPConfig      `mapstructure:"pgp" yaml:"pgp"`
+	SMIME          SMIMEConfig    `mapstructure:"smime" yaml:"smime,omitempty"`
+	DKIM           DKIMConfig     `mapstructure:"dkim" yaml:"dkim,omitempty"`
 }
 
 type IMAPConfig struct {
-	Host               string `mapstructure:"host" yaml:"host"`
-	Port               int    `mapstructure:"port" yaml:"port"`
-	TLS                bool   `mapstructure:"tls" yaml:"tls"`
-	StartTLS           bool   `mapstructure:"starttls" yaml:"starttls"`
-	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	Host               string        `mapstructure:"host" yaml:"host"`
+	Port               int           `mapstructure:"port" yaml:"port"`
+	TLS                bool          `mapstructure:"tls" yaml:"tls"`
+	StartTLS           bool          `mapstructure:"starttls" yaml:"starttls"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	ConnectTimeout     time.Duration `mapstructure:"connect_timeout" yaml:"connect_timeout,omitempty"`
+	CommandTimeout     time.Duration `mapstructure:"command_timeout" yaml:"command_timeout,omitempty"`
+	MaxRetries         int           `mapstructure:"max_retries" yaml:"max_retries"`
+	RetryBackoff       time.Duration `mapstructure:"retry_backoff" yaml:"retry_backoff,omitempty"`
+	TLSOptions         `mapstructure:",squash" yaml:",inline"`
 }
 
 type SMTPConfig struct {
-	Host               string `mapstructure:"host" yaml:"host"`
-	Port               int    `mapstructure:"port" yaml:"port"`
-	TLS                bool   `mapstructure:"tls" yaml:"tls"`
-	StartTLS           bool   `mapstructure:"starttls" yaml:"starttls"`
-	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	Host               string        `mapstructure:"host" yaml:"host"`
+	Port               int           `mapstructure:"port" yaml:"port"`
+	TLS                bool          `mapstructure:"tls" yaml:"tls"`
+	StartTLS           bool          `mapstructure:"starttls" yaml:"starttls"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	ConnectTimeout     time.Duration `mapstructure:"connect_timeout" yaml:"connect_timeout,omitempty"`
+	CommandTimeout     time.Duration `mapstructure:"command_timeout" yaml:"command_timeout,omitempty"`
+	AuthMechanism      string        `mapstructure:"auth_mechanism" yaml:"auth_mechanism,omitempty"`
+	// Username and Password override auth.* when the relay uses separate credentials.
+	Username       string `mapstructure:"username" yaml:"username,omitempty"`
+	Password       string `mapstructure:"password" yaml:"password,omitempty"`
+	PasswordSource string `mapstructure:"-" yaml:"-"`
+	TLSOptions     `mapstructure:",squash" yaml:",inline"`
+}
+
+const (
+	SMTPAuthAuto    = "auto"
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+	SMTPAuthXOAUTH2 = "xoauth2"
+	SMTPAuthNone    = "none"
+)
+
+// TLSOptions holds the certificate settings shared by the IMAP and SMTP
+// sections.
+type TLSOptions struct {
+	CAFile     string   `mapstructure:"ca_file" yaml:"ca_file,omitempty"`
+	ClientCert string   `mapstructure:"client_cert" yaml:"client_cert,omitempty"`
+	ClientKey  string   `mapstructure:"client_key" yaml:"client_key,omitempty"`
+	MinVersion string   `mapstructure:"tls_min_version" yaml:"tls_min_version,omitempty"`
+	ServerName string   `mapstructure:"server_name" yaml:"server_name,omitempty"`
+	PinSHA256  []string `mapstructure:"pin_sha256" yaml:"pin_sha256,omitempty"`
 }
 
 type AuthConfig struct {
@@ -43,23 +82,105 @@ type AuthConfig struct {
 }
 
 type DefaultsConfig struct {
-	DraftsMailbox string `mapstructure:"drafts_mailbox" yaml:"drafts_mailbox"`
+	DraftsMailbox      string `mapstructure:"drafts_mailbox" yaml:"drafts_mailbox"`
+	SentMailbox        string `mapstructure:"sent_mailbox" yaml:"sent_mailbox,omitempty"`
+	Identity           string `mapstructure:"identity" yaml:"identity,omitempty"`
+	SignaturePlacement string `mapstructure:"signature_placement" yaml:"signature_placement,omitempty"`
+}
+
+// MarkdownConfig points at the stylesheet and html/template used to wrap
+// Markdown bodies; empty values use the built-in defaults.
+type MarkdownConfig struct {
+	CSSFile      string `mapstructure:"css_file" yaml:"css_file,omitempty"`
+	TemplateFile string `mapstructure:"template_file" yaml:"template_file,omitempty"`
+}
+
+// PGPConfig locates the OpenPGP keyrings. Empty paths use pubring.asc and
+// secring.asc in PGPDir; SigningKey is a fingerprint, key ID or address and
+// defaults to the sender address.
+type PGPConfig struct {
+	PublicKeyring string `mapstructure:"public_keyring" yaml:"public_keyring,omitempty"`
+	SecretKeyring string `mapstructure:"secret_keyring" yaml:"secret_keyring,omitempty"`
+	SigningKey    string `mapstructure:"signing_key" yaml:"signing_key,omitempty"`
+	EncryptToSelf bool   `mapstructure:"encrypt_to_self" yaml:"encrypt_to_self"`
+}
+
+// KeyringPaths returns the public and secret keyring files.
+func (c PGPConfig) KeyringPaths() (string, string, error) {
+	public, secret := c.PublicKeyring, c.SecretKeyring
+	if public != "" && secret != "" {
+		return public, secret, nil
+	}
+	dir, err := PGPDir()
+	if err != nil {
+		return "", "", err
+	}
+	if public == "" {
+		public = filepath.Join(dir, "pubring.asc")
+	}
+	if secret == "" {
+		secret = filepath.Join(dir, "secring.asc")
+	}
+	return public, secret, nil
+}
+
+// SMIMEConfig holds S/MIME settings. TrustStore is a PEM bundle of CAs for
+// verifying signatures (empty uses the system roots); CertificatesDir holds
+// correspondents' certificates and defaults to SMIMEDir/certs.
+type SMIMEConfig struct {
+	TrustStore      string `mapstructure:"trust_store" yaml:"trust_store,omitempty"`
+	CertificatesDir string `mapstructure:"certificates_dir" yaml:"certificates_dir,omitempty"`
+}
+
+// CertsDir returns the directory of correspondents' certificates.
+func (c SMIMEConfig) CertsDir() (string, error) {
+	if c.CertificatesDir != "" {
+		return c.CertificatesDir, nil
+	}
+	dir, err := SMIMEDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "certs"), nil
+}
+
+// DKIMConfig enables DKIM signing of outgoing mail when both Domain and
+// Selector are set. The private key is kept in the keyring.
+type DKIMConfig struct {
+	Domain   string `mapstructure:"domain" yaml:"domain,omitempty"`
+	Selector string `mapstructure:"selector" yaml:"selector,omitempty"`
+}
+
+// Enabled reports whether outgoing mail should be signed.
+func (c DKIMConfig) Enabled() bool {
+	return c.Domain != "" && c.Selector != ""
 }
 
 func DefaultConfig() Config {
 	return Config{
 		IMAP: IMAPConfig{
-			Port:     993,
-			TLS:      true,
-			StartTLS: false,
+			Port:           993,
+			TLS:            true,
+			StartTLS:       false,
+			ConnectTimeout: 30 * time.Second,
+			CommandTimeout: 5 * time.Minute,
+			MaxRetries:     2,
+			RetryBackoff:   500 * time.Millisecond,
 		},
 		SMTP: SMTPConfig{
-			Port:     587,
-			TLS:      false,
-			StartTLS: true,
+			Port:           587,
+			TLS:            false,
+			StartTLS:       true,
+			ConnectTimeout: 30 * time.Second,
+			CommandTimeout: 5 * time.Minute,
+			AuthMechanism:  SMTPAuthAuto,
 		},
 		Defaults: DefaultsConfig{
-			DraftsMailbox: "Drafts",
+			DraftsMailbox:      "Drafts",
+			SignaturePlacement: SignatureAbove,
+		},
+		PGP: PGPConfig{
+			EncryptToSelf: true,
 		},
 	}
 }
@@ -153,6 +274,9 @@ func Redact(cfg Config) Config {
 	if masked.Auth.Password != "" {
 		masked.Auth.Password = "****"
 	}
+	if masked.SMTP.Password != "" {
+		masked.SMTP.Password = "****"
+	}
 	return masked
 }
 
@@ -161,13 +285,48 @@ func setDefaults(v *viper.Viper, cfg Config) {
 	v.SetDefault("imap.tls", cfg.IMAP.TLS)
 	v.SetDefault("imap.starttls", cfg.IMAP.StartTLS)
 	v.SetDefault("imap.insecure_skip_verify", cfg.IMAP.InsecureSkipVerify)
+	v.SetDefault("imap.ca_file", cfg.IMAP.CAFile)
+	v.SetDefault("imap.client_cert", cfg.IMAP.ClientCert)
+	v.SetDefault("imap.client_key", cfg.IMAP.ClientKey)
+	v.SetDefault("imap.tls_min_version", cfg.IMAP.MinVersion)
+	v.SetDefault("imap.server_name", cfg.IMAP.ServerName)
+	v.SetDefault("imap.pin_sha256", cfg.IMAP.PinSHA256)
+	v.SetDefault("imap.connect_timeout", cfg.IMAP.ConnectTimeout)
+	v.SetDefault("imap.command_timeout", cfg.IMAP.CommandTimeout)
+	v.SetDefault("imap.max_retries", cfg.IMAP.MaxRetries)
+	v.SetDefault("imap.retry_backoff", cfg.IMAP.RetryBackoff)
 
 	v.SetDefault("smtp.port", cfg.SMTP.Port)
 	v.SetDefault("smtp.tls", cfg.SMTP.TLS)
 	v.SetDefault("smtp.starttls", cfg.SMTP.StartTLS)
 	v.SetDefault("smtp.insecure_skip_verify", cfg.SMTP.InsecureSkipVerify)
+	v.SetDefault("smtp.ca_file", cfg.SMTP.CAFile)
+	v.SetDefault("smtp.client_cert", cfg.SMTP.ClientCert)
+	v.SetDefault("smtp.client_key", cfg.SMTP.ClientKey)
+	v.SetDefault("smtp.tls_min_version", cfg.SMTP.MinVersion)
+	v.SetDefault("smtp.server_name", cfg.SMTP.ServerName)
+	v.SetDefault("smtp.pin_sha256", cfg.SMTP.PinSHA256)
+	v.SetDefault("smtp.connect_timeout", cfg.SMTP.ConnectTimeout)
+	v.SetDefault("smtp.command_timeout", cfg.SMTP.CommandTimeout)
+	v.SetDefault("smtp.auth_mechanism", cfg.SMTP.AuthMechanism)
+	v.SetDefault("smtp.username", cfg.SMTP.Username)
+	v.SetDefault("smtp.password", cfg.SMTP.Password)
 
 	v.SetDefault("defaults.drafts_mailbox", cfg.Defaults.DraftsMailbox)
+	v.SetDefault("defaults.sent_mailbox", cfg.Defaults.SentMailbox)
+	v.SetDefault("defaults.identity", cfg.Defaults.Identity)
+	v.SetDefault("defaults.signature_placement", cfg.Defaults.SignaturePlacement)
+
+	v.SetDefault("markdown.css_file", cfg.Markdown.CSSFile)
+	v.SetDefault("markdown.template_file", cfg.Markdown.TemplateFile)
+	v.SetDefault("pgp.public_keyring", cfg.PGP.PublicKeyring)
+	v.SetDefault("pgp.secret_keyring", cfg.PGP.SecretKeyring)
+	v.SetDefault("pgp.signing_key", cfg.PGP.SigningKey)
+	v.SetDefault("pgp.encrypt_to_self", cfg.PGP.EncryptToSelf)
+	v.SetDefault("smime.trust_store", cfg.SMIME.TrustStore)
+	v.SetDefault("smime.certificates_dir", cfg.SMIME.CertificatesDir)
+	v.SetDefault("dkim.domain", cfg.DKIM.Domain)
+	v.SetDefault("dkim.selector", cfg.DKIM.Selector)
 }
 
 func Validate(cfg Config) error {
@@ -197,11 +356,37 @@ func ValidateSMTP(cfg Config) error {
 	if cfg.SMTP.Host == "" {
 		return fmt.Errorf("smtp.host is required")
 	}
-	if cfg.Auth.Username == "" {
+	if (cfg.DKIM.Domain == "") != (cfg.DKIM.Selector == "") {
+		return fmt.Errorf("dkim.domain and dkim.selector must be set together")
+	}
+	switch strings.ToLower(cfg.SMTP.AuthMechanism) {
+	case "", SMTPAuthAuto, SMTPAuthPlain, SMTPAuthLogin, SMTPAuthCRAMMD5, SMTPAuthXOAUTH2:
+	case SMTPAuthNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid smtp.auth_mechanism %q (expected auto, plain, login, cram-md5, xoauth2, or none)", cfg.SMTP.AuthMechanism)
+	}
+	username, password := cfg.SMTPCredentials()
+	if username == "" {
 		return fmt.Errorf("auth.username is required")
 	}
-	if cfg.Auth.Password == "" {
+	if password == "" {
+		if cfg.SMTP.Username != "" {
+			return fmt.Errorf("smtp.password is required for smtp.username %s", cfg.SMTP.Username)
+		}
 		return fmt.Errorf("auth.password is required")
 	}
 	return nil
 }
+
+// SMTPCredentials returns the SMTP login, falling back to auth.* unless a
+// separate smtp.username is configured.
+func (c Config) SMTPCredentials() (username, password string) {
+	if c.SMTP.Username == "" || c.SMTP.Username == c.Auth.Username {
+		if c.SMTP.Password != "" {
+			return c.Auth.Username, c.SMTP.Password
+		}
+		return c.Auth.Username, c.Auth.Password
+	}
+	return c.SMTP.Username, c.SMTP.Password
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestLoadConfigWithEnvOverride(t *testing.T) {
@@ -32,3 +33,55 @@ func TestLoadConfigWithEnvOverride(t *testing.T) {
 		t.Fatalf("expected smtp host from file, got %q", loaded.SMTP.Host)
 	}
 }
+
+func TestTimeoutsRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	cfg := DefaultConfig()
+	cfg.IMAP.CommandTimeout = 90 * time.Second
+	if _, err := Save(cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	t.Setenv("MAILCLI_SMTP_CONNECT_TIMEOUT", "5s")
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if loaded.IMAP.CommandTimeout != 90*time.Second {
+		t.Fatalf("expected imap command timeout from file, got %s", loaded.IMAP.CommandTimeout)
+	}
+	if loaded.IMAP.ConnectTimeout != 30*time.Second {
+		t.Fatalf("expected default imap connect timeout, got %s", loaded.IMAP.ConnectTimeout)
+	}
+	if loaded.SMTP.ConnectTimeout != 5*time.Second {
+		t.Fatalf("expected smtp connect timeout from env, got %s", loaded.SMTP.ConnectTimeout)
+	}
+}
+
+func TestTLSOptionsRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	cfg := DefaultConfig()
+	cfg.IMAP.CAFile = "/etc/mailcli/ca.pem"
+	cfg.IMAP.PinSHA256 = []string{"sha256/one", "sha256/two"}
+	if _, err := Save(cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	t.Setenv("MAILCLI_SMTP_SERVER_NAME", "relay.internal")
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if loaded.IMAP.CAFile != "/etc/mailcli/ca.pem" || len(loaded.IMAP.PinSHA256) != 2 {
+		t.Fatalf("expected imap tls options from file, got %+v", loaded.IMAP.TLSOptions)
+	}
+	if loaded.SMTP.ServerName != "relay.internal" {
+		t.Fatalf("expected smtp server name from env, got %q", loaded.SMTP.ServerName)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	SignatureAbove = "above"
+	SignatureBelow = "below"
+)
+
+// Identity is a sender persona: the From address (and aliases that also
+// reach it), optional Reply-To, signature files and Bcc-self.
+type Identity struct {
+	Name              string   `mapstructure:"name" yaml:"name"`
+	DisplayName       string   `mapstructure:"display_name" yaml:"display_name,omitempty"`
+	Address           string   `mapstructure:"address" yaml:"address"`
+	Aliases           []string `mapstructure:"aliases" yaml:"aliases,omitempty"`
+	ReplyTo           string   `mapstructure:"reply_to" yaml:"reply_to,omitempty"`
+	SignatureFile     string   `mapstructure:"signature_file" yaml:"signature_file,omitempty"`
+	SignatureHTMLFile string   `mapstructure:"signature_html_file" yaml:"signature_html_file,omitempty"`
+	BccSelf           bool     `mapstructure:"bcc_self" yaml:"bcc_self,omitempty"`
+}
+
+// Matches reports whether address is the identity's address or one of its
+// aliases.
+func (id Identity) Matches(address string) bool {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return false
+	}
+	if strings.EqualFold(id.Address, address) {
+		return true
+	}
+	for _, alias := range id.Aliases {
+		if strings.EqualFold(strings.TrimSpace(alias), address) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) FindIdentity(name string) (Identity, bool) {
+	for _, id := range c.Identities {
+		if strings.EqualFold(id.Name, name) {
+			return id, true
+		}
+	}
+	return Identity{}, false
+}
+
+func (c Config) IdentityForAddress(address string) (Identity, bool) {
+	for _, id := range c.Identities {
+		if id.Matches(address) {
+			return id, true
+		}
+	}
+	return Identity{}, false
+}
+
+// DefaultIdentity returns defaults.identity, else the identity for
+// auth.username, else a bare identity sending as auth.username.
+func (c Config) DefaultIdentity() Identity {
+	if c.Defaults.Identity != "" {
+		if id, ok := c.FindIdentity(c.Defaults.Identity); ok {
+			return id
+		}
+	}
+	if id, ok := c.IdentityForAddress(c.Auth.Username); ok {
+		return id
+	}
+	return Identity{Address: c.Auth.Username}
+}
+
+func ValidateIdentities(cfg Config) error {
+	seen := map[string]bool{}
+	for i, id := range cfg.Identities {
+		if strings.TrimSpace(id.Name) == "" {
+			return fmt.Errorf("identities[%d].name is required", i)
+		}
+		key := strings.ToLower(id.Name)
+		if seen[key] {
+			return fmt.Errorf("duplicate identity %q", id.Name)
+		}
+		seen[key] = true
+		if strings.TrimSpace(id.Address) == "" {
+			return fmt.Errorf("identity %q: address is required", id.Name)
+		}
+	}
+	if cfg.Defaults.Identity != "" {
+		if _, ok := cfg.FindIdentity(cfg.Defaults.Identity); !ok {
+			return fmt.Errorf("defaults.identity %q is not a configured identity", cfg.Defaults.Identity)
+		}
+	}
+	switch strings.ToLower(cfg.Defaults.SignaturePlacement) {
+	case "", SignatureAbove, SignatureBelow:
+	default:
+		return fmt.Errorf("invalid defaults.signature_placement %q (expected above or below)", cfg.Defaults.SignaturePlacement)
+	}
+	return nil
+}
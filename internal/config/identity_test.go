@@ -0,0 +1,57 @@
+package config
+
+import "testing"
+
+func TestIdentitiesRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	cfg := DefaultConfig()
+	cfg.Auth.Username = "me@example.com"
+	cfg.Identities = []Identity{
+		{Name: "work", DisplayName: "Me at Work", Address: "me@work.example", Aliases: []string{"team@work.example"}, BccSelf: true},
+		{Name: "home", Address: "me@example.com", SignatureFile: "/tmp/sig.txt"},
+	}
+	if _, err := Save(cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if err := ValidateIdentities(loaded); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if len(loaded.Identities) != 2 || !loaded.Identities[0].BccSelf || loaded.Identities[1].SignatureFile != "/tmp/sig.txt" {
+		t.Fatalf("unexpected identities %+v", loaded.Identities)
+	}
+	if id, ok := loaded.IdentityForAddress("TEAM@work.example"); !ok || id.Name != "work" {
+		t.Fatalf("expected alias to match work identity, got %+v %v", id, ok)
+	}
+	if id := loaded.DefaultIdentity(); id.Name != "home" {
+		t.Fatalf("expected identity for auth.username by default, got %+v", id)
+	}
+
+	loaded.Defaults.Identity = "work"
+	if id := loaded.DefaultIdentity(); id.Name != "work" {
+		t.Fatalf("expected defaults.identity, got %+v", id)
+	}
+}
+
+func TestValidateIdentities(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Identities = []Identity{{Name: "a", Address: "a@example.com"}, {Name: "A", Address: "b@example.com"}}
+	if err := ValidateIdentities(cfg); err == nil {
+		t.Fatal("expected duplicate identity error")
+	}
+	cfg.Identities = []Identity{{Name: "a"}}
+	if err := ValidateIdentities(cfg); err == nil {
+		t.Fatal("expected missing address error")
+	}
+	cfg.Identities = nil
+	cfg.Defaults.SignaturePlacement = "sideways"
+	if err := ValidateIdentities(cfg); err == nil {
+		t.Fatal("expected placement error")
+	}
+}
@@ -52,3 +52,43 @@ func EnsureKeyringDir() (string, error) {
 
 	return dir, nil
 }
+
+// OutboxDir holds messages queued for later delivery.
+func OutboxDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "outbox"), nil
+}
+
+// TemplatesDir holds message templates referenced by name.
+func TemplatesDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "templates"), nil
+}
+
+// PGPDir holds the default OpenPGP keyring files.
+func PGPDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "pgp"), nil
+}
+
+// SMIMEDir holds S/MIME certificates.
+func SMIMEDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "smime"), nil
+}
@@ -0,0 +1,131 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"mailcli/internal/email"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+)
+
+// Key algorithms accepted by GenerateKey.
+const (
+	AlgorithmRSA     = "rsa"
+	AlgorithmEd25519 = "ed25519"
+)
+
+// signedHeaders follows the recommendation of RFC 6376 section 5.4.1. Fields
+// a message lacks are still listed so they cannot be added in transit.
+var signedHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type",
+	"Content-Transfer-Encoding",
+}
+
+// Signer adds a DKIM-Signature header for Domain and Selector.
+type Signer struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer
+}
+
+// Sign returns raw with a relaxed/relaxed DKIM-Signature prepended. raw must
+// be the exact bytes that will be transmitted.
+func (s *Signer) Sign(raw []byte) ([]byte, error) {
+	var out bytes.Buffer
+	err := msgauth.Sign(&out, bytes.NewReader(email.CanonicalLineEndings(raw)), &msgauth.SignOptions{
+		Domain:                 s.Domain,
+		Selector:               s.Selector,
+		Signer:                 s.Key,
+		Hash:                   crypto.SHA256,
+		HeaderCanonicalization: msgauth.CanonicalizationRelaxed,
+		BodyCanonicalization:   msgauth.CanonicalizationRelaxed,
+		HeaderKeys:             signedHeaders,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dkim sign: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// ParseKey reads a PEM private key: PKCS#8 RSA or Ed25519, or PKCS#1 RSA.
+func ParseKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 1024 {
+			return nil, fmt.Errorf("RSA key of %d bits is too short for DKIM", k.N.BitLen())
+		}
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("DKIM does not support %T keys", key)
+}
+
+// GenerateKey creates a 2048-bit RSA or an Ed25519 key.
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+	switch strings.ToLower(algorithm) {
+	case AlgorithmRSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unknown key algorithm %q (expected rsa or ed25519)", algorithm)
+}
+
+// EncodeKey returns the key as a PKCS#8 PEM block.
+func EncodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encode private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Record returns the TXT record to publish at <selector>._domainkey.<domain>.
+func Record(key crypto.Signer) (string, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub), nil
+	}
+	return "", fmt.Errorf("DKIM does not support %T keys", key)
+}
+
+// RecordName is the DNS name the public key is published under.
+func RecordName(selector, domain string) string {
+	return selector + "._domainkey." + domain
+}
@@ -0,0 +1,103 @@
+package dkim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+)
+
+const testMessage = "From: Alice <alice@example.com>\n" +
+	"To: bob@example.com\n" +
+	"Subject: release\n" +
+	"Date: Mon, 19 Oct 2026 09:00:00 +0000\n" +
+	"Message-ID: <1@example.com>\n" +
+	"MIME-Version: 1.0\n" +
+	"Content-Type: text/plain; charset=\"utf-8\"\n" +
+	"\n" +
+	"v1.2 is out.\n"
+
+func verify(t *testing.T, signed []byte, record string) *msgauth.Verification {
+	t.Helper()
+	verifications, err := msgauth.VerifyWithOptions(bytes.NewReader(signed), &msgauth.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "mail._domainkey.example.com" {
+				t.Fatalf("unexpected lookup %s", domain)
+			}
+			return []string{record}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(verifications) != 1 {
+		t.Fatalf("expected one signature, got %d", len(verifications))
+	}
+	return verifications[0]
+}
+
+func TestSignVerifies(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRSA, AlgorithmEd25519} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateKey(algorithm)
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			record, err := Record(key)
+			if err != nil {
+				t.Fatalf("record: %v", err)
+			}
+			signer := &Signer{Domain: "example.com", Selector: "mail", Key: key}
+			signed, err := signer.Sign([]byte(testMessage))
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			header := string(signed[:bytes.Index(signed, []byte("\r\n\r\n"))])
+			if !strings.HasPrefix(header, "DKIM-Signature:") || !strings.Contains(header, "c=relaxed/relaxed") || !strings.Contains(header, "a="+algorithm+"-sha256") {
+				t.Fatalf("unexpected signature header:\n%s", header)
+			}
+
+			if v := verify(t, signed, record); v.Err != nil || v.Domain != "example.com" {
+				t.Fatalf("expected valid signature, got %+v", v)
+			}
+
+			// Relaxed canonicalization tolerates whitespace changes in transit.
+			rewrapped := bytes.Replace(signed, []byte("Subject: release"), []byte("Subject:   release "), 1)
+			if v := verify(t, rewrapped, record); v.Err != nil {
+				t.Fatalf("expected relaxed match, got %v", v.Err)
+			}
+
+			tampered := bytes.Replace(signed, []byte("v1.2 is out."), []byte("v1.3 is out."), 1)
+			if v := verify(t, tampered, record); v.Err == nil {
+				t.Fatal("expected tampered body to fail")
+			}
+		})
+	}
+}
+
+func TestParseKeyRoundTrip(t *testing.T) {
+	key, err := GenerateKey(AlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	data, err := EncodeKey(key)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	parsed, err := ParseKey(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want, _ := Record(key)
+	if got, _ := Record(parsed); got != want {
+		t.Fatalf("record mismatch: %s != %s", got, want)
+	}
+
+	if _, err := ParseKey([]byte("not a key")); err == nil {
+		t.Fatal("expected error for non-PEM input")
+	}
+	if _, err := GenerateKey("dsa"); err == nil {
+		t.Fatal("expected error for unknown algorithm")
+	}
+}
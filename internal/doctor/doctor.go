@@ -0,0 +1,538 @@
+package doctor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/secrets"
+	mailsmtp "mailcli/internal/smtp"
+	"mailcli/internal/tlsconfig"
+
+	"github.com/emersion/go-imap"
+	imapclient "github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusWarn Status = "WARN"
+	StatusFail Status = "FAIL"
+)
+
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+	Hint   string
+}
+
+type Report struct {
+	Checks []Check
+}
+
+func (r Report) Failures() int {
+	count := 0
+	for _, check := range r.Checks {
+		if check.Status == StatusFail {
+			count++
+		}
+	}
+	return count
+}
+
+type Options struct {
+	// Timeout bounds each network connection, including all commands sent on it.
+	Timeout time.Duration
+	// LookupHost resolves a host name; defaults to net.LookupHost.
+	LookupHost func(host string) ([]string, error)
+	// Keyring checks keyring access for a username; defaults to reading the stored password.
+	Keyring func(username string) error
+	// Now is used for certificate expiry checks; defaults to time.Now.
+	Now func() time.Time
+}
+
+const certExpiryWarning = 14 * 24 * time.Hour
+
+func Run(cfg config.Config, opts Options) Report {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.LookupHost == nil {
+		opts.LookupHost = net.LookupHost
+	}
+	if opts.Keyring == nil {
+		opts.Keyring = checkKeyring
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	r := &runner{cfg: cfg, opts: opts}
+	r.checkKeyring()
+	r.checkIMAP()
+	r.checkSMTP()
+	return Report{Checks: r.checks}
+}
+
+type runner struct {
+	cfg    config.Config
+	opts   Options
+	checks []Check
+}
+
+func (r *runner) pass(name, detail string) {
+	r.checks = append(r.checks, Check{Name: name, Status: StatusPass, Detail: detail})
+}
+
+func (r *runner) warn(name, detail, hint string) {
+	r.checks = append(r.checks, Check{Name: name, Status: StatusWarn, Detail: detail, Hint: hint})
+}
+
+func (r *runner) fail(name, detail, hint string) {
+	r.checks = append(r.checks, Check{Name: name, Status: StatusFail, Detail: detail, Hint: hint})
+}
+
+func checkKeyring(username string) error {
+	_, err := secrets.GetPassword(username)
+	return err
+}
+
+func (r *runner) checkKeyring() {
+	const name = "keyring"
+	if r.cfg.Auth.Username == "" {
+		r.fail(name, "auth.username is not set", "run `mailcli auth login --username you@example.com --password ...`")
+		return
+	}
+	err := r.opts.Keyring(r.cfg.Auth.Username)
+	switch {
+	case err == nil:
+		r.pass(name, "password found in keyring")
+	case errors.Is(err, secrets.ErrSecretNotFound):
+		if r.cfg.Auth.Password != "" {
+			r.pass(name, fmt.Sprintf("keyring accessible; password supplied via %s", passwordSource(r.cfg)))
+			return
+		}
+		r.fail(name, "no password stored for "+r.cfg.Auth.Username, "run `mailcli auth login --password ...` to store it")
+	default:
+		hint := "check `mailcli auth keyring`; on headless systems set MAILCLI_KEYRING_BACKEND=file and MAILCLI_KEYRING_PASSWORD"
+		if r.cfg.Auth.Password != "" {
+			r.warn(name, err.Error(), hint)
+			return
+		}
+		r.fail(name, err.Error(), hint)
+	}
+}
+
+func passwordSource(cfg config.Config) string {
+	if cfg.Auth.PasswordSource == "" {
+		return "config"
+	}
+	return cfg.Auth.PasswordSource
+}
+
+func (r *runner) checkIMAP() {
+	host := r.cfg.IMAP.Host
+	if host == "" {
+		r.fail("imap config", "imap.host is not set", "run `mailcli auth login --imap-host ...` or `mailcli config edit`")
+		return
+	}
+
+	base, err := tlsconfig.New(r.cfg.IMAP.TLSOptions, host, r.cfg.IMAP.InsecureSkipVerify)
+	if err != nil {
+		r.fail("imap tls", err.Error(), "check imap.ca_file, client_cert, client_key, tls_min_version and pin_sha256")
+		return
+	}
+
+	conn, ok := r.dial("imap", host, r.cfg.IMAP.Port, "993 (TLS) or 143 (STARTTLS)")
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	var state *tls.ConnectionState
+	if r.cfg.IMAP.TLS {
+		tlsConn, cs, ok := r.handshake("imap", conn, base, r.cfg.IMAP.InsecureSkipVerify,
+			"if this port expects STARTTLS, set imap.tls=false and imap.starttls=true")
+		if !ok {
+			return
+		}
+		conn = tlsConn
+		state = cs
+	}
+
+	c, err := imapclient.New(conn)
+	if err != nil {
+		r.fail("imap greeting", err.Error(), "the server did not send an IMAP greeting; verify imap.port and imap.tls")
+		return
+	}
+	r.pass("imap greeting", "server greeting received")
+
+	if !r.cfg.IMAP.TLS {
+		supported, err := c.SupportStartTLS()
+		if err != nil {
+			r.fail("imap starttls", err.Error(), "")
+			return
+		}
+		switch {
+		case r.cfg.IMAP.StartTLS && !supported:
+			r.fail("imap starttls", "server does not advertise STARTTLS",
+				"use imap.tls=true on port 993, or disable imap.starttls if the connection is trusted")
+			return
+		case r.cfg.IMAP.StartTLS:
+			tlsConfig, cs := tlsconfig.Capture(base)
+			if err := c.StartTLS(tlsConfig); err != nil {
+				r.fail("imap starttls", err.Error(), "the STARTTLS handshake failed; check the server TLS configuration")
+				return
+			}
+			state = cs
+			r.pass("imap starttls", "STARTTLS negotiated")
+		case supported:
+			r.warn("imap starttls", "server offers STARTTLS but it is disabled", "set imap.starttls=true to encrypt the connection")
+		default:
+			r.warn("imap starttls", "connection is not encrypted", "enable imap.tls or imap.starttls if the server supports it")
+		}
+		if state != nil && !r.checkCertificate("imap", *state, base, r.cfg.IMAP.InsecureSkipVerify) {
+			return
+		}
+	}
+
+	caps, err := c.Capability()
+	if err != nil {
+		r.fail("imap capability", err.Error(), "")
+		return
+	}
+	r.pass("imap capability", strings.Join(sortedCapabilities(caps), " "))
+
+	if r.cfg.Auth.Password == "" {
+		r.fail("imap login", "no password available", "run `mailcli auth login --password ...` or set MAILCLI_AUTH_PASSWORD")
+		return
+	}
+	if err := c.Login(r.cfg.Auth.Username, r.cfg.Auth.Password); err != nil {
+		r.fail("imap login", err.Error(), "verify auth.username and the password; many providers require an app password for IMAP")
+		return
+	}
+	r.pass("imap login", "authenticated as "+r.cfg.Auth.Username)
+	defer func() {
+		_ = c.Logout()
+	}()
+
+	r.checkMailboxes(c)
+}
+
+func (r *runner) checkMailboxes(c *imapclient.Client) {
+	ch := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", ch)
+	}()
+	infos := []*imap.MailboxInfo{}
+	for info := range ch {
+		infos = append(infos, info)
+	}
+	if err := <-done; err != nil {
+		r.fail("imap mailboxes", err.Error(), "")
+		return
+	}
+
+	drafts := r.cfg.Defaults.DraftsMailbox
+	if drafts == "" {
+		drafts = "Drafts"
+	}
+	if name, ok := findMailbox(infos, drafts, "\\Drafts"); ok {
+		r.pass("drafts mailbox", name)
+	} else {
+		r.fail("drafts mailbox", fmt.Sprintf("mailbox %q not found", drafts),
+			fmt.Sprintf("create it with `mailcli mailboxes create %q` or set defaults.drafts_mailbox", drafts))
+	}
+
+	if name, ok := findMailbox(infos, "Sent", "\\Sent"); ok {
+		r.pass("sent mailbox", name)
+	} else {
+		r.warn("sent mailbox", "no Sent mailbox found", "create it with `mailcli mailboxes create Sent`")
+	}
+}
+
+func findMailbox(infos []*imap.MailboxInfo, name, specialUse string) (string, bool) {
+	for _, info := range infos {
+		if strings.EqualFold(info.Name, name) {
+			return info.Name, true
+		}
+	}
+	for _, info := range infos {
+		for _, attr := range info.Attributes {
+			if strings.EqualFold(attr, specialUse) {
+				return info.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (r *runner) checkSMTP() {
+	host := r.cfg.SMTP.Host
+	if host == "" {
+		r.fail("smtp config", "smtp.host is not set", "run `mailcli auth login --smtp-host ...` or `mailcli config edit`")
+		return
+	}
+
+	base, err := tlsconfig.New(r.cfg.SMTP.TLSOptions, host, r.cfg.SMTP.InsecureSkipVerify)
+	if err != nil {
+		r.fail("smtp tls", err.Error(), "check smtp.ca_file, client_cert, client_key, tls_min_version and pin_sha256")
+		return
+	}
+
+	conn, ok := r.dial("smtp", host, r.cfg.SMTP.Port, "465 (TLS) or 587 (STARTTLS)")
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	var state *tls.ConnectionState
+	if r.cfg.SMTP.TLS {
+		tlsConn, cs, ok := r.handshake("smtp", conn, base, r.cfg.SMTP.InsecureSkipVerify,
+			"if this port expects STARTTLS (usually 587), set smtp.tls=false and smtp.starttls=true")
+		if !ok {
+			return
+		}
+		conn = tlsConn
+		state = cs
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		r.fail("smtp greeting", err.Error(), "the server did not send an SMTP greeting; verify smtp.port and smtp.tls")
+		return
+	}
+	r.pass("smtp greeting", "server greeting received")
+
+	if err := c.Hello("localhost"); err != nil {
+		r.fail("smtp ehlo", err.Error(), "")
+		return
+	}
+
+	if !r.cfg.SMTP.TLS {
+		supported, _ := c.Extension("STARTTLS")
+		switch {
+		case r.cfg.SMTP.StartTLS && !supported:
+			r.fail("smtp starttls", "server does not advertise STARTTLS",
+				"use smtp.tls=true on port 465, or disable smtp.starttls if the relay is trusted")
+			return
+		case r.cfg.SMTP.StartTLS:
+			tlsConfig, cs := tlsconfig.Capture(base)
+			if err := c.StartTLS(tlsConfig); err != nil {
+				r.fail("smtp starttls", err.Error(), "the STARTTLS handshake failed; check the server TLS configuration")
+				return
+			}
+			state = cs
+			r.pass("smtp starttls", "STARTTLS negotiated")
+		case supported:
+			r.warn("smtp starttls", "server offers STARTTLS but it is disabled", "set smtp.starttls=true to encrypt the connection")
+		default:
+			r.warn("smtp starttls", "connection is not encrypted", "enable smtp.tls or smtp.starttls if the server supports it")
+		}
+		if state != nil && !r.checkCertificate("smtp", *state, base, r.cfg.SMTP.InsecureSkipVerify) {
+			return
+		}
+	}
+
+	r.pass("smtp extensions", strings.Join(smtpExtensions(c), " "))
+
+	if strings.EqualFold(r.cfg.SMTP.AuthMechanism, config.SMTPAuthNone) {
+		r.pass("smtp login", "authentication disabled (smtp.auth_mechanism: none)")
+		_ = c.Quit()
+		return
+	}
+	username, password := r.cfg.SMTPCredentials()
+	if password == "" {
+		r.fail("smtp login", "no password available", "run `mailcli auth login --password ...` or set MAILCLI_AUTH_PASSWORD")
+		return
+	}
+	_, mechanisms := c.Extension("AUTH")
+	_, encrypted := c.TLSConnectionState()
+	client, err := mailsmtp.NewSASLClient(r.cfg, mechanisms, encrypted)
+	if err != nil {
+		r.fail("smtp login", err.Error(), "the server may require STARTTLS before offering authentication")
+		return
+	}
+	if err := mailsmtp.CheckTransport(client, encrypted, host); err != nil {
+		r.fail("smtp login", err.Error(), "enable smtp.tls or smtp.starttls")
+		return
+	}
+	if err := c.Auth(saslAuth{client}); err != nil {
+		r.fail("smtp login", err.Error(), "verify the SMTP username and password; many providers require an app password for SMTP")
+		return
+	}
+	r.pass("smtp login", "authenticated as "+username)
+	_ = c.Quit()
+}
+
+// saslAuth adapts a SASL client to net/smtp, which only offers PLAIN and
+// CRAM-MD5 itself.
+type saslAuth struct {
+	client sasl.Client
+}
+
+func (a saslAuth) Start(*smtp.ServerInfo) (string, []byte, error) {
+	return a.client.Start()
+}
+
+func (a saslAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	return a.client.Next(fromServer)
+}
+
+var knownSMTPExtensions = []string{
+	"STARTTLS", "AUTH", "SIZE", "8BITMIME", "SMTPUTF8", "PIPELINING",
+	"DSN", "ENHANCEDSTATUSCODES", "CHUNKING", "BINARYMIME", "REQUIRETLS",
+}
+
+func smtpExtensions(c *smtp.Client) []string {
+	exts := []string{}
+	for _, name := range knownSMTPExtensions {
+		ok, param := c.Extension(name)
+		if !ok {
+			continue
+		}
+		if param != "" {
+			exts = append(exts, name+"="+strings.ReplaceAll(param, " ", ","))
+		} else {
+			exts = append(exts, name)
+		}
+	}
+	return exts
+}
+
+func (r *runner) dial(proto, host string, port int, portHint string) (net.Conn, bool) {
+	addrs, err := r.opts.LookupHost(host)
+	if err != nil || len(addrs) == 0 {
+		detail := "no addresses returned"
+		if err != nil {
+			detail = err.Error()
+		}
+		r.fail(proto+" dns", detail, fmt.Sprintf("check %s.host for typos and that your DNS resolver works", proto))
+		return nil, false
+	}
+	r.pass(proto+" dns", fmt.Sprintf("%s -> %s", host, strings.Join(addrs, ", ")))
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, r.opts.Timeout)
+	if err != nil {
+		r.fail(proto+" tcp", err.Error(),
+			fmt.Sprintf("verify %s.port (usually %s) and that no firewall blocks outbound connections", proto, portHint))
+		return nil, false
+	}
+	_ = conn.SetDeadline(time.Now().Add(r.opts.Timeout))
+	r.pass(proto+" tcp", "connected to "+addr)
+	return conn, true
+}
+
+func (r *runner) handshake(proto string, conn net.Conn, base *tls.Config, insecure bool, hint string) (net.Conn, *tls.ConnectionState, bool) {
+	// The chain is captured rather than rejected so checkCertificate can
+	// report precisely what is wrong.
+	tlsConfig, state := tlsconfig.Capture(base)
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		r.fail(proto+" tls", err.Error(), hint)
+		return nil, nil, false
+	}
+	r.pass(proto+" tls", tls.VersionName(state.Version)+" handshake completed")
+	if !r.checkCertificate(proto, *state, base, insecure) {
+		return nil, nil, false
+	}
+	return tlsConn, state, true
+}
+
+func (r *runner) checkCertificate(proto string, state tls.ConnectionState, base *tls.Config, insecure bool) bool {
+	host := base.ServerName
+	name := proto + " certificate"
+	if len(state.PeerCertificates) == 0 {
+		r.fail(name, "server presented no certificate", "")
+		return false
+	}
+	leaf := state.PeerCertificates[0]
+	now := r.opts.Now()
+	problems := []string{}
+	hints := []string{}
+
+	if now.After(leaf.NotAfter) {
+		problems = append(problems, "expired on "+leaf.NotAfter.Format(time.RFC3339))
+		hints = append(hints, "ask the server operator to renew the certificate")
+	} else if now.Before(leaf.NotBefore) {
+		problems = append(problems, "not valid until "+leaf.NotBefore.Format(time.RFC3339))
+		hints = append(hints, "check the system clock")
+	}
+	if err := leaf.VerifyHostname(host); err != nil {
+		problems = append(problems, fmt.Sprintf("does not match %s (valid for %s)", host, strings.Join(certNames(leaf), ", ")))
+		hints = append(hints, fmt.Sprintf("set %s.host or %s.server_name to one of the certificate names", proto, proto))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: base.RootCAs, Intermediates: intermediates, CurrentTime: now}); err != nil {
+		var unknown x509.UnknownAuthorityError
+		if errors.As(err, &unknown) {
+			problems = append(problems, "signed by an unknown authority ("+leaf.Issuer.CommonName+")")
+			hints = append(hints, fmt.Sprintf("install the issuing CA in the system trust store or set %s.ca_file", proto))
+		}
+	}
+	if base.VerifyConnection != nil {
+		if err := base.VerifyConnection(state); err != nil {
+			r.fail(name, err.Error(), "the server key changed; confirm it with `mailcli tls fetch-cert` before updating pin_sha256")
+			return false
+		}
+	}
+
+	detail := fmt.Sprintf("subject %s, issuer %s, expires %s", leaf.Subject.CommonName, leaf.Issuer.CommonName, leaf.NotAfter.Format("2006-01-02"))
+	if len(problems) > 0 {
+		detail = strings.Join(problems, "; ") + " (" + detail + ")"
+		if insecure {
+			r.warn(name, detail, "insecure_skip_verify is enabled, so this is ignored; "+strings.Join(hints, "; "))
+			return true
+		}
+		r.fail(name, detail, strings.Join(hints, "; "))
+		return false
+	}
+	if remaining := leaf.NotAfter.Sub(now); remaining < certExpiryWarning {
+		r.warn(name, detail, fmt.Sprintf("certificate expires in %d days", int(remaining.Hours()/24)))
+		return true
+	}
+	r.pass(name, detail)
+	return true
+}
+
+func certNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	return names
+}
+
+func sortedCapabilities(caps map[string]bool) []string {
+	names := make([]string, 0, len(caps))
+	for name, ok := range caps {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,173 @@
+package doctor
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/secrets"
+
+	"github.com/emersion/go-imap/backend/memory"
+	imapserver "github.com/emersion/go-imap/server"
+)
+
+func startIMAPStub(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := imapserver.New(memory.New())
+	s.AllowInsecureAuth = true
+	go func() {
+		_ = s.Serve(l)
+	}()
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func startSMTPStub(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTPStub(conn)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func serveSMTPStub(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	write := func(s string) {
+		_, _ = conn.Write([]byte(s + "\r\n"))
+	}
+	write("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.Fields(line + " x")[0])
+		switch verb {
+		case "EHLO":
+			write("250-stub")
+			write("250-SIZE 1048576")
+			write("250 AUTH PLAIN")
+		case "AUTH":
+			write("235 2.7.0 Authentication successful")
+		case "QUIT":
+			write("221 bye")
+			return
+		default:
+			write("250 ok")
+		}
+	}
+}
+
+func testConfig(imapPort, smtpPort int) config.Config {
+	cfg := config.DefaultConfig()
+	cfg.IMAP.Host = "127.0.0.1"
+	cfg.IMAP.Port = imapPort
+	cfg.IMAP.TLS = false
+	cfg.SMTP.Host = "127.0.0.1"
+	cfg.SMTP.Port = smtpPort
+	cfg.SMTP.StartTLS = false
+	cfg.Auth.Username = "username"
+	cfg.Auth.Password = "password"
+	cfg.Auth.PasswordSource = "env"
+	return cfg
+}
+
+func findCheck(t *testing.T, report Report, name string) Check {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("check %q not in report: %+v", name, report.Checks)
+	return Check{}
+}
+
+func TestRunAgainstStubServers(t *testing.T) {
+	cfg := testConfig(startIMAPStub(t), startSMTPStub(t))
+
+	report := Run(cfg, Options{
+		Timeout: 5 * time.Second,
+		Keyring: func(string) error { return secrets.ErrSecretNotFound },
+	})
+
+	for _, name := range []string{"keyring", "imap dns", "imap tcp", "imap greeting", "imap capability", "imap login", "smtp tcp", "smtp extensions", "smtp login"} {
+		if check := findCheck(t, report, name); check.Status != StatusPass {
+			t.Fatalf("expected %s to pass, got %+v", name, check)
+		}
+	}
+	if check := findCheck(t, report, "imap capability"); !strings.Contains(check.Detail, "IMAP4rev1") {
+		t.Fatalf("expected IMAP4rev1 capability, got %q", check.Detail)
+	}
+	if check := findCheck(t, report, "smtp extensions"); !strings.Contains(check.Detail, "SIZE=1048576") {
+		t.Fatalf("expected SIZE extension, got %q", check.Detail)
+	}
+	// The memory backend only has INBOX.
+	drafts := findCheck(t, report, "drafts mailbox")
+	if drafts.Status != StatusFail || drafts.Hint == "" {
+		t.Fatalf("expected failing drafts check with hint, got %+v", drafts)
+	}
+	if report.Failures() != 1 {
+		t.Fatalf("expected exactly one failure, got %d: %+v", report.Failures(), report.Checks)
+	}
+}
+
+func TestRunReportsLoginFailure(t *testing.T) {
+	cfg := testConfig(startIMAPStub(t), startSMTPStub(t))
+	cfg.Auth.Password = "wrong"
+
+	report := Run(cfg, Options{
+		Timeout: 5 * time.Second,
+		Keyring: func(string) error { return nil },
+	})
+
+	login := findCheck(t, report, "imap login")
+	if login.Status != StatusFail || !strings.Contains(login.Hint, "app password") {
+		t.Fatalf("expected imap login failure with hint, got %+v", login)
+	}
+}
+
+func TestRunReportsUnreachableHost(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	cfg := testConfig(port, port)
+	report := Run(cfg, Options{
+		Timeout: time.Second,
+		Keyring: func(string) error { return nil },
+	})
+
+	if check := findCheck(t, report, "imap tcp"); check.Status != StatusFail || !strings.Contains(check.Hint, "imap.port") {
+		t.Fatalf("expected imap tcp failure, got %+v", check)
+	}
+	if check := findCheck(t, report, "smtp tcp"); check.Status != StatusFail {
+		t.Fatalf("expected smtp tcp failure, got %+v", check)
+	}
+}
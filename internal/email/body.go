@@ -0,0 +1,84 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	gomail "github.com/emersion/go-message/mail"
+)
+
+// Body is the readable content of a message or MIME entity.
+type Body struct {
+	Text        string
+	HTML        string
+	Attachments []string
+	// Calendar is the first text/calendar part, such as a meeting invite.
+	Calendar []byte
+}
+
+// ParseBody collects the first text/plain, text/html and text/calendar parts
+// and the attachment file names. Text falls back to the HTML with tags
+// stripped.
+func ParseBody(raw []byte) (Body, error) {
+	var body Body
+	r, err := gomail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return body, err
+	}
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return body, err
+		}
+		switch header := part.Header.(type) {
+		case *gomail.InlineHeader:
+			contentType, _, _ := header.ContentType()
+			if strings.HasPrefix(contentType, "text/plain") && body.Text == "" {
+				data, err := io.ReadAll(part.Body)
+				if err != nil {
+					return body, err
+				}
+				body.Text = string(data)
+			}
+			if strings.HasPrefix(contentType, "text/html") && body.HTML == "" {
+				data, err := io.ReadAll(part.Body)
+				if err != nil {
+					return body, err
+				}
+				body.HTML = string(data)
+			}
+			if isCalendarType(contentType) && body.Calendar == nil {
+				data, err := io.ReadAll(part.Body)
+				if err != nil {
+					return body, err
+				}
+				body.Calendar = data
+			}
+		case *gomail.AttachmentHeader:
+			if contentType, _, _ := header.ContentType(); isCalendarType(contentType) && body.Calendar == nil {
+				data, err := io.ReadAll(part.Body)
+				if err != nil {
+					return body, err
+				}
+				body.Calendar = data
+			}
+			filename, err := header.Filename()
+			if err != nil {
+				continue
+			}
+			body.Attachments = append(body.Attachments, filename)
+		}
+	}
+	if body.Text == "" && body.HTML != "" {
+		body.Text = StripHTMLTags(body.HTML)
+	}
+	return body, nil
+}
+
+func isCalendarType(contentType string) bool {
+	return contentType == "text/calendar" || contentType == "application/ics"
+}
@@ -0,0 +1,35 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCalendarPartRoundTrip(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:1@example.com\r\nSUMMARY:Sync\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	msg, err := BuildMessage(ComposeInput{
+		From:           "me@example.com",
+		To:             []string{"you@example.com"},
+		Subject:        "Sync",
+		Body:           "Join us",
+		Calendar:       []byte(ics),
+		CalendarMethod: "REQUEST",
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if !strings.Contains(string(msg), "multipart/alternative") || !strings.Contains(string(msg), "Content-Type: text/calendar; charset=\"utf-8\"; method=REQUEST") {
+		t.Fatalf("expected calendar alternative:\n%s", msg)
+	}
+
+	body, err := ParseBody(msg)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if body.Text != "Join us" || string(body.Calendar) != strings.TrimSuffix(ics, "\r\n") {
+		t.Fatalf("unexpected body: %q, calendar %q", body.Text, body.Calendar)
+	}
+	if len(body.Attachments) != 0 {
+		t.Fatalf("calendar part listed as attachment: %v", body.Attachments)
+	}
+}
@@ -0,0 +1,56 @@
+package email
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	gomail "github.com/emersion/go-message/mail"
+)
+
+func TestPrepareForDeliveryStripsBcc(t *testing.T) {
+	draft, err := BuildMessage(ComposeInput{
+		From:           "me@example.com",
+		To:             []string{"alice@example.com"},
+		Bcc:            []string{"hidden@example.com", "audit@example.com"},
+		Subject:        "Plans",
+		Body:           "X-Mailcli-Bcc: this line is body text",
+		StoreBccHeader: true,
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	draft = setHeader(draft, "Bcc", "legacy@example.com")
+
+	wire, record := PrepareForDelivery(draft)
+
+	reader, err := gomail.CreateReader(bytes.NewReader(wire))
+	if err != nil {
+		t.Fatalf("parse transmitted message: %v", err)
+	}
+	fields := reader.Header.Fields()
+	for fields.Next() {
+		key := strings.ToLower(fields.Key())
+		if key == "bcc" || strings.HasPrefix(key, "x-mailcli-") {
+			t.Fatalf("transmitted message leaks %s: %s", fields.Key(), fields.Value())
+		}
+	}
+	if strings.Contains(string(wire), "hidden@example.com") || strings.Contains(string(wire), "legacy@example.com") {
+		t.Fatalf("transmitted message leaks a blind recipient:\n%s", wire)
+	}
+	if reader.Header.Get("To") != "alice@example.com" || !strings.Contains(string(wire), "this line is body text") {
+		t.Fatalf("expected other headers and body kept:\n%s", wire)
+	}
+
+	kept, err := gomail.CreateReader(bytes.NewReader(record))
+	if err != nil {
+		t.Fatalf("parse kept copy: %v", err)
+	}
+	bcc, err := kept.Header.AddressList("Bcc")
+	if err != nil || len(bcc) != 3 {
+		t.Fatalf("expected all blind recipients in the kept copy, got %v %v", bcc, err)
+	}
+	if kept.Header.Get("X-Mailcli-Bcc") != "" {
+		t.Fatal("expected internal header converted in the kept copy")
+	}
+}
@@ -16,22 +16,37 @@ import (
 	"strings"
 	"time"
 
+	"mailcli/internal/textutil"
+
 	gomail "github.com/emersion/go-message/mail"
 )
 
 type ComposeInput struct {
-	From           string
-	To             []string
-	Cc             []string
-	Bcc            []string
-	ReplyTo        string
-	Subject        string
-	Body           string
-	BodyHTML       string
-	InReplyTo      string
-	References     string
-	Attachments    []string
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     string
+	Subject     string
+	Body        string
+	BodyHTML    string
+	InReplyTo   string
+	References  string
+	Attachments []string
+	// Inline holds "path[=cid]" specs for parts referenced from BodyHTML.
+	Inline []string
+	// Calendar is an iCalendar object added as a text/calendar alternative
+	// whose method parameter is CalendarMethod, e.g. REQUEST or REPLY.
+	Calendar       []byte
+	CalendarMethod string
+	// ReceiptTo, when set, asks recipients for a read receipt (RFC 8098)
+	// sent to this address.
+	ReceiptTo      string
 	StoreBccHeader bool
+	// Date and MessageID replace the current time and a random ID when set,
+	// so a preview can be reproduced exactly.
+	Date      time.Time
+	MessageID string
 }
 
 func BuildMessage(in ComposeInput) ([]byte, error) {
@@ -47,9 +62,17 @@ func BuildMessage(in ComposeInput) ([]byte, error) {
 		attachments = append(attachments, mailAttachment{Path: p})
 	}
 
+	inline, bodyHTML, err := inlineParts(in.Inline, in.BodyHTML)
+	if err != nil {
+		return nil, err
+	}
+
 	additional := map[string]string{}
 	if in.StoreBccHeader && len(in.Bcc) > 0 {
-		additional["X-Mailcli-Bcc"] = strings.Join(in.Bcc, ", ")
+		additional[bccHeader] = strings.Join(in.Bcc, ", ")
+	}
+	if strings.TrimSpace(in.ReceiptTo) != "" {
+		additional[ReceiptHeader] = formatAddressHeader(in.ReceiptTo)
 	}
 
 	return buildRFC822(mailOptions{
@@ -59,11 +82,15 @@ func BuildMessage(in ComposeInput) ([]byte, error) {
 		ReplyTo:           in.ReplyTo,
 		Subject:           in.Subject,
 		Body:              in.Body,
-		BodyHTML:          in.BodyHTML,
+		BodyHTML:          bodyHTML,
 		InReplyTo:         in.InReplyTo,
 		References:        in.References,
 		AdditionalHeaders: additional,
 		Attachments:       attachments,
+		Inline:            inline,
+		Calendar:          calendarPart{Data: in.Calendar, Method: in.CalendarMethod},
+		Date:              in.Date,
+		MessageID:         in.MessageID,
 	})
 }
 
@@ -97,7 +124,7 @@ func ExtractRecipients(raw []byte) ([]string, error) {
 		return nil, err
 	}
 
-	if bcc := header.Get("X-Mailcli-Bcc"); bcc != "" {
+	if bcc := header.Get(bccHeader); bcc != "" {
 		extra := strings.Split(bcc, ",")
 		for _, part := range extra {
 			trimmed := strings.TrimSpace(part)
@@ -111,10 +138,11 @@ func ExtractRecipients(raw []byte) ([]string, error) {
 }
 
 type mailAttachment struct {
-	Path     string
-	Filename string
-	MIMEType string
-	Data     []byte
+	Path      string
+	Filename  string
+	MIMEType  string
+	ContentID string
+	Data      []byte
 }
 
 type mailOptions struct {
@@ -129,6 +157,15 @@ type mailOptions struct {
 	References        string
 	AdditionalHeaders map[string]string
 	Attachments       []mailAttachment
+	Inline            []mailAttachment
+	Calendar          calendarPart
+	Date              time.Time
+	MessageID         string
+}
+
+type calendarPart struct {
+	Data   []byte
+	Method string
 }
 
 func buildRFC822(opts mailOptions) ([]byte, error) {
@@ -164,6 +201,9 @@ func buildRFC822(opts mailOptions) ([]byte, error) {
 			return nil, fmt.Errorf("invalid References: %w", err)
 		}
 	}
+	if err := validateHeaderValue(opts.MessageID); err != nil {
+		return nil, fmt.Errorf("invalid Message-ID: %w", err)
+	}
 	for k, v := range opts.AdditionalHeaders {
 		if strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
 			continue
@@ -187,11 +227,18 @@ func buildRFC822(opts mailOptions) ([]byte, error) {
 	if strings.TrimSpace(opts.Subject) != "" {
 		writeHeader(&b, "Subject", encodeHeaderIfNeeded(opts.Subject))
 	}
-	writeHeader(&b, "Date", time.Now().Format(time.RFC1123Z))
+	date := opts.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	writeHeader(&b, "Date", date.Format(time.RFC1123Z))
 	if !hasHeader(opts.AdditionalHeaders, "Message-ID") && !hasHeader(opts.AdditionalHeaders, "Message-Id") {
-		messageID, err := randomMessageID(opts.From)
-		if err != nil {
-			return nil, err
+		messageID := opts.MessageID
+		if messageID == "" {
+			var err error
+			if messageID, err = randomMessageID(opts.From); err != nil {
+				return nil, err
+			}
 		}
 		writeHeader(&b, "Message-ID", messageID)
 	}
@@ -210,44 +257,12 @@ func buildRFC822(opts mailOptions) ([]byte, error) {
 
 	plainBody := normalizeCRLF(opts.Body)
 	htmlBody := normalizeCRLF(opts.BodyHTML)
-	hasPlain := strings.TrimSpace(plainBody) != ""
-	hasHTML := strings.TrimSpace(htmlBody) != ""
 
 	if len(opts.Attachments) == 0 {
-		switch {
-		case hasPlain && hasHTML:
-			altBoundary, err := randomBoundary()
-			if err != nil {
-				return nil, err
-			}
-			writeHeader(&b, "Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", altBoundary))
-			b.WriteString("\r\n")
-
-			if err := writeQuotedPrintablePart(&b, altBoundary, "text/plain; charset=\"utf-8\"", plainBody); err != nil {
-				return nil, err
-			}
-			if err := writeQuotedPrintablePart(&b, altBoundary, "text/html; charset=\"utf-8\"", htmlBody); err != nil {
-				return nil, err
-			}
-			b.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
-			return b.Bytes(), nil
-		case hasHTML && !hasPlain:
-			writeHeader(&b, "Content-Type", "text/html; charset=\"utf-8\"")
-			writeHeader(&b, "Content-Transfer-Encoding", "quoted-printable")
-			b.WriteString("\r\n")
-			if err := writeQuotedPrintableBody(&b, htmlBody); err != nil {
-				return nil, err
-			}
-			return b.Bytes(), nil
-		default:
-			writeHeader(&b, "Content-Type", "text/plain; charset=\"utf-8\"")
-			writeHeader(&b, "Content-Transfer-Encoding", "quoted-printable")
-			b.WriteString("\r\n")
-			if err := writeQuotedPrintableBody(&b, plainBody); err != nil {
-				return nil, err
-			}
-			return b.Bytes(), nil
+		if err := writeBody(&b, plainBody, htmlBody, opts.Calendar, opts.Inline); err != nil {
+			return nil, err
 		}
+		return b.Bytes(), nil
 	}
 
 	mixedBoundary, err := randomBoundary()
@@ -259,62 +274,125 @@ func buildRFC822(opts mailOptions) ([]byte, error) {
 	b.WriteString("\r\n")
 
 	b.WriteString(fmt.Sprintf("--%s\r\n", mixedBoundary))
+	if err := writeBody(&b, plainBody, htmlBody, opts.Calendar, opts.Inline); err != nil {
+		return nil, err
+	}
+
+	for _, a := range opts.Attachments {
+		b.WriteString(fmt.Sprintf("\r\n--%s\r\n", mixedBoundary))
+		if err := writeAttachmentPart(&b, a, "attachment"); err != nil {
+			return nil, err
+		}
+	}
+
+	b.WriteString(fmt.Sprintf("--%s--\r\n", mixedBoundary))
+	return b.Bytes(), nil
+}
+
+// writeBody writes the Content-Type header and content of the message body
+// entity: text/plain, text/html, or multipart/alternative of both and any
+// calendar part. Inline parts are wrapped with the HTML part in
+// multipart/related.
+func writeBody(b *bytes.Buffer, plainBody, htmlBody string, calendar calendarPart, inline []mailAttachment) error {
+	hasPlain := strings.TrimSpace(plainBody) != ""
+	hasHTML := strings.TrimSpace(htmlBody) != ""
+	if len(inline) > 0 && !hasHTML {
+		return errors.New("inline parts require an HTML body")
+	}
+
 	switch {
-	case hasPlain && hasHTML:
+	case hasPlain && hasHTML, len(calendar.Data) > 0:
 		altBoundary, err := randomBoundary()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		b.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q\r\n\r\n", altBoundary))
-		if err := writeQuotedPrintablePart(&b, altBoundary, "text/plain; charset=\"utf-8\"", plainBody); err != nil {
-			return nil, err
+		if hasPlain || !hasHTML {
+			if err := writeQuotedPrintablePart(b, altBoundary, "text/plain; charset=\"utf-8\"", plainBody); err != nil {
+				return err
+			}
 		}
-		if err := writeQuotedPrintablePart(&b, altBoundary, "text/html; charset=\"utf-8\"", htmlBody); err != nil {
-			return nil, err
+		if len(inline) > 0 {
+			b.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
+			if err := writeRelated(b, htmlBody, inline); err != nil {
+				return err
+			}
+		} else if hasHTML {
+			if err := writeQuotedPrintablePart(b, altBoundary, "text/html; charset=\"utf-8\"", htmlBody); err != nil {
+				return err
+			}
+		}
+		// Calendar clients look for the invitation as the last alternative.
+		if len(calendar.Data) > 0 {
+			contentType := "text/calendar; charset=\"utf-8\""
+			if calendar.Method != "" {
+				contentType += "; method=" + calendar.Method
+			}
+			if err := writeQuotedPrintablePart(b, altBoundary, contentType, string(calendar.Data)); err != nil {
+				return err
+			}
 		}
 		b.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
-	case hasHTML && !hasPlain:
+		return nil
+	case hasHTML && len(inline) > 0:
+		return writeRelated(b, htmlBody, inline)
+	case hasHTML:
 		b.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n")
 		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
-		if err := writeQuotedPrintableBody(&b, htmlBody); err != nil {
-			return nil, err
-		}
+		return writeQuotedPrintableBody(b, htmlBody)
 	default:
 		b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
 		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
-		if err := writeQuotedPrintableBody(&b, plainBody); err != nil {
-			return nil, err
-		}
+		return writeQuotedPrintableBody(b, plainBody)
 	}
+}
 
-	for _, a := range opts.Attachments {
-		if a.Filename == "" {
-			a.Filename = filepath.Base(a.Path)
+func writeRelated(b *bytes.Buffer, htmlBody string, inline []mailAttachment) error {
+	relBoundary, err := randomBoundary()
+	if err != nil {
+		return err
+	}
+	b.WriteString(fmt.Sprintf("Content-Type: multipart/related; boundary=%q; type=\"text/html\"\r\n\r\n", relBoundary))
+	if err := writeQuotedPrintablePart(b, relBoundary, "text/html; charset=\"utf-8\"", htmlBody); err != nil {
+		return err
+	}
+	for _, a := range inline {
+		b.WriteString(fmt.Sprintf("--%s\r\n", relBoundary))
+		if err := writeAttachmentPart(b, a, "inline"); err != nil {
+			return err
 		}
+	}
+	b.WriteString(fmt.Sprintf("--%s--\r\n", relBoundary))
+	return nil
+}
+
+func writeAttachmentPart(b *bytes.Buffer, a mailAttachment, disposition string) error {
+	if a.Filename == "" {
+		a.Filename = filepath.Base(a.Path)
+	}
+	if a.MIMEType == "" {
+		a.MIMEType = mime.TypeByExtension(strings.ToLower(filepath.Ext(a.Filename)))
 		if a.MIMEType == "" {
-			a.MIMEType = mime.TypeByExtension(strings.ToLower(filepath.Ext(a.Filename)))
-			if a.MIMEType == "" {
-				a.MIMEType = "application/octet-stream"
-			}
+			a.MIMEType = "application/octet-stream"
 		}
-		if len(a.Data) == 0 {
-			data, err := os.ReadFile(a.Path)
-			if err != nil {
-				return nil, err
-			}
-			a.Data = data
+	}
+	if len(a.Data) == 0 {
+		data, err := os.ReadFile(a.Path)
+		if err != nil {
+			return err
 		}
-
-		b.WriteString(fmt.Sprintf("\r\n--%s\r\n", mixedBoundary))
-		b.WriteString(fmt.Sprintf("Content-Type: %s\r\n", a.MIMEType))
-		b.WriteString("Content-Transfer-Encoding: base64\r\n")
-		b.WriteString(fmt.Sprintf("Content-Disposition: attachment; %s\r\n\r\n", contentDispositionFilename(a.Filename)))
-		b.WriteString(wrapBase64(a.Data))
-		b.WriteString("\r\n")
+		a.Data = data
 	}
 
-	b.WriteString(fmt.Sprintf("--%s--\r\n", mixedBoundary))
-	return b.Bytes(), nil
+	b.WriteString(fmt.Sprintf("Content-Type: %s\r\n", a.MIMEType))
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	if a.ContentID != "" {
+		b.WriteString(fmt.Sprintf("Content-ID: <%s>\r\n", a.ContentID))
+	}
+	b.WriteString(fmt.Sprintf("Content-Disposition: %s; %s\r\n\r\n", disposition, contentDispositionFilename(a.Filename)))
+	b.WriteString(wrapBase64(a.Data))
+	b.WriteString("\r\n")
+	return nil
 }
 
 func writeHeader(b *bytes.Buffer, name, value string) {
@@ -453,21 +531,12 @@ func randomMessageID(from string) (string, error) {
 }
 
 func encodeHeaderIfNeeded(v string) string {
-	if isASCII(v) {
+	if textutil.IsASCII(v) {
 		return v
 	}
 	return mime.QEncoding.Encode("utf-8", v)
 }
 
-func isASCII(s string) bool {
-	for i := 0; i < len(s); i++ {
-		if s[i] >= 0x80 {
-			return false
-		}
-	}
-	return true
-}
-
 func normalizeCRLF(s string) string {
 	s = strings.ReplaceAll(s, "\r\n", "\n")
 	s = strings.ReplaceAll(s, "\r", "\n")
@@ -479,7 +548,7 @@ func contentDispositionFilename(filename string) string {
 	if filename == "" {
 		return `filename="attachment"`
 	}
-	if isASCII(filename) {
+	if textutil.IsASCII(filename) {
 		return fmt.Sprintf("filename=%q", filename)
 	}
 	return "filename*=UTF-8''" + rfc5987Encode(filename)
@@ -0,0 +1,207 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SetDate replaces the Date header of a raw message, adding one if missing.
+func SetDate(raw []byte, t time.Time) []byte {
+	return setHeader(raw, "Date", t.Format(time.RFC1123Z))
+}
+
+// setHeader replaces every occurrence of a top-level header, including
+// folded continuation lines, with a single value. The body is untouched.
+func setHeader(raw []byte, name, value string) []byte {
+	header, body := splitHeader(raw)
+	var out bytes.Buffer
+	written := false
+	skipping := false
+	for _, line := range splitLines(header) {
+		if skipping && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			continue
+		}
+		skipping = false
+		if field, _, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(field), name) {
+			skipping = true
+			if !written {
+				out.WriteString(name + ": " + value + "\r\n")
+				written = true
+			}
+			continue
+		}
+		out.WriteString(line + "\r\n")
+	}
+	if !written {
+		out.WriteString(name + ": " + value + "\r\n")
+	}
+	out.WriteString("\r\n")
+	out.Write(body)
+	return out.Bytes()
+}
+
+// bccHeader carries draft Bcc recipients; see ComposeInput.StoreBccHeader.
+const bccHeader = "X-Mailcli-Bcc"
+
+// PrepareForDelivery returns the bytes to transmit, without Bcc or any
+// X-Mailcli-* header, and the copy to keep (for the Sent mailbox or the
+// outbox), in which X-Mailcli-Bcc becomes a regular Bcc header.
+func PrepareForDelivery(raw []byte) (wire, record []byte) {
+	wire = removeHeadersFunc(raw, func(name string) bool {
+		return strings.EqualFold(name, "Bcc") || isInternalHeader(name)
+	})
+	record = raw
+	if bcc := headerValue(raw, bccHeader); bcc != "" {
+		if existing := headerValue(raw, "Bcc"); existing != "" {
+			bcc = existing + ", " + bcc
+		}
+		record = setHeader(RemoveHeaders(raw, bccHeader), "Bcc", bcc)
+	}
+	return wire, record
+}
+
+func isInternalHeader(name string) bool {
+	return len(name) >= len("X-Mailcli-") && strings.EqualFold(name[:len("X-Mailcli-")], "X-Mailcli-")
+}
+
+// headerValue returns the unfolded value of the first top-level header.
+func headerValue(raw []byte, name string) string {
+	header, _ := splitHeader(raw)
+	var value string
+	found := false
+	for _, line := range splitLines(header) {
+		if found {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				value += " " + strings.TrimSpace(line)
+				continue
+			}
+			break
+		}
+		if field, v, ok := strings.Cut(line, ":"); ok && matchesHeader(field, []string{name}) {
+			value, found = strings.TrimSpace(v), true
+		}
+	}
+	return value
+}
+
+// RemoveHeaders drops every occurrence of the named top-level headers,
+// including folded continuation lines. The body is untouched.
+func RemoveHeaders(raw []byte, names ...string) []byte {
+	return removeHeadersFunc(raw, func(name string) bool {
+		return matchesHeader(name, names)
+	})
+}
+
+func removeHeadersFunc(raw []byte, drop func(name string) bool) []byte {
+	header, body := splitHeader(raw)
+	var out bytes.Buffer
+	skipping := false
+	for _, line := range splitLines(header) {
+		if skipping && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			continue
+		}
+		skipping = false
+		if field, _, ok := strings.Cut(line, ":"); ok && drop(strings.TrimSpace(field)) {
+			skipping = true
+			continue
+		}
+		out.WriteString(line + "\r\n")
+	}
+	out.WriteString("\r\n")
+	out.Write(body)
+	return out.Bytes()
+}
+
+// HasHeader reports whether the message has a non-empty top-level header.
+func HasHeader(raw []byte, name string) bool {
+	header, _ := splitHeader(raw)
+	for _, line := range splitLines(header) {
+		if field, value, ok := strings.Cut(line, ":"); ok && matchesHeader(field, []string{name}) && strings.TrimSpace(value) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteHeaders adds From, Date and Message-ID headers when the message
+// lacks them, as sendmail does for messages submitted by local programs.
+func CompleteHeaders(raw []byte, from string, now time.Time) ([]byte, error) {
+	if !HasHeader(raw, "From") {
+		if err := validateHeaderValue(from); err != nil {
+			return nil, fmt.Errorf("invalid From: %w", err)
+		}
+		raw = setHeader(raw, "From", formatAddressHeader(from))
+	}
+	if !HasHeader(raw, "Date") {
+		raw = SetDate(raw, now)
+	}
+	if !HasHeader(raw, "Message-ID") {
+		id, err := randomMessageID(from)
+		if err != nil {
+			return nil, err
+		}
+		raw = setHeader(raw, "Message-ID", id)
+	}
+	return raw, nil
+}
+
+// SplitContentHeaders separates a message into its outer headers and the
+// body entity: the Content-* headers followed by the body, with CRLF line
+// endings. Signing and encryption wrap the entity and keep the outer headers.
+func SplitContentHeaders(raw []byte) (outer, entity []byte) {
+	header, body := splitHeader(raw)
+	var out, in bytes.Buffer
+	inContent := false
+	for _, line := range splitLines(header) {
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			field, _, _ := strings.Cut(line, ":")
+			inContent = len(field) >= len("Content-") && strings.EqualFold(field[:len("Content-")], "Content-")
+		}
+		if inContent {
+			in.WriteString(line + "\r\n")
+		} else {
+			out.WriteString(line + "\r\n")
+		}
+	}
+	if in.Len() == 0 {
+		in.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	}
+	in.WriteString("\r\n")
+	in.WriteString(normalizeCRLF(string(body)))
+	return out.Bytes(), in.Bytes()
+}
+
+func matchesHeader(field string, names []string) bool {
+	field = strings.TrimSpace(field)
+	for _, name := range names {
+		if strings.EqualFold(field, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitHeader returns the header block without its terminating blank line,
+// and the body after it.
+func splitHeader(raw []byte) ([]byte, []byte) {
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		return raw[:i], raw[i+4:]
+	}
+	if i := bytes.Index(raw, []byte("\n\n")); i >= 0 {
+		return raw[:i], raw[i+2:]
+	}
+	return raw, nil
+}
+
+func splitLines(header []byte) []string {
+	if len(header) == 0 {
+		return nil
+	}
+	lines := strings.Split(string(header), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
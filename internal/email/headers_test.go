@@ -0,0 +1,38 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoveHeadersAndComplete(t *testing.T) {
+	raw := []byte("To: a@example.com\nBcc: secret@example.com,\n  other@example.com\nSubject: cron\n\nBcc: in body stays\n")
+
+	stripped := RemoveHeaders(raw, "bcc")
+	if strings.Contains(string(stripped), "secret@") || strings.Contains(string(stripped), "other@") {
+		t.Fatalf("expected folded Bcc removed, got %q", stripped)
+	}
+	if !strings.Contains(string(stripped), "\r\n\r\nBcc: in body stays\n") {
+		t.Fatalf("expected body untouched, got %q", stripped)
+	}
+
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	completed, err := CompleteHeaders(stripped, "Cron Daemon <me@example.com>", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"From: \"Cron Daemon\" <me@example.com>\r\n", "Date: Sun, 18 Oct 2026 09:00:00 +0000\r\n", "Message-ID: <"} {
+		if !strings.Contains(string(completed), want) {
+			t.Fatalf("expected %q in %q", want, completed)
+		}
+	}
+
+	again, err := CompleteHeaders(completed, "other@example.com", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(completed) {
+		t.Fatalf("expected existing headers kept, got %q", again)
+	}
+}
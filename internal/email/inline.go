@@ -0,0 +1,107 @@
+package email
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var imgSrcPattern = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*)("[^"]*"|'[^']*')`)
+
+// ParseInlineSpec splits an --inline value of the form path[=cid]. Without a
+// cid, one is generated from the file name. Since file names may contain
+// "=", the text after the last one is only taken as a cid when it has no
+// path separator, the text before it names an existing file, and the whole
+// value does not.
+func ParseInlineSpec(spec string) (string, string, error) {
+	path, cid := strings.TrimSpace(spec), ""
+	if i := strings.LastIndex(path, "="); i > 0 {
+		head, tail := strings.TrimSpace(path[:i]), path[i+1:]
+		if !strings.ContainsAny(tail, `/`+string(filepath.Separator)) && isFile(head) && !isFile(path) {
+			path, cid = head, strings.Trim(strings.TrimSpace(tail), "<>")
+		}
+	}
+	if path == "" {
+		return "", "", fmt.Errorf("invalid inline spec %q", spec)
+	}
+	if cid == "" {
+		var b [6]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", "", err
+		}
+		cid = fmt.Sprintf("%s.%s@mailcli", cidSafe(filepath.Base(path)), hex.EncodeToString(b[:]))
+	}
+	if err := validateHeaderValue(cid); err != nil || strings.ContainsAny(cid, " <>") {
+		return "", "", fmt.Errorf("invalid content id %q", cid)
+	}
+	return path, cid, nil
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// inlineParts parses inline specs and rewrites <img src> references to the
+// given files into cid: URLs.
+func inlineParts(specs []string, html string) ([]mailAttachment, string, error) {
+	parts := make([]mailAttachment, 0, len(specs))
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		path, cid, err := ParseInlineSpec(spec)
+		if err != nil {
+			return nil, "", err
+		}
+		if seen[cid] {
+			return nil, "", fmt.Errorf("duplicate content id %q", cid)
+		}
+		seen[cid] = true
+		parts = append(parts, mailAttachment{Path: path, ContentID: cid})
+	}
+	if len(parts) == 0 {
+		return nil, html, nil
+	}
+
+	html = imgSrcPattern.ReplaceAllStringFunc(html, func(tag string) string {
+		m := imgSrcPattern.FindStringSubmatch(tag)
+		quote := m[2][:1]
+		src := m[2][1 : len(m[2])-1]
+		for _, part := range parts {
+			if sameFile(src, part.Path) {
+				return m[1] + quote + "cid:" + part.ContentID + quote
+			}
+		}
+		return tag
+	})
+	return parts, html, nil
+}
+
+func sameFile(src, path string) bool {
+	if src == "" || strings.Contains(src, ":") {
+		return false
+	}
+	clean := func(p string) string {
+		return filepath.ToSlash(filepath.Clean(filepath.FromSlash(p)))
+	}
+	return clean(src) == clean(path)
+}
+
+func cidSafe(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x80 && (r == '.' || r == '-' || r == '_' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "part"
+	}
+	return b.String()
+}
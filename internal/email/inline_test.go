@@ -0,0 +1,106 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gomessage "github.com/emersion/go-message"
+)
+
+func TestBuildMessageInlineImages(t *testing.T) {
+	dir := t.TempDir()
+	logo := filepath.Join(dir, "logo.png")
+	if err := os.WriteFile(logo, []byte("\x89PNG fake"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := BuildMessage(ComposeInput{
+		From:     "me@example.com",
+		To:       []string{"you@example.com"},
+		Subject:  "Release",
+		Body:     "See the logo",
+		BodyHTML: `<p><img alt="a" src="` + logo + `"> <img src='https://example.com/x.png'></p>`,
+		Inline:   []string{logo + "=logo"},
+	})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	entity, err := gomessage.Read(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var types []string
+	var html, cid string
+	err = entity.Walk(func(path []int, part *gomessage.Entity, err error) error {
+		if err != nil {
+			return err
+		}
+		mediaType, _, _ := part.Header.ContentType()
+		types = append(types, mediaType)
+		switch mediaType {
+		case "text/html":
+			data, _ := io.ReadAll(part.Body)
+			html = string(data)
+		case "image/png":
+			cid = part.Header.Get("Content-Id")
+			if disp := part.Header.Get("Content-Disposition"); !strings.HasPrefix(disp, "inline;") {
+				t.Fatalf("expected inline disposition, got %q", disp)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+
+	want := "multipart/alternative,text/plain,multipart/related,text/html,image/png"
+	if got := strings.Join(types, ","); got != want {
+		t.Fatalf("unexpected structure %s", got)
+	}
+	if cid != "<logo>" {
+		t.Fatalf("unexpected Content-ID %q", cid)
+	}
+	if !strings.Contains(html, `src="cid:logo"`) || !strings.Contains(html, "src='https://example.com/x.png'") {
+		t.Fatalf("expected local image rewritten only, got %q", html)
+	}
+}
+
+func TestParseInlineSpec(t *testing.T) {
+	path, cid, err := ParseInlineSpec("./img/Logo Final.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "./img/Logo Final.png" || !strings.HasPrefix(cid, "LogoFinal.png.") || !strings.HasSuffix(cid, "@mailcli") {
+		t.Fatalf("unexpected spec %q %q", path, cid)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"a=b.png", "logo.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for spec, want := range map[string][2]string{
+		filepath.Join(dir, "a=b.png"):           {filepath.Join(dir, "a=b.png"), ""},
+		filepath.Join(dir, "logo.png") + "=hd":  {filepath.Join(dir, "logo.png"), "hd"},
+		"img/a=b.png":                           {"img/a=b.png", ""},
+		filepath.Join(dir, "logo.png") + "=x/y": {filepath.Join(dir, "logo.png") + "=x/y", ""},
+	} {
+		path, cid, err := ParseInlineSpec(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if path != want[0] || (want[1] != "" && cid != want[1]) || (want[1] == "" && !strings.HasSuffix(cid, "@mailcli")) {
+			t.Errorf("%s: got path %q cid %q", spec, path, cid)
+		}
+	}
+
+	if _, err := BuildMessage(ComposeInput{From: "me@example.com", Body: "x", Inline: []string{"a.png"}}); err == nil {
+		t.Fatal("expected error for inline parts without HTML body")
+	}
+}
@@ -0,0 +1,82 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// DefaultMarkdownCSS keeps rendered mail readable in clients that honour
+// <style>; it is deliberately small since many clients strip most CSS.
+const DefaultMarkdownCSS = `body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; font-size: 14px; line-height: 1.5; color: #24292f; }
+pre, code { font-family: Menlo, Consolas, monospace; font-size: 13px; background: #f6f8fa; }
+pre { padding: 8px 12px; border-radius: 4px; overflow: auto; }
+blockquote { margin: 0 0 0 .8ex; border-left: 3px solid #d0d7de; padding-left: 1ex; color: #57606a; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; }`
+
+// DefaultMarkdownTemplate wraps the rendered body; templates receive .CSS
+// and .Body.
+const DefaultMarkdownTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>{{.CSS}}</style>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// RenderMarkdown converts Markdown to an HTML fragment with anything a mail
+// client could execute or load remotely stripped out. Raw HTML in the source
+// is sanitized along with the rendered output.
+func RenderMarkdown(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		return "", fmt.Errorf("render markdown: %w", err)
+	}
+	return markdownPolicy().Sanitize(buf.String()), nil
+}
+
+func markdownPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	// GFM task lists render as disabled checkboxes.
+	policy.AllowAttrs("type").Matching(bluemonday.SpaceSeparatedTokens).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	return policy
+}
+
+// WrapHTML places an HTML fragment in a full document using tmpl (or the
+// default template) and css (or the default stylesheet).
+func WrapHTML(fragment, tmpl, css string) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultMarkdownTemplate
+	}
+	if css == "" {
+		css = DefaultMarkdownCSS
+	}
+	t, err := template.New("markdown").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("parse markdown template: %w", err)
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, struct {
+		CSS  template.CSS
+		Body template.HTML
+	}{
+		CSS:  template.CSS(css),       //nolint:gosec // stylesheet comes from the user's config
+		Body: template.HTML(fragment), //nolint:gosec // fragment is sanitized by RenderMarkdown
+	})
+	if err != nil {
+		return "", fmt.Errorf("render markdown template: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,44 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	html, err := RenderMarkdown("# Hi\n\n**bold** <script>alert(1)</script> [x](javascript:alert(1))\n\n- [x] done\n")
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(html, "<h1") || !strings.Contains(html, "<strong>bold</strong>") {
+		t.Fatalf("expected rendered markdown, got %q", html)
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "javascript:") {
+		t.Fatalf("expected unsafe content stripped, got %q", html)
+	}
+	if !strings.Contains(html, `type="checkbox"`) {
+		t.Fatalf("expected task list checkbox kept, got %q", html)
+	}
+}
+
+func TestWrapHTML(t *testing.T) {
+	doc, err := WrapHTML("<p>hello</p>", "", "")
+	if err != nil {
+		t.Fatalf("wrap: %v", err)
+	}
+	if !strings.Contains(doc, "<p>hello</p>") || !strings.Contains(doc, "font-family") {
+		t.Fatalf("expected default template with body and css, got %q", doc)
+	}
+
+	doc, err = WrapHTML("<p>hello</p>", "<div style=\"x\">{{.Body}}</div><style>{{.CSS}}</style>", "p { color: red; }")
+	if err != nil {
+		t.Fatalf("wrap custom: %v", err)
+	}
+	if doc != "<div style=\"x\"><p>hello</p></div><style>p { color: red; }</style>" {
+		t.Fatalf("unexpected custom output %q", doc)
+	}
+
+	if _, err := WrapHTML("", "{{.Body", ""); err == nil {
+		t.Fatal("expected template parse error")
+	}
+}
@@ -0,0 +1,131 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// ReceiptHeader is the header requesting a read receipt (RFC 8098).
+const ReceiptHeader = "Disposition-Notification-To"
+
+// ReceiptRequest is a read receipt request found in a received message.
+type ReceiptRequest struct {
+	// To lists the addresses the notification goes to.
+	To        []string
+	MessageID string
+	Subject   string
+	Date      string
+	// OriginalRecipient is the Original-Recipient header, if any.
+	OriginalRecipient string
+	// ReturnPath is the envelope sender recorded on delivery, if any.
+	ReturnPath string
+}
+
+// ParseReceiptRequest returns the read receipt request of a message, or nil
+// when it does not ask for one.
+func ParseReceiptRequest(raw []byte) *ReceiptRequest {
+	to := parseEmailAddresses(headerValue(raw, ReceiptHeader))
+	if len(to) == 0 {
+		return nil
+	}
+	subject := headerValue(raw, "Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	return &ReceiptRequest{
+		To:                to,
+		MessageID:         headerValue(raw, "Message-ID"),
+		Subject:           subject,
+		Date:              headerValue(raw, "Date"),
+		OriginalRecipient: headerValue(raw, "Original-Recipient"),
+		ReturnPath:        strings.Trim(headerValue(raw, "Return-Path"), "<> "),
+	}
+}
+
+// NeedsConfirmation reports whether the request should only be answered
+// with the user's explicit consent: RFC 8098 section 2.1 singles out
+// requests to several addresses or to an address other than the envelope
+// sender.
+func (r *ReceiptRequest) NeedsConfirmation() bool {
+	if len(r.To) != 1 {
+		return true
+	}
+	return r.ReturnPath != "" && !strings.EqualFold(r.ReturnPath, r.To[0])
+}
+
+// MDNInput describes a read receipt for a received message.
+type MDNInput struct {
+	// From is the From header value of the notification.
+	From string
+	// FinalRecipient is the address that received and displayed the message.
+	FinalRecipient string
+	Date           time.Time
+}
+
+// BuildMDN builds a multipart/report message disposition notification (RFC
+// 8098) saying original was displayed, sent manually by the user. It returns
+// an error when original does not request a receipt.
+func BuildMDN(original []byte, in MDNInput) ([]byte, error) {
+	req := ParseReceiptRequest(original)
+	if req == nil {
+		return nil, errors.New("message does not request a read receipt")
+	}
+	if err := validateHeaderValue(in.From); err != nil {
+		return nil, fmt.Errorf("invalid From: %w", err)
+	}
+	if err := validateHeaderValue(in.FinalRecipient); err != nil || strings.TrimSpace(in.FinalRecipient) == "" {
+		return nil, fmt.Errorf("invalid final recipient %q", in.FinalRecipient)
+	}
+	messageID, err := randomMessageID(in.From)
+	if err != nil {
+		return nil, err
+	}
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	writeHeader(&b, "From", formatAddressHeader(in.From))
+	writeHeader(&b, "To", strings.Join(req.To, ", "))
+	writeHeader(&b, "Subject", encodeHeaderIfNeeded("Read: "+req.Subject))
+	writeHeader(&b, "Date", in.Date.Format(time.RFC1123Z))
+	writeHeader(&b, "Message-ID", messageID)
+	writeHeader(&b, "In-Reply-To", req.MessageID)
+	writeHeader(&b, "References", req.MessageID)
+	writeHeader(&b, "Auto-Submitted", "auto-replied")
+	writeHeader(&b, "MIME-Version", "1.0")
+	writeHeader(&b, "Content-Type", fmt.Sprintf("multipart/report; report-type=disposition-notification; boundary=%q", boundary))
+	b.WriteString("\r\n")
+
+	text := fmt.Sprintf("The message sent to %s", in.FinalRecipient)
+	if req.Date != "" {
+		text += " on " + req.Date
+	}
+	if req.Subject != "" {
+		text += fmt.Sprintf(" with subject %q", req.Subject)
+	}
+	text += " has been displayed.\n\nThis is no guarantee that the message has been read or understood.\n"
+	if err := writeQuotedPrintablePart(&b, boundary, `text/plain; charset="utf-8"`, text); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: message/disposition-notification\r\n\r\n")
+	writeHeader(&b, "Reporting-UA", "mailcli")
+	writeHeader(&b, "Original-Recipient", req.OriginalRecipient)
+	writeHeader(&b, "Final-Recipient", "rfc822;"+strings.TrimSpace(in.FinalRecipient))
+	writeHeader(&b, "Original-Message-ID", req.MessageID)
+	writeHeader(&b, "Disposition", "manual-action/MDN-sent-manually; displayed")
+
+	header, _ := splitHeader(CanonicalLineEndings(original))
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: text/rfc822-headers\r\n\r\n")
+	b.Write(bytes.TrimRight(header, "\r\n"))
+	fmt.Fprintf(&b, "\r\n\r\n--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const receiptRequest = "Return-Path: <alice@example.com>\r\n" +
+	"From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject: =?utf-8?q?Vertrag_unterzeichnet?=\r\n" +
+	"Date: Mon, 19 Oct 2026 09:00:00 +0000\r\n" +
+	"Message-ID: <contract-1@example.com>\r\n" +
+	"Disposition-Notification-To: Alice <alice@example.com>\r\n" +
+	"\r\n" +
+	"Please confirm.\r\n"
+
+func TestParseReceiptRequest(t *testing.T) {
+	req := ParseReceiptRequest([]byte(receiptRequest))
+	if req == nil {
+		t.Fatal("expected a receipt request")
+	}
+	if len(req.To) != 1 || req.To[0] != "alice@example.com" || req.Subject != "Vertrag unterzeichnet" || req.MessageID != "<contract-1@example.com>" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if req.NeedsConfirmation() {
+		t.Fatal("a request to the envelope sender should not need confirmation")
+	}
+
+	req.ReturnPath = "bounces@mailer.test"
+	if !req.NeedsConfirmation() {
+		t.Fatal("expected a request to another address to need confirmation")
+	}
+
+	if ParseReceiptRequest([]byte(strings.Replace(receiptRequest, "Disposition-Notification-To", "X-Other", 1))) != nil {
+		t.Fatal("expected no request without Disposition-Notification-To")
+	}
+}
+
+func TestBuildMDN(t *testing.T) {
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	raw, err := BuildMDN([]byte(receiptRequest), MDNInput{From: "Bob <bob@example.org>", FinalRecipient: "bob@example.org", Date: now})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	for _, want := range []string{
+		"To: alice@example.com\r\n",
+		"Subject: Read: Vertrag unterzeichnet\r\n",
+		"In-Reply-To: <contract-1@example.com>\r\n",
+		"Auto-Submitted: auto-replied\r\n",
+	} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("missing %q in:\n%s", want, raw)
+		}
+	}
+
+	mediaType, params, ok := MediaType(raw)
+	if !ok || mediaType != "multipart/report" || params["report-type"] != "disposition-notification" {
+		t.Fatalf("unexpected content type %q %v", mediaType, params)
+	}
+	parts, err := SplitMultipart(raw, params["boundary"])
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+	report := string(parts[1])
+	for _, want := range []string{
+		"Content-Type: message/disposition-notification\r\n",
+		"Final-Recipient: rfc822;bob@example.org\r\n",
+		"Original-Message-ID: <contract-1@example.com>\r\n",
+		"Disposition: manual-action/MDN-sent-manually; displayed\r\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("missing %q in report:\n%s", want, report)
+		}
+	}
+	if !strings.Contains(string(parts[2]), "text/rfc822-headers") || strings.Contains(string(parts[2]), "Please confirm.") {
+		t.Fatalf("expected only the original headers, got:\n%s", parts[2])
+	}
+
+	if _, err := BuildMDN([]byte("From: a@example.com\r\n\r\nhi\r\n"), MDNInput{From: "b@example.org", FinalRecipient: "b@example.org", Date: now}); err == nil {
+		t.Fatal("expected an error for a message without a receipt request")
+	}
+}
+
+func TestBuildMessageRequestsReceipt(t *testing.T) {
+	raw, err := BuildMessage(ComposeInput{From: "Alice <alice@example.com>", To: []string{"bob@example.org"}, Subject: "Contract", Body: "Signed.", ReceiptTo: "Alice <alice@example.com>"})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if req := ParseReceiptRequest(raw); req == nil || req.To[0] != "alice@example.com" {
+		t.Fatalf("expected a receipt request to alice, got:\n%s", raw)
+	}
+}
@@ -0,0 +1,78 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+)
+
+// CanonicalLineEndings converts line endings to CRLF, the form in which
+// signed MIME content is hashed.
+func CanonicalLineEndings(raw []byte) []byte {
+	return []byte(normalizeCRLF(string(raw)))
+}
+
+// MediaType parses the top-level Content-Type of a message or entity.
+func MediaType(raw []byte) (string, map[string]string, bool) {
+	header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return "", nil, false
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return "", nil, false
+	}
+	return mediaType, params, true
+}
+
+// SplitMultipart returns the raw bytes of each body part of a CRLF message.
+// The CRLF before a delimiter belongs to the delimiter, so parts are
+// byte-exact for signature checks.
+func SplitMultipart(raw []byte, boundary string) ([][]byte, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart message without boundary")
+	}
+	delim := []byte("\r\n--" + boundary)
+	// Start at the header/body separator so a delimiter on the first body
+	// line is preceded by CRLF too.
+	start := bytes.Index(raw, []byte("\r\n\r\n"))
+	if start < 0 {
+		return nil, errors.New("message has no body")
+	}
+	body := raw[start+2:]
+	i := bytes.Index(body, delim)
+	if i < 0 {
+		return nil, errors.New("multipart message has no parts")
+	}
+	body = body[i+len(delim):]
+	var parts [][]byte
+	for !bytes.HasPrefix(body, []byte("--")) {
+		nl := bytes.Index(body, []byte("\r\n"))
+		if nl < 0 {
+			return nil, errors.New("malformed multipart delimiter")
+		}
+		body = body[nl+2:]
+		i := bytes.Index(body, delim)
+		if i < 0 {
+			return nil, errors.New("multipart message is missing its closing delimiter")
+		}
+		parts = append(parts, body[:i])
+		body = body[i+len(delim):]
+	}
+	return parts, nil
+}
+
+// DecodePart returns the body of a MIME entity with its transfer encoding
+// undone.
+func DecodePart(part []byte) ([]byte, error) {
+	entity, err := message.Read(bytes.NewReader(part))
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return nil, err
+	}
+	return io.ReadAll(entity.Body)
+}
@@ -89,7 +89,7 @@ func BuildReplyHeaders(info *ReplyInfo) (string, string) {
 	return inReplyTo, refs
 }
 
-func BuildReplyRecipients(info *ReplyInfo, selfEmail string) []string {
+func BuildReplyRecipients(info *ReplyInfo, selfEmails ...string) []string {
 	if info == nil {
 		return nil
 	}
@@ -98,11 +98,11 @@ func BuildReplyRecipients(info *ReplyInfo, selfEmail string) []string {
 		replyAddress = info.From
 	}
 	toAddrs := parseEmailAddresses(replyAddress)
-	toAddrs = filterOutSelf(toAddrs, selfEmail)
+	toAddrs = filterOutSelf(toAddrs, selfEmails)
 	return deduplicateAddresses(toAddrs)
 }
 
-func BuildReplyAllRecipients(info *ReplyInfo, selfEmail string) (to, cc []string) {
+func BuildReplyAllRecipients(info *ReplyInfo, selfEmails ...string) (to, cc []string) {
 	if info == nil {
 		return nil, nil
 	}
@@ -112,10 +112,10 @@ func BuildReplyAllRecipients(info *ReplyInfo, selfEmail string) (to, cc []string
 	}
 	toAddrs := parseEmailAddresses(replyAddress)
 	toAddrs = append(toAddrs, info.To...)
-	toAddrs = filterOutSelf(toAddrs, selfEmail)
+	toAddrs = filterOutSelf(toAddrs, selfEmails)
 	toAddrs = deduplicateAddresses(toAddrs)
 
-	ccAddrs := filterOutSelf(info.Cc, selfEmail)
+	ccAddrs := filterOutSelf(info.Cc, selfEmails)
 	ccAddrs = deduplicateAddresses(ccAddrs)
 
 	toSet := make(map[string]bool)
@@ -269,11 +269,14 @@ func parseEmailAddressesFallback(header string) []string {
 	return result
 }
 
-func filterOutSelf(addresses []string, selfEmail string) []string {
-	selfLower := strings.ToLower(selfEmail)
+func filterOutSelf(addresses []string, selfEmails []string) []string {
+	self := make(map[string]bool, len(selfEmails))
+	for _, email := range selfEmails {
+		self[strings.ToLower(strings.TrimSpace(email))] = true
+	}
 	result := make([]string, 0, len(addresses))
 	for _, addr := range addresses {
-		if strings.ToLower(addr) != selfLower {
+		if !self[strings.ToLower(addr)] {
 			result = append(result, addr)
 		}
 	}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"bytes"
+	"strings"
+
+	gomail "github.com/emersion/go-message/mail"
+)
+
+type Signature struct {
+	Text string
+	HTML string
+}
+
+const signatureDelimiter = "-- \n"
+
+// AppendSignature adds sig to the plain body, and to the HTML body when there
+// is one (falling back to the escaped plain signature).
+func AppendSignature(plainBody, htmlBody string, sig Signature) (string, string) {
+	text := strings.Trim(strings.ReplaceAll(sig.Text, "\r\n", "\n"), "\n")
+	if text != "" {
+		if !strings.HasPrefix(text, "-- \n") && !strings.HasPrefix(text, "--\n") {
+			text = signatureDelimiter + text
+		}
+		plainBody = strings.TrimRight(plainBody, "\n")
+		if plainBody != "" {
+			plainBody += "\n\n"
+		}
+		plainBody += text + "\n"
+	}
+
+	if strings.TrimSpace(htmlBody) == "" {
+		return plainBody, htmlBody
+	}
+	sigHTML := strings.TrimSpace(sig.HTML)
+	if sigHTML == "" && text != "" {
+		sigHTML = escapeTextToHTML(text)
+	}
+	if sigHTML != "" {
+		htmlBody += `<br><div class="mailcli-signature">` + sigHTML + `</div>`
+	}
+	return plainBody, htmlBody
+}
+
+// ApplySignatureAndQuote adds the signature and reply quote in the requested
+// order: above places the signature between the new text and the quote.
+func ApplySignatureAndQuote(plainBody, htmlBody string, sig Signature, above, quote bool, info *ReplyInfo) (string, string) {
+	if above {
+		plainBody, htmlBody = AppendSignature(plainBody, htmlBody, sig)
+		return ApplyQuoteToBodies(plainBody, htmlBody, quote, info)
+	}
+	plainBody, htmlBody = ApplyQuoteToBodies(plainBody, htmlBody, quote, info)
+	return AppendSignature(plainBody, htmlBody, sig)
+}
+
+// ExtractSender returns the address in the message's From header.
+func ExtractSender(raw []byte) (string, error) {
+	reader, err := gomail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	list, err := reader.Header.AddressList("From")
+	if err != nil || len(list) == 0 {
+		return "", err
+	}
+	return list[0].Address, nil
+}
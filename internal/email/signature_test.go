@@ -0,0 +1,29 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplySignatureAndQuote(t *testing.T) {
+	info := &ReplyInfo{From: "Alice <alice@example.com>", Date: "Mon, 1 Jan 2024", Body: "original"}
+	sig := Signature{Text: "Bob\nExample Corp\n"}
+
+	plain, html := ApplySignatureAndQuote("Thanks!", "", sig, true, true, info)
+	if !strings.HasPrefix(plain, "Thanks!\n\n-- \nBob\nExample Corp\n") || !strings.Contains(plain, "> original") {
+		t.Fatalf("expected signature above quote, got %q", plain)
+	}
+	if strings.Index(html, "Example Corp") > strings.Index(html, "blockquote") {
+		t.Fatalf("expected html signature above quote, got %q", html)
+	}
+
+	plain, _ = ApplySignatureAndQuote("Thanks!", "", sig, false, true, info)
+	if strings.Index(plain, "-- \n") < strings.Index(plain, "> original") {
+		t.Fatalf("expected signature below quote, got %q", plain)
+	}
+
+	_, html = AppendSignature("Hi", "<p>Hi</p>", Signature{Text: "Bob", HTML: "<b>Bob</b>"})
+	if !strings.HasSuffix(html, `<div class="mailcli-signature"><b>Bob</b></div>`) {
+		t.Fatalf("expected html signature, got %q", html)
+	}
+}
@@ -0,0 +1,163 @@
+package imap
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+var ErrQuotaUnsupported = errors.New("imap server does not support QUOTA")
+
+type quotaClient interface {
+	Execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error)
+	Capability() (map[string]bool, error)
+}
+
+type getQuotaRootCommand struct {
+	Mailbox string
+}
+
+func (cmd *getQuotaRootCommand) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "GETQUOTAROOT",
+		Arguments: []interface{}{imap.FormatMailboxName(cmd.Mailbox)},
+	}
+}
+
+type quotaResponse struct {
+	Roots  []string
+	Quotas map[string][]QuotaResource
+}
+
+func (r *quotaResponse) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok {
+		return responses.ErrUnhandled
+	}
+	switch name {
+	case "QUOTAROOT":
+		// The first field is the mailbox name, the rest are quota roots.
+		for i, field := range fields {
+			if i == 0 {
+				continue
+			}
+			root, err := imap.ParseString(field)
+			if err != nil {
+				return err
+			}
+			r.Roots = append(r.Roots, root)
+		}
+		return nil
+	case "QUOTA":
+		if len(fields) < 2 {
+			return errors.New("imap: malformed QUOTA response")
+		}
+		root, err := imap.ParseString(fields[0])
+		if err != nil {
+			return err
+		}
+		list, ok := fields[1].([]interface{})
+		if !ok {
+			return errors.New("imap: malformed QUOTA resource list")
+		}
+		resources, err := parseQuotaResources(list)
+		if err != nil {
+			return err
+		}
+		if r.Quotas == nil {
+			r.Quotas = map[string][]QuotaResource{}
+		}
+		r.Quotas[root] = resources
+		return nil
+	default:
+		return responses.ErrUnhandled
+	}
+}
+
+func parseQuotaResources(fields []interface{}) ([]QuotaResource, error) {
+	if len(fields)%3 != 0 {
+		return nil, errors.New("imap: malformed QUOTA resource list")
+	}
+	resources := make([]QuotaResource, 0, len(fields)/3)
+	for i := 0; i < len(fields); i += 3 {
+		name, err := imap.ParseString(fields[i])
+		if err != nil {
+			return nil, err
+		}
+		usage, err := parseQuotaNumber(fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		limit, err := parseQuotaNumber(fields[i+2])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, QuotaResource{
+			Name:  strings.ToUpper(name),
+			Usage: usage,
+			Limit: limit,
+		})
+	}
+	return resources, nil
+}
+
+// parseQuotaNumber accepts 63-bit values as allowed by RFC 9208, which
+// imap.ParseNumber would reject.
+func parseQuotaNumber(f interface{}) (uint64, error) {
+	switch v := f.(type) {
+	case uint32:
+		return uint64(v), nil
+	case imap.RawString:
+		return strconv.ParseUint(string(v), 10, 63)
+	case string:
+		return strconv.ParseUint(v, 10, 63)
+	default:
+		return 0, errors.New("imap: quota value is not a number")
+	}
+}
+
+func supportsQuota(caps map[string]bool) bool {
+	for cap := range caps {
+		upper := strings.ToUpper(cap)
+		if upper == "QUOTA" || strings.HasPrefix(upper, "QUOTA=") {
+			return true
+		}
+	}
+	return false
+}
+
+func executeGetQuotaRoot(qc quotaClient, mailbox string) ([]QuotaRoot, error) {
+	res := &quotaResponse{}
+	status, err := qc.Execute(&getQuotaRootCommand{Mailbox: mailbox}, res)
+	if err != nil {
+		return nil, err
+	}
+	if statusErr := status.Err(); statusErr != nil {
+		return nil, statusErr
+	}
+
+	names := append([]string{}, res.Roots...)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	// Some servers send QUOTA responses for roots not listed in QUOTAROOT.
+	extra := []string{}
+	for name := range res.Quotas {
+		if !seen[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	names = append(names, extra...)
+
+	roots := make([]QuotaRoot, 0, len(names))
+	for _, name := range names {
+		roots = append(roots, QuotaRoot{Name: name, Resources: res.Quotas[name]})
+	}
+	return roots, nil
+}
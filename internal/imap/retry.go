@@ -0,0 +1,119 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"mailcli/internal/config"
+
+	"github.com/emersion/go-imap"
+)
+
+var ErrUIDValidityChanged = errors.New("mailbox UIDVALIDITY changed")
+
+const maxRetryDelay = 10 * time.Second
+
+// withRetry runs fn on a fresh connection, reconnecting and logging in again
+// after transient failures. It must only be used for idempotent operations;
+// fn is expected to select mailboxes through the guard so a retry never acts
+// on a mailbox whose UIDs have been reassigned.
+func (s *Service) withRetry(ctx context.Context, cfg config.Config, fn func(Client, *uidGuard) error) error {
+	guard := &uidGuard{}
+	attempts := cfg.IMAP.MaxRetries + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if sleepErr := s.sleep(ctx, retryDelay(cfg.IMAP.RetryBackoff, attempt)); sleepErr != nil {
+				return sleepErr
+			}
+		}
+		err = s.withClient(ctx, cfg, func(c Client) error {
+			return fn(c, guard)
+		})
+		if err == nil || ctx.Err() != nil || !isTransient(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
+
+func (s *Service) sleep(ctx context.Context, d time.Duration) error {
+	if s.Sleep != nil {
+		return s.Sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryDelay returns an exponential backoff with jitter in [d/2, d).
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base << (attempt - 1)
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrUIDValidityChanged) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	// Only a failed dial is safe to retry as such: a read timeout on a live
+	// connection may come after the server already ran the command.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	// go-imap reports dropped connections and BYE with unexported errors.
+	return strings.Contains(err.Error(), "imap: connection closed")
+}
+
+// uidGuard remembers the UIDVALIDITY seen on the first attempt of a retried
+// operation so later attempts can refuse to continue if it changed.
+type uidGuard struct {
+	validity map[string]uint32
+}
+
+func (g *uidGuard) selectMailbox(c Client, name string, readOnly bool) (*imap.MailboxStatus, error) {
+	status, err := c.Select(name, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	if g.validity == nil {
+		g.validity = map[string]uint32{}
+	}
+	if previous, ok := g.validity[name]; ok && status.UidValidity != previous {
+		return nil, fmt.Errorf("%w: %s was %d, now %d", ErrUIDValidityChanged, name, previous, status.UidValidity)
+	}
+	g.validity[name] = status.UidValidity
+	return status, nil
+}
@@ -2,17 +2,24 @@ package imap
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"mailcli/internal/config"
 	"mailcli/internal/email"
+	"mailcli/internal/tlsconfig"
+	"mailcli/internal/trace"
 
 	"github.com/emersion/go-imap"
 	imapclient "github.com/emersion/go-imap/client"
@@ -36,68 +43,196 @@ type Client interface {
 	Expunge(ch chan uint32) error
 }
 
+type capabilityClient interface {
+	Capability() (map[string]bool, error)
+}
+
 type Service struct {
-	Connector func(cfg config.Config) (Client, error)
+	Connector func(ctx context.Context, cfg config.Config) (Client, error)
+	// Sleep waits between retries; nil uses a timer that honours ctx.
+	Sleep func(ctx context.Context, d time.Duration) error
 }
 
 func NewService() *Service {
 	return &Service{Connector: Connect}
 }
 
-func Connect(cfg config.Config) (Client, error) {
-	addr := fmt.Sprintf("%s:%d", cfg.IMAP.Host, cfg.IMAP.Port)
-	var c *imapclient.Client
-	var err error
+// logoutTimeout bounds the LOGOUT sent when an operation is cancelled; after
+// it the connection is closed without waiting for the server.
+const logoutTimeout = 5 * time.Second
 
-	if cfg.IMAP.TLS {
-		tlsConfig := &tls.Config{
-			ServerName:         cfg.IMAP.Host,
-			InsecureSkipVerify: cfg.IMAP.InsecureSkipVerify,
-		}
-		c, err = imapclient.DialTLS(addr, tlsConfig)
-	} else {
-		c, err = imapclient.Dial(addr)
-		if err == nil && cfg.IMAP.StartTLS {
-			tlsConfig := &tls.Config{
-				ServerName:         cfg.IMAP.Host,
-				InsecureSkipVerify: cfg.IMAP.InsecureSkipVerify,
-			}
-			if err := c.StartTLS(tlsConfig); err != nil {
-				_ = c.Logout()
-				return nil, err
-			}
-		}
+func Connect(ctx context.Context, cfg config.Config) (Client, error) {
+	tlsConfig, err := tlsconfig.New(cfg.IMAP.TLSOptions, cfg.IMAP.Host, cfg.IMAP.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("imap: %w", err)
+	}
+
+	// The connect timeout covers dialing, TLS, the greeting and login.
+	connectCtx := ctx
+	if cfg.IMAP.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(ctx, cfg.IMAP.ConnectTimeout)
+		defer cancel()
 	}
+
+	c, err := dial(connectCtx, cfg, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
 
+	stop := context.AfterFunc(connectCtx, func() {
+		_ = c.Terminate()
+	})
 	if err := c.Login(cfg.Auth.Username, cfg.Auth.Password); err != nil {
+		stop()
 		_ = c.Logout()
+		return nil, connectError(connectCtx, cfg, err)
+	}
+	if !stop() {
+		return nil, connectError(connectCtx, cfg, connectCtx.Err())
+	}
+	return c, nil
+}
+
+// PeerCertificates connects to the IMAP server, negotiating TLS or STARTTLS
+// as configured, and returns the certificate chain it presents without
+// verifying it.
+func PeerCertificates(ctx context.Context, cfg config.Config) ([]*x509.Certificate, error) {
+	base, err := tlsconfig.New(cfg.IMAP.TLSOptions, cfg.IMAP.Host, cfg.IMAP.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("imap: %w", err)
+	}
+	if !cfg.IMAP.TLS && !cfg.IMAP.StartTLS {
+		return nil, fmt.Errorf("imap: neither tls nor starttls is enabled")
+	}
+	tlsConfig, state := tlsconfig.Capture(base)
+
+	connectCtx := ctx
+	if cfg.IMAP.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(ctx, cfg.IMAP.ConnectTimeout)
+		defer cancel()
+	}
+	c, err := dial(connectCtx, cfg, tlsConfig)
+	if err != nil {
 		return nil, err
 	}
+	logout(c)
+	return state.PeerCertificates, nil
+}
+
+// dial opens the connection, reads the greeting and negotiates STARTTLS, but
+// does not log in.
+func dial(connectCtx context.Context, cfg config.Config, tlsConfig *tls.Config) (*imapclient.Client, error) {
+	addr := net.JoinHostPort(cfg.IMAP.Host, strconv.Itoa(cfg.IMAP.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(connectCtx, "tcp", addr)
+	if err != nil {
+		return nil, connectError(connectCtx, cfg, err)
+	}
+	if cfg.IMAP.TLS {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(connectCtx); err != nil {
+			_ = conn.Close()
+			return nil, connectError(connectCtx, cfg, err)
+		}
+		conn = tlsConn
+	}
+
+	// imapclient.New reads the greeting before Client.Timeout applies.
+	if deadline, ok := connectCtx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := imapclient.New(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, connectError(connectCtx, cfg, err)
+	}
+	c.Timeout = cfg.IMAP.CommandTimeout
+	enableTrace(c)
 
+	if !cfg.IMAP.TLS && cfg.IMAP.StartTLS {
+		stop := context.AfterFunc(connectCtx, func() {
+			_ = c.Terminate()
+		})
+		err := c.StartTLS(tlsConfig)
+		if !stop() {
+			return nil, connectError(connectCtx, cfg, connectCtx.Err())
+		}
+		if err != nil {
+			_ = c.Logout()
+			return nil, connectError(connectCtx, cfg, err)
+		}
+	}
 	return c, nil
 }
 
-func (s *Service) withClient(cfg config.Config, fn func(Client) error) error {
+func connectError(ctx context.Context, cfg config.Config, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("imap: connecting to %s timed out after %s", cfg.IMAP.Host, cfg.IMAP.ConnectTimeout)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func enableTrace(c *imapclient.Client) {
+	client, server := trace.IMAPWriters()
+	if client == nil {
+		return
+	}
+	c.SetDebug(imap.NewDebugWriter(client, server))
+}
+
+func (s *Service) withClient(ctx context.Context, cfg config.Config, fn func(Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	connector := s.Connector
 	if connector == nil {
 		connector = Connect
 	}
-	client, err := connector(cfg)
+	client, err := connector(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = client.Logout()
+
+	// On cancellation, log out right away so the in-flight command is
+	// aborted and the server sees a clean end of session.
+	loggedOut := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		logout(client)
+		close(loggedOut)
+	})
+
+	err = fn(client)
+	if !stop() {
+		<-loggedOut
+		return ctx.Err()
+	}
+	_ = client.Logout()
+	return err
+}
+
+func logout(c Client) {
+	done := make(chan struct{})
+	go func() {
+		_ = c.Logout()
+		close(done)
 	}()
-	return fn(client)
+	select {
+	case <-done:
+	case <-time.After(logoutTimeout):
+		if t, ok := c.(interface{ Terminate() error }); ok {
+			_ = t.Terminate()
+		}
+	}
 }
 
-func (s *Service) Status(cfg config.Config, mailbox string) (*imap.MailboxStatus, error) {
+func (s *Service) Status(ctx context.Context, cfg config.Config, mailbox string) (*imap.MailboxStatus, error) {
 	var status *imap.MailboxStatus
-	err := s.withClient(cfg, func(c Client) error {
+	err := s.withRetry(ctx, cfg, func(c Client, _ *uidGuard) error {
 		mb, err := c.Status(mailbox, []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen})
 		if err != nil {
 			return err
@@ -108,49 +243,164 @@ func (s *Service) Status(cfg config.Config, mailbox string) (*imap.MailboxStatus
 	return status, err
 }
 
-func (s *Service) ListMailboxes(cfg config.Config) ([]string, error) {
+// statusSize is the RFC 8438 STATUS=SIZE item, which go-imap does not define.
+const statusSize imap.StatusItem = "SIZE"
+
+// MailboxStats reports on the given mailboxes, or every selectable mailbox
+// when none are given, and on the quota roots they belong to, over one
+// connection.
+func (s *Service) MailboxStats(ctx context.Context, cfg config.Config, mailboxes []string) (AccountStatus, error) {
+	var status AccountStatus
+	err := s.withRetry(ctx, cfg, func(c Client, _ *uidGuard) error {
+		status = AccountStatus{}
+		names := mailboxes
+		if len(names) == 0 {
+			infos, err := listMailboxInfo(c)
+			if err != nil {
+				return err
+			}
+			for _, info := range infos {
+				if !isSelectable(info) {
+					continue
+				}
+				names = append(names, info.Name)
+			}
+		}
+
+		var caps map[string]bool
+		if cc, ok := c.(capabilityClient); ok {
+			var err error
+			if caps, err = cc.Capability(); err != nil {
+				return err
+			}
+		}
+		withSize := hasCapability(caps, "STATUS=SIZE")
+
+		items := []imap.StatusItem{
+			imap.StatusMessages,
+			imap.StatusUnseen,
+			imap.StatusRecent,
+			imap.StatusUidNext,
+			imap.StatusUidValidity,
+		}
+		if withSize {
+			items = append(items, statusSize)
+		}
+
+		for _, name := range names {
+			mb, err := c.Status(name, items)
+			if err != nil {
+				return fmt.Errorf("status %s: %w", name, err)
+			}
+			entry := MailboxStats{
+				Name:        name,
+				Messages:    mb.Messages,
+				Unseen:      mb.Unseen,
+				Recent:      mb.Recent,
+				UIDNext:     mb.UidNext,
+				UIDValidity: mb.UidValidity,
+			}
+			if value, ok := mb.Items[statusSize]; ok && value != nil {
+				size, err := parseQuotaNumber(value)
+				if err != nil {
+					return fmt.Errorf("status %s: invalid SIZE: %w", name, err)
+				}
+				entry.Size = size
+				entry.HasSize = true
+			}
+			status.Mailboxes = append(status.Mailboxes, entry)
+		}
+
+		qc, ok := c.(quotaClient)
+		if !ok || !supportsQuota(caps) {
+			return nil
+		}
+		status.QuotaSupported = true
+		// Mailboxes can belong to different quota roots; list each root once.
+		seen := map[string]bool{}
+		for i, name := range names {
+			roots, err := executeGetQuotaRoot(qc, name)
+			if err != nil {
+				return fmt.Errorf("quota %s: %w", name, err)
+			}
+			for _, root := range roots {
+				status.Mailboxes[i].QuotaRoots = append(status.Mailboxes[i].QuotaRoots, root.Name)
+				if !seen[root.Name] {
+					seen[root.Name] = true
+					status.Quota = append(status.Quota, root)
+				}
+			}
+		}
+		return nil
+	})
+	return status, err
+}
+
+func (s *Service) ListMailboxes(ctx context.Context, cfg config.Config) ([]string, error) {
 	mailboxes := []string{}
-	err := s.withClient(cfg, func(c Client) error {
-		ch := make(chan *imap.MailboxInfo, 10)
-		done := make(chan error, 1)
-		go func() {
-			done <- c.List("", "*", ch)
-		}()
-		for mbox := range ch {
-			mailboxes = append(mailboxes, mbox.Name)
+	err := s.withRetry(ctx, cfg, func(c Client, _ *uidGuard) error {
+		mailboxes = mailboxes[:0]
+		infos, err := listMailboxInfo(c)
+		if err != nil {
+			return err
 		}
-		return <-done
+		for _, info := range infos {
+			mailboxes = append(mailboxes, info.Name)
+		}
+		return nil
 	})
 	return mailboxes, err
 }
 
-func (s *Service) CreateMailbox(cfg config.Config, name string) error {
-	return s.withClient(cfg, func(c Client) error {
+func listMailboxInfo(c Client) ([]*imap.MailboxInfo, error) {
+	infos := []*imap.MailboxInfo{}
+	ch := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", ch)
+	}()
+	for mbox := range ch {
+		infos = append(infos, mbox)
+	}
+	return infos, <-done
+}
+
+func isSelectable(info *imap.MailboxInfo) bool {
+	for _, attr := range info.Attributes {
+		if strings.EqualFold(attr, imap.NoSelectAttr) || strings.EqualFold(attr, "\\NonExistent") {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) CreateMailbox(ctx context.Context, cfg config.Config, name string) error {
+	return s.withClient(ctx, cfg, func(c Client) error {
 		return c.Create(name)
 	})
 }
 
-func (s *Service) ListMessages(cfg config.Config, mailbox string, page, pageSize int) ([]MessageSummary, int, error) {
-	return s.listMessagesWithCriteria(cfg, mailbox, nil, page, pageSize)
+func (s *Service) ListMessages(ctx context.Context, cfg config.Config, mailbox string, page, pageSize int) ([]MessageSummary, int, error) {
+	return s.listMessagesWithCriteria(ctx, cfg, mailbox, nil, page, pageSize)
 }
 
-func (s *Service) SearchMessages(cfg config.Config, mailbox, query string, page, pageSize int) ([]MessageSummary, int, error) {
+func (s *Service) SearchMessages(ctx context.Context, cfg config.Config, mailbox, query string, page, pageSize int) ([]MessageSummary, int, error) {
 	criteria := imap.NewSearchCriteria()
 	criteria.Text = []string{query}
-	return s.listMessagesWithCriteria(cfg, mailbox, criteria, page, pageSize)
+	return s.listMessagesWithCriteria(ctx, cfg, mailbox, criteria, page, pageSize)
 }
 
-func (s *Service) ListThreads(cfg config.Config, mailbox string, page, pageSize int) ([]ThreadSummary, int, error) {
-	return s.listThreadsWithCriteria(cfg, mailbox, nil, page, pageSize)
+func (s *Service) ListThreads(ctx context.Context, cfg config.Config, mailbox string, page, pageSize int) ([]ThreadSummary, int, error) {
+	return s.listThreadsWithCriteria(ctx, cfg, mailbox, nil, page, pageSize)
 }
 
-func (s *Service) SearchThreads(cfg config.Config, mailbox, query string, page, pageSize int) ([]ThreadSummary, int, error) {
+func (s *Service) SearchThreads(ctx context.Context, cfg config.Config, mailbox, query string, page, pageSize int) ([]ThreadSummary, int, error) {
 	criteria := imap.NewSearchCriteria()
 	criteria.Text = []string{query}
-	return s.listThreadsWithCriteria(cfg, mailbox, criteria, page, pageSize)
+	return s.listThreadsWithCriteria(ctx, cfg, mailbox, criteria, page, pageSize)
 }
 
-func (s *Service) listMessagesWithCriteria(cfg config.Config, mailbox string, criteria *imap.SearchCriteria, page, pageSize int) ([]MessageSummary, int, error) {
+func (s *Service) listMessagesWithCriteria(ctx context.Context, cfg config.Config, mailbox string, criteria *imap.SearchCriteria, page, pageSize int) ([]MessageSummary, int, error) {
 	var messages []MessageSummary
 	var total int
 
@@ -161,8 +411,9 @@ func (s *Service) listMessagesWithCriteria(cfg config.Config, mailbox string, cr
 		pageSize = 20
 	}
 
-	err := s.withClient(cfg, func(c Client) error {
-		if _, err := c.Select(mailbox, true); err != nil {
+	err := s.withRetry(ctx, cfg, func(c Client, guard *uidGuard) error {
+		messages = nil
+		if _, err := guard.selectMailbox(c, mailbox, true); err != nil {
 			return err
 		}
 
@@ -226,7 +477,7 @@ func (s *Service) listMessagesWithCriteria(cfg config.Config, mailbox string, cr
 	return messages, total, err
 }
 
-func (s *Service) listThreadsWithCriteria(cfg config.Config, mailbox string, criteria *imap.SearchCriteria, page, pageSize int) ([]ThreadSummary, int, error) {
+func (s *Service) listThreadsWithCriteria(ctx context.Context, cfg config.Config, mailbox string, criteria *imap.SearchCriteria, page, pageSize int) ([]ThreadSummary, int, error) {
 	var threads []ThreadSummary
 	var total int
 
@@ -237,8 +488,9 @@ func (s *Service) listThreadsWithCriteria(cfg config.Config, mailbox string, cri
 		pageSize = 20
 	}
 
-	err := s.withClient(cfg, func(c Client) error {
-		if _, err := c.Select(mailbox, true); err != nil {
+	err := s.withRetry(ctx, cfg, func(c Client, guard *uidGuard) error {
+		threads = nil
+		if _, err := guard.selectMailbox(c, mailbox, true); err != nil {
 			return err
 		}
 
@@ -339,17 +591,18 @@ func (s *Service) listThreadsWithCriteria(cfg config.Config, mailbox string, cri
 	return threads, total, err
 }
 
-func (s *Service) ReadMessage(cfg config.Config, mailbox string, uid uint32) (MessageDetail, error) {
+func (s *Service) ReadMessage(ctx context.Context, cfg config.Config, mailbox string, uid uint32) (MessageDetail, error) {
 	detail := MessageDetail{}
-	err := s.withClient(cfg, func(c Client) error {
-		if _, err := c.Select(mailbox, true); err != nil {
+	err := s.withRetry(ctx, cfg, func(c Client, guard *uidGuard) error {
+		detail = MessageDetail{}
+		if _, err := guard.selectMailbox(c, mailbox, true); err != nil {
 			return err
 		}
 
 		seqset := new(imap.SeqSet)
 		seqset.AddNum(uid)
 		section := &imap.BodySectionName{}
-		items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, section.FetchItem()}
+		items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, imap.FetchFlags, section.FetchItem()}
 		ch := make(chan *imap.Message, 1)
 		done := make(chan error, 1)
 		go func() {
@@ -364,6 +617,7 @@ func (s *Service) ReadMessage(cfg config.Config, mailbox string, uid uint32) (Me
 		}
 
 		detail.UID = msg.Uid
+		detail.Flags = msg.Flags
 		if msg.Envelope != nil {
 			detail.Subject = msg.Envelope.Subject
 			detail.From = formatIMAPAddresses(msg.Envelope.From)
@@ -376,50 +630,19 @@ func (s *Service) ReadMessage(cfg config.Config, mailbox string, uid uint32) (Me
 		if body == nil {
 			return fmt.Errorf("message body not available")
 		}
-		reader, err := mail.CreateReader(body)
+		raw, err := io.ReadAll(body)
 		if err != nil {
 			return err
 		}
-
-		var htmlBody string
-		for {
-			part, err := reader.NextPart()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return err
-			}
-			switch header := part.Header.(type) {
-			case *mail.InlineHeader:
-				contentType, _, _ := header.ContentType()
-				if strings.HasPrefix(contentType, "text/plain") && detail.TextBody == "" {
-					data, err := io.ReadAll(part.Body)
-					if err != nil {
-						return err
-					}
-					detail.TextBody = string(data)
-				}
-				if strings.HasPrefix(contentType, "text/html") && htmlBody == "" {
-					data, err := io.ReadAll(part.Body)
-					if err != nil {
-						return err
-					}
-					htmlBody = string(data)
-				}
-			case *mail.AttachmentHeader:
-				filename, err := header.Filename()
-				if err != nil {
-					continue
-				}
-				detail.Attachments = append(detail.Attachments, filename)
-			}
-		}
-
-		detail.HTMLBody = htmlBody
-		if detail.TextBody == "" && htmlBody != "" {
-			detail.TextBody = email.StripHTMLTags(htmlBody)
+		parsed, err := email.ParseBody(raw)
+		if err != nil {
+			return err
 		}
+		detail.Raw = raw
+		detail.TextBody = parsed.Text
+		detail.HTMLBody = parsed.HTML
+		detail.Attachments = parsed.Attachments
+		detail.Calendar = parsed.Calendar
 
 		return nil
 	})
@@ -427,10 +650,10 @@ func (s *Service) ReadMessage(cfg config.Config, mailbox string, uid uint32) (Me
 	return detail, err
 }
 
-func (s *Service) FetchRawMessage(cfg config.Config, mailbox string, uid uint32) ([]byte, error) {
+func (s *Service) FetchRawMessage(ctx context.Context, cfg config.Config, mailbox string, uid uint32) ([]byte, error) {
 	var raw []byte
-	err := s.withClient(cfg, func(c Client) error {
-		if _, err := c.Select(mailbox, true); err != nil {
+	err := s.withRetry(ctx, cfg, func(c Client, guard *uidGuard) error {
+		if _, err := guard.selectMailbox(c, mailbox, true); err != nil {
 			return err
 		}
 
@@ -465,8 +688,77 @@ func (s *Service) FetchRawMessage(cfg config.Config, mailbox string, uid uint32)
 	return raw, err
 }
 
-func (s *Service) DeleteMessage(cfg config.Config, mailbox string, uid uint32) error {
-	return s.withClient(cfg, func(c Client) error {
+// FetchMatching returns the full content of messages received since the
+// given day whose headers match any of the hints. Bodies are fetched with
+// BODY.PEEK, so the messages stay unread.
+func (s *Service) FetchMatching(ctx context.Context, cfg config.Config, mailbox string, since time.Time, hints []HeaderMatch) ([]RawMessage, error) {
+	var messages []RawMessage
+	err := s.withRetry(ctx, cfg, func(c Client, guard *uidGuard) error {
+		messages = nil
+		if _, err := guard.selectMailbox(c, mailbox, true); err != nil {
+			return err
+		}
+
+		criteria := anyHeader(hints)
+		criteria.Since = since
+		uids, err := c.UidSearch(criteria)
+		if err != nil {
+			return err
+		}
+		if len(uids) == 0 {
+			return nil
+		}
+
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(uids...)
+		section := &imap.BodySectionName{Peek: true}
+		items := []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, section.FetchItem()}
+		ch := make(chan *imap.Message, len(uids))
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidFetch(seqset, items, ch)
+		}()
+		var readErr error
+		for msg := range ch {
+			body := msg.GetBody(section)
+			if body == nil || readErr != nil {
+				continue
+			}
+			raw, err := io.ReadAll(body)
+			if err != nil {
+				readErr = err
+				continue
+			}
+			messages = append(messages, RawMessage{UID: msg.Uid, Date: msg.InternalDate, Raw: raw})
+		}
+		if err := <-done; err != nil {
+			return err
+		}
+		return readErr
+	})
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].UID > messages[j].UID })
+	return messages, err
+}
+
+// anyHeader builds a search for messages matching any of the hints, nesting
+// the two-operand IMAP OR.
+func anyHeader(hints []HeaderMatch) *imap.SearchCriteria {
+	criteria := imap.NewSearchCriteria()
+	if len(hints) == 0 {
+		return criteria
+	}
+	criteria.Header.Add(hints[0].Field, hints[0].Value)
+	if len(hints) == 1 {
+		return criteria
+	}
+	or := imap.NewSearchCriteria()
+	or.Or = [][2]*imap.SearchCriteria{{criteria, anyHeader(hints[1:])}}
+	return or
+}
+
+func (s *Service) DeleteMessage(ctx context.Context, cfg config.Config, mailbox string, uid uint32) error {
+	return s.withClient(ctx, cfg, func(c Client) error {
 		if _, err := c.Select(mailbox, false); err != nil {
 			return err
 		}
@@ -487,8 +779,8 @@ func (s *Service) DeleteMessage(cfg config.Config, mailbox string, uid uint32) e
 	})
 }
 
-func (s *Service) MoveMessage(cfg config.Config, mailbox string, uid uint32, dest string) error {
-	return s.withClient(cfg, func(c Client) error {
+func (s *Service) MoveMessage(ctx context.Context, cfg config.Config, mailbox string, uid uint32, dest string) error {
+	return s.withClient(ctx, cfg, func(c Client) error {
 		if _, err := c.Select(mailbox, false); err != nil {
 			return err
 		}
@@ -515,8 +807,8 @@ func (s *Service) MoveMessage(cfg config.Config, mailbox string, uid uint32, des
 	})
 }
 
-func (s *Service) AddTag(cfg config.Config, mailbox string, uid uint32, tag string) error {
-	return s.withClient(cfg, func(c Client) error {
+func (s *Service) AddTag(ctx context.Context, cfg config.Config, mailbox string, uid uint32, tag string) error {
+	return s.withClient(ctx, cfg, func(c Client) error {
 		if _, err := c.Select(mailbox, false); err != nil {
 			return err
 		}
@@ -527,14 +819,21 @@ func (s *Service) AddTag(cfg config.Config, mailbox string, uid uint32, tag stri
 	})
 }
 
-func (s *Service) SaveDraft(cfg config.Config, mailbox string, raw []byte) error {
-	return s.withClient(cfg, func(c Client) error {
+func (s *Service) SaveDraft(ctx context.Context, cfg config.Config, mailbox string, raw []byte) error {
+	return s.withClient(ctx, cfg, func(c Client) error {
 		return c.Append(mailbox, []string{}, time.Now(), bytes.NewReader(raw))
 	})
 }
 
-func (s *Service) DownloadAttachments(cfg config.Config, mailbox string, uid uint32, dir string) ([]string, error) {
-	raw, err := s.FetchRawMessage(cfg, mailbox, uid)
+// SaveSent files a copy of a sent message, marked as read.
+func (s *Service) SaveSent(ctx context.Context, cfg config.Config, mailbox string, raw []byte) error {
+	return s.withClient(ctx, cfg, func(c Client) error {
+		return c.Append(mailbox, []string{imap.SeenFlag}, time.Now(), bytes.NewReader(raw))
+	})
+}
+
+func (s *Service) DownloadAttachments(ctx context.Context, cfg config.Config, mailbox string, uid uint32, dir string) ([]string, error) {
+	raw, err := s.FetchRawMessage(ctx, cfg, mailbox, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -600,6 +899,15 @@ func maxUID(uids []uint32) uint32 {
 	return max
 }
 
+func hasCapability(caps map[string]bool, name string) bool {
+	for cap, ok := range caps {
+		if ok && strings.EqualFold(cap, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func formatIMAPAddresses(addrs []*imap.Address) string {
 	if len(addrs) == 0 {
 		return ""
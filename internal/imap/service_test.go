@@ -1,17 +1,27 @@
 package imap
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"mailcli/internal/config"
 
 	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
 )
 
 type mockClient struct {
 	listNames []string
+	listAttrs map[string][]string
+	statuses  map[string]*imap.MailboxStatus
 	loggedOut bool
 }
 
@@ -25,11 +35,14 @@ func (m *mockClient) Select(name string, readOnly bool) (*imap.MailboxStatus, er
 	return &imap.MailboxStatus{Name: name}, nil
 }
 func (m *mockClient) Status(name string, items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	if status, ok := m.statuses[name]; ok {
+		return status, nil
+	}
 	return &imap.MailboxStatus{Name: name}, nil
 }
 func (m *mockClient) List(ref, name string, ch chan *imap.MailboxInfo) error {
 	for _, mailbox := range m.listNames {
-		ch <- &imap.MailboxInfo{Name: mailbox}
+		ch <- &imap.MailboxInfo{Name: mailbox, Attributes: m.listAttrs[mailbox]}
 	}
 	close(ch)
 	return nil
@@ -59,11 +72,11 @@ func (m *mockClient) Expunge(ch chan uint32) error {
 
 func TestListMailboxesWithMock(t *testing.T) {
 	mock := &mockClient{listNames: []string{"INBOX", "Archive"}}
-	svc := &Service{Connector: func(cfg config.Config) (Client, error) {
+	svc := &Service{Connector: func(ctx context.Context, cfg config.Config) (Client, error) {
 		return mock, nil
 	}}
 
-	mailboxes, err := svc.ListMailboxes(config.Config{})
+	mailboxes, err := svc.ListMailboxes(context.Background(), config.Config{})
 	if err != nil {
 		t.Fatalf("list mailboxes: %v", err)
 	}
@@ -77,3 +90,371 @@ func TestListMailboxesWithMock(t *testing.T) {
 		t.Fatalf("expected logout to be called")
 	}
 }
+
+func TestMailboxStatsSkipsNoSelect(t *testing.T) {
+	mock := &mockClient{
+		listNames: []string{"INBOX", "[Gmail]", "Archive"},
+		listAttrs: map[string][]string{"[Gmail]": {imap.NoSelectAttr}},
+		statuses: map[string]*imap.MailboxStatus{
+			"INBOX": {Name: "INBOX", Messages: 10, Unseen: 2, UidNext: 11, UidValidity: 7},
+		},
+	}
+	svc := &Service{Connector: func(ctx context.Context, cfg config.Config) (Client, error) {
+		return mock, nil
+	}}
+
+	status, err := svc.MailboxStats(context.Background(), config.Config{}, nil)
+	if err != nil {
+		t.Fatalf("mailbox stats: %v", err)
+	}
+	stats := status.Mailboxes
+	if len(stats) != 2 || stats[0].Name != "INBOX" || stats[1].Name != "Archive" {
+		t.Fatalf("unexpected mailboxes: %+v", stats)
+	}
+	if stats[0].Messages != 10 || stats[0].Unseen != 2 || stats[0].UIDNext != 11 || stats[0].UIDValidity != 7 {
+		t.Fatalf("unexpected INBOX stats: %+v", stats[0])
+	}
+	if stats[0].HasSize {
+		t.Fatalf("expected no size without STATUS=SIZE")
+	}
+	if status.QuotaSupported {
+		t.Fatalf("expected no quota without the QUOTA capability")
+	}
+}
+
+// quotaMockClient answers GETQUOTAROOT with the root of each mailbox.
+type quotaMockClient struct {
+	mockClient
+	roots    map[string]string
+	connects int
+}
+
+func (q *quotaMockClient) Capability() (map[string]bool, error) {
+	return map[string]bool{"IMAP4rev1": true, "QUOTA": true}, nil
+}
+
+func (q *quotaMockClient) Execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	cmd := cmdr.Command()
+	mailbox := fmt.Sprint(cmd.Arguments[0])
+	root := q.roots[mailbox]
+	for _, fields := range [][]interface{}{
+		{"QUOTAROOT", mailbox, root},
+		{"QUOTA", root, []interface{}{"STORAGE", "512", "1024"}},
+	} {
+		if err := h.Handle(&imap.DataResp{Fields: fields}); err != nil {
+			return nil, err
+		}
+	}
+	return &imap.StatusResp{Type: imap.StatusRespOk}, nil
+}
+
+func TestMailboxStatsIncludesQuotaRoots(t *testing.T) {
+	client := &quotaMockClient{roots: map[string]string{"INBOX": "user", "Archive": "user", "Shared": "shared"}}
+	svc := &Service{Connector: func(ctx context.Context, cfg config.Config) (Client, error) {
+		client.connects++
+		return client, nil
+	}}
+
+	status, err := svc.MailboxStats(context.Background(), config.Config{}, []string{"INBOX", "Archive", "Shared"})
+	if err != nil {
+		t.Fatalf("mailbox stats: %v", err)
+	}
+	if client.connects != 1 {
+		t.Fatalf("expected one connection, got %d", client.connects)
+	}
+	if !status.QuotaSupported || len(status.Quota) != 2 || status.Quota[0].Name != "user" || status.Quota[1].Name != "shared" {
+		t.Fatalf("expected each quota root once, got %+v", status.Quota)
+	}
+	if roots := status.Mailboxes[2].QuotaRoots; len(roots) != 1 || roots[0] != "shared" {
+		t.Fatalf("unexpected quota roots for Shared: %v", roots)
+	}
+}
+
+func TestQuotaResponseHandle(t *testing.T) {
+	res := &quotaResponse{}
+	root := &imap.DataResp{Fields: []interface{}{"QUOTAROOT", "INBOX", ""}}
+	quota := &imap.DataResp{Fields: []interface{}{"QUOTA", "", []interface{}{"STORAGE", "512", "1024", "MESSAGE", "9", "0"}}}
+	if err := res.Handle(root); err != nil {
+		t.Fatalf("handle QUOTAROOT: %v", err)
+	}
+	if err := res.Handle(quota); err != nil {
+		t.Fatalf("handle QUOTA: %v", err)
+	}
+
+	if len(res.Roots) != 1 || res.Roots[0] != "" {
+		t.Fatalf("unexpected roots: %v", res.Roots)
+	}
+	resources := res.Quotas[""]
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	if resources[0].Name != "STORAGE" || resources[0].Percent() != 50 {
+		t.Fatalf("unexpected storage resource: %+v", resources[0])
+	}
+	if resources[1].Percent() != 0 {
+		t.Fatalf("expected unlimited resource to report 0%%, got %v", resources[1].Percent())
+	}
+}
+
+type blockingClient struct {
+	mockClient
+	fetching  chan struct{}
+	loggedOut chan struct{}
+}
+
+func (b *blockingClient) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
+	return []uint32{1}, nil
+}
+
+func (b *blockingClient) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	defer close(ch)
+	close(b.fetching)
+	<-b.loggedOut
+	return errors.New("connection closed")
+}
+
+func (b *blockingClient) Logout() error {
+	close(b.loggedOut)
+	return nil
+}
+
+func TestCancelLogsOutDuringFetch(t *testing.T) {
+	mock := &blockingClient{fetching: make(chan struct{}), loggedOut: make(chan struct{})}
+	svc := &Service{Connector: func(ctx context.Context, cfg config.Config) (Client, error) {
+		return mock, nil
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-mock.fetching
+		cancel()
+	}()
+
+	_, _, err := svc.ListMessages(ctx, config.Config{}, "INBOX", 1, 20)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-mock.loggedOut:
+	default:
+		t.Fatalf("expected logout on cancellation")
+	}
+}
+
+type flakyClient struct {
+	mockClient
+	validity   uint32
+	listErr    error
+	searchErr  error
+	storeErr   error
+	expungeErr error
+}
+
+func (f *flakyClient) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	return &imap.MailboxStatus{Name: name, UidValidity: f.validity}, nil
+}
+
+func (f *flakyClient) List(ref, name string, ch chan *imap.MailboxInfo) error {
+	if f.listErr != nil {
+		close(ch)
+		return f.listErr
+	}
+	return f.mockClient.List(ref, name, ch)
+}
+
+func (f *flakyClient) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
+	return nil, f.searchErr
+}
+
+func (f *flakyClient) UidStore(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
+	return f.storeErr
+}
+
+func (f *flakyClient) Expunge(ch chan uint32) error {
+	if f.expungeErr != nil {
+		close(ch)
+		return f.expungeErr
+	}
+	return f.mockClient.Expunge(ch)
+}
+
+func sequenceService(clients ...Client) (*Service, *int, *[]time.Duration) {
+	connects := 0
+	var delays []time.Duration
+	svc := &Service{
+		Connector: func(ctx context.Context, cfg config.Config) (Client, error) {
+			c := clients[connects]
+			connects++
+			return c, nil
+		},
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	}
+	return svc, &connects, &delays
+}
+
+func TestRetryReconnectsAfterDroppedConnection(t *testing.T) {
+	first := &flakyClient{listErr: io.ErrUnexpectedEOF}
+	second := &flakyClient{mockClient: mockClient{listNames: []string{"INBOX"}}}
+	svc, connects, delays := sequenceService(first, second)
+	cfg := config.Config{IMAP: config.IMAPConfig{MaxRetries: 2, RetryBackoff: 100 * time.Millisecond}}
+
+	mailboxes, err := svc.ListMailboxes(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("list mailboxes: %v", err)
+	}
+	if len(mailboxes) != 1 || mailboxes[0] != "INBOX" {
+		t.Fatalf("unexpected mailboxes: %v", mailboxes)
+	}
+	if *connects != 2 {
+		t.Fatalf("expected 2 connections, got %d", *connects)
+	}
+	if len(*delays) != 1 || (*delays)[0] < 50*time.Millisecond || (*delays)[0] > 100*time.Millisecond {
+		t.Fatalf("unexpected backoff: %v", *delays)
+	}
+}
+
+func TestRetryStopsWhenUIDValidityChanges(t *testing.T) {
+	first := &flakyClient{validity: 1, searchErr: io.EOF}
+	second := &flakyClient{validity: 2}
+	svc, connects, _ := sequenceService(first, second)
+	cfg := config.Config{IMAP: config.IMAPConfig{MaxRetries: 3}}
+
+	_, _, err := svc.ListMessages(context.Background(), cfg, "INBOX", 1, 20)
+	if !errors.Is(err, ErrUIDValidityChanged) {
+		t.Fatalf("expected UIDVALIDITY error, got %v", err)
+	}
+	if *connects != 2 {
+		t.Fatalf("expected 2 connections, got %d", *connects)
+	}
+}
+
+func TestRetrySkipsPermanentAndNonIdempotentErrors(t *testing.T) {
+	cfg := config.Config{IMAP: config.IMAPConfig{MaxRetries: 3}}
+
+	svc, connects, _ := sequenceService(&flakyClient{searchErr: errors.New("Mailbox does not exist")})
+	if _, _, err := svc.ListMessages(context.Background(), cfg, "Missing", 1, 20); err == nil {
+		t.Fatalf("expected search error")
+	}
+	if *connects != 1 {
+		t.Fatalf("expected permanent error not to be retried, got %d connections", *connects)
+	}
+
+	svc, connects, _ = sequenceService(&flakyClient{expungeErr: io.EOF})
+	if err := svc.DeleteMessage(context.Background(), cfg, "INBOX", 1); err == nil {
+		t.Fatalf("expected expunge error")
+	}
+	if *connects != 1 {
+		t.Fatalf("expected expunge not to be retried, got %d connections", *connects)
+	}
+}
+
+func TestRetryOnlyOnDialErrors(t *testing.T) {
+	cfg := config.Config{IMAP: config.IMAPConfig{MaxRetries: 3}}
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+
+	svc, connects, _ := sequenceService(&flakyClient{storeErr: timeout})
+	if err := svc.AddTag(context.Background(), cfg, "INBOX", 1, "$Label1"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected store timeout, got %v", err)
+	}
+	if *connects != 1 {
+		t.Fatalf("expected a timed-out STORE not to be retried, got %d connections", *connects)
+	}
+
+	svc, connects, _ = sequenceService(&flakyClient{searchErr: timeout})
+	if _, _, err := svc.ListMessages(context.Background(), cfg, "INBOX", 1, 20); err == nil {
+		t.Fatalf("expected search timeout")
+	}
+	if *connects != 1 {
+		t.Fatalf("expected a read timeout not to be retried, got %d connections", *connects)
+	}
+
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	if !isTransient(fmt.Errorf("connect: %w", dial)) {
+		t.Fatalf("expected a dial failure to be retried")
+	}
+}
+
+type searchClient struct {
+	mockClient
+	criteria *imap.SearchCriteria
+}
+
+func (s *searchClient) UidSearch(criteria *imap.SearchCriteria) ([]uint32, error) {
+	s.criteria = criteria
+	return []uint32{7}, nil
+}
+
+func (s *searchClient) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	ch <- &imap.Message{Uid: 7, Body: map[*imap.BodySectionName]imap.Literal{
+		{}: strings.NewReader("Subject: failure notice\r\n\r\nbody\r\n"),
+	}}
+	close(ch)
+	return nil
+}
+
+func TestFetchMatchingSearchesAnyHeader(t *testing.T) {
+	client := &searchClient{}
+	svc := &Service{Connector: func(ctx context.Context, cfg config.Config) (Client, error) {
+		return client, nil
+	}}
+	since := time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC)
+	hints := []HeaderMatch{{Field: "From", Value: "mailer-daemon"}, {Field: "X-Failed-Recipients"}, {Field: "Subject", Value: "undeliver"}}
+
+	messages, err := svc.FetchMatching(context.Background(), config.Config{}, "INBOX", since, hints)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(messages) != 1 || messages[0].UID != 7 || !strings.Contains(string(messages[0].Raw), "failure notice") {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+
+	c := client.criteria
+	if !c.Since.Equal(since) || len(c.Or) != 1 {
+		t.Fatalf("unexpected criteria: %+v", c)
+	}
+	first, rest := c.Or[0][0], c.Or[0][1]
+	if first.Header.Get("From") != "mailer-daemon" || len(rest.Or) != 1 {
+		t.Fatalf("unexpected first branch: %+v / %+v", first, rest)
+	}
+	if _, ok := rest.Or[0][0].Header["X-Failed-Recipients"]; !ok || rest.Or[0][1].Header.Get("Subject") != "undeliver" {
+		t.Fatalf("unexpected nested branches: %+v", rest.Or[0])
+	}
+}
+
+type appendClient struct {
+	mockClient
+	appended []string
+}
+
+func (a *appendClient) Append(mailbox string, flags []string, date time.Time, msg imap.Literal) error {
+	a.appended = append(a.appended, mailbox)
+	return nil
+}
+
+func TestSessionReusesConnection(t *testing.T) {
+	client := &appendClient{}
+	connects := 0
+	svc := &Service{Connector: func(ctx context.Context, cfg config.Config) (Client, error) {
+		connects++
+		return client, nil
+	}}
+
+	session, err := svc.Open(context.Background(), config.Config{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := session.SaveSent("Sent", []byte("Subject: hi\r\n\r\nhi\r\n")); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if err := session.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if connects != 1 || len(client.appended) != 3 || !client.loggedOut {
+		t.Fatalf("expected 3 appends over 1 connection, got %d appends, %d connections, logged out %v", len(client.appended), connects, client.loggedOut)
+	}
+}
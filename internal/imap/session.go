@@ -0,0 +1,48 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"mailcli/internal/config"
+
+	"github.com/emersion/go-imap"
+)
+
+// Session is a logged-in connection for commands that act on many messages,
+// such as filing a Sent copy of every message of a mail merge.
+type Session struct {
+	c    Client
+	stop func() bool
+}
+
+// Open connects and logs in. Cancelling ctx logs out, aborting any command
+// in progress.
+func (s *Service) Open(ctx context.Context, cfg config.Config) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	connector := s.Connector
+	if connector == nil {
+		connector = Connect
+	}
+	c, err := connector(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{c: c, stop: context.AfterFunc(ctx, func() { logout(c) })}, nil
+}
+
+// SaveSent files a copy of a sent message, marked as read.
+func (s *Session) SaveSent(mailbox string, raw []byte) error {
+	return s.c.Append(mailbox, []string{imap.SeenFlag}, time.Now(), bytes.NewReader(raw))
+}
+
+// Close logs out.
+func (s *Session) Close() error {
+	if !s.stop() {
+		return nil
+	}
+	return s.c.Logout()
+}
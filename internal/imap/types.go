@@ -2,6 +2,10 @@ package imap
 
 import "time"
 
+// MDNSentFlag is the keyword marking a message whose read receipt was sent
+// (RFC 3503).
+const MDNSentFlag = "$MDNSent"
+
 type MessageSummary struct {
 	UID     uint32
 	Subject string
@@ -21,6 +25,26 @@ type MessageDetail struct {
 	TextBody    string
 	HTMLBody    string
 	Attachments []string
+	Flags       []string
+	// Calendar is the first text/calendar part, if any.
+	Calendar []byte
+	// Raw is the full RFC 822 message.
+	Raw []byte
+}
+
+// RawMessage is a message's full RFC 822 content.
+type RawMessage struct {
+	UID uint32
+	// Date is when the server received the message.
+	Date time.Time
+	Raw  []byte
+}
+
+// HeaderMatch selects messages whose header Field contains Value; an empty
+// Value matches any message that has the field.
+type HeaderMatch struct {
+	Field string
+	Value string
 }
 
 type ThreadSummary struct {
@@ -30,3 +54,46 @@ type ThreadSummary struct {
 	From    string
 	Date    time.Time
 }
+
+type MailboxStats struct {
+	Name        string
+	Messages    uint32
+	Unseen      uint32
+	Recent      uint32
+	UIDNext     uint32
+	UIDValidity uint32
+	// Size is the total mailbox size in octets; only set when HasSize is true
+	// (servers advertising STATUS=SIZE).
+	Size    uint64
+	HasSize bool
+	// QuotaRoots names the quota roots the mailbox counts against.
+	QuotaRoots []string
+}
+
+// AccountStatus is what Service.MailboxStats found.
+type AccountStatus struct {
+	Mailboxes []MailboxStats
+	// Quota lists the quota roots of the mailboxes, each once. It is empty
+	// when QuotaSupported is false.
+	Quota          []QuotaRoot
+	QuotaSupported bool
+}
+
+type QuotaResource struct {
+	Name  string
+	Usage uint64
+	Limit uint64
+}
+
+// Percent returns the usage as a percentage of the limit, or 0 when unlimited.
+func (r QuotaResource) Percent() float64 {
+	if r.Limit == 0 {
+		return 0
+	}
+	return float64(r.Usage) / float64(r.Limit) * 100
+}
+
+type QuotaRoot struct {
+	Name      string
+	Resources []QuotaResource
+}
@@ -0,0 +1,264 @@
+package merge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mailcli/internal/templates"
+)
+
+// Row is one record of merge data, keyed by CSV column or JSON field.
+type Row map[string]any
+
+// LoadData reads rows from a CSV file with a header line, a JSON array of
+// objects, or JSON lines (.jsonl/.ndjson).
+func LoadData(path string) ([]Row, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // data path is chosen by the user
+	if err != nil {
+		return nil, fmt.Errorf("read merge data: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return parseCSV(data)
+	case ".json":
+		var rows []Row
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("parse %s: expected an array of objects: %w", path, err)
+		}
+		return rows, nil
+	case ".jsonl", ".ndjson":
+		return parseJSONLines(data)
+	}
+	return nil, fmt.Errorf("unsupported merge data %s (use .csv, .json or .jsonl)", path)
+}
+
+func parseCSV(data []byte) ([]Row, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse csv: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	var rows []Row
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse csv: %w", err)
+		}
+		row := make(Row, len(header))
+		for i, name := range header {
+			if name != "" && i < len(record) {
+				row[name] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseJSONLines(data []byte) ([]Row, error) {
+	var rows []Row
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var row Row
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("parse json line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// Rate limits how many messages are sent per period.
+type Rate struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseRate parses "30/min", "2/s" or "500/hour".
+func ParseRate(value string) (Rate, error) {
+	count, unit, ok := strings.Cut(strings.TrimSpace(value), "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q (expected e.g. 30/min)", value)
+	}
+	var period time.Duration
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "s", "sec", "second":
+		period = time.Second
+	case "m", "min", "minute":
+		period = time.Minute
+	case "h", "hour":
+		period = time.Hour
+	default:
+		return Rate{}, fmt.Errorf("invalid rate unit %q (expected s, min or hour)", unit)
+	}
+	return Rate{Count: n, Period: period}, nil
+}
+
+// Interval is the pause between two sends.
+func (r Rate) Interval() time.Duration {
+	if r.Count <= 0 {
+		return 0
+	}
+	return r.Period / time.Duration(r.Count)
+}
+
+// Limiter spaces calls to Wait at least interval apart.
+type Limiter struct {
+	interval time.Duration
+	last     time.Time
+	now      func() time.Time
+	sleep    func(context.Context, time.Duration) error
+}
+
+func NewLimiter(interval time.Duration) *Limiter {
+	return &Limiter{interval: interval, now: time.Now, sleep: sleep}
+}
+
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l.interval > 0 && !l.last.IsZero() {
+		if d := l.interval - l.now().Sub(l.last); d > 0 {
+			if err := l.sleep(ctx, d); err != nil {
+				return err
+			}
+		}
+	}
+	l.last = l.now()
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Key identifies a message in the progress file by its recipients and a
+// hash of its rendered content, so a resumed merge skips messages already
+// delivered even if rows moved, while two rows for the same recipient with
+// different content (say, two invoices) are both sent.
+func Key(recipients []string, msg templates.Message) string {
+	keys := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		keys = append(keys, strings.ToLower(strings.TrimSpace(r)))
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, fields := range [][]string{{msg.From, msg.Identity, msg.ReplyTo, msg.Subject, msg.Body, msg.BodyHTML}, msg.Attachments, msg.Inline} {
+		fmt.Fprintf(h, "%d\n", len(fields))
+		for _, f := range fields {
+			fmt.Fprintf(h, "%d:%s\n", len(f), f)
+		}
+	}
+	return strings.Join(keys, ",") + "#" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+type progressRecord struct {
+	Key    string    `json:"key"`
+	Row    int       `json:"row"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Progress is an append-only log of delivered messages.
+type Progress struct {
+	path string
+	sent map[string]bool
+}
+
+func OpenProgress(path string) (*Progress, error) {
+	p := &Progress{path: path, sent: map[string]bool{}}
+	data, err := os.ReadFile(path) //nolint:gosec // progress path is chosen by the user
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read progress: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var rec progressRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		p.sent[rec.Key] = true
+	}
+	return p, nil
+}
+
+func (p *Progress) Done(key string) bool {
+	return p.sent[key]
+}
+
+// Mark records a delivery; it is written immediately so an interrupted merge
+// never sends the same message twice.
+func (p *Progress) Mark(key string, row int, at time.Time) error {
+	line, err := json.Marshal(progressRecord{Key: key, Row: row, SentAt: at.UTC()})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("write progress: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write progress: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write progress: %w", err)
+	}
+	p.sent[key] = true
+	return nil
+}
+
+const (
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+	StatusWritten = "written"
+)
+
+// Outcome is the report line for one row.
+type Outcome struct {
+	Row        int      `json:"row"`
+	Recipients []string `json:"recipients"`
+	Status     string   `json:"status"`
+	Detail     string   `json:"detail,omitempty"`
+}
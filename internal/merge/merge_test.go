@@ -0,0 +1,93 @@
+package merge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mailcli/internal/templates"
+)
+
+func TestLoadData(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "people.csv")
+	if err := os.WriteFile(csvPath, []byte("\xef\xbb\xbfemail,name\nann@example.com,\"Ann, PhD\"\nbob@example.com,Bob\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := LoadData(csvPath)
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["email"] != "ann@example.com" || rows[0]["name"] != "Ann, PhD" {
+		t.Fatalf("unexpected csv rows %v", rows)
+	}
+
+	jsonPath := filepath.Join(dir, "people.json")
+	if err := os.WriteFile(jsonPath, []byte(`[{"email":"ann@example.com","seats":2}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = LoadData(jsonPath)
+	if err != nil || len(rows) != 1 || rows[0]["seats"] != float64(2) {
+		t.Fatalf("unexpected json rows %v %v", rows, err)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	r, err := ParseRate("30/min")
+	if err != nil || r.Interval() != 2*time.Second {
+		t.Fatalf("unexpected rate %+v %v", r, err)
+	}
+	for _, bad := range []string{"30", "0/min", "5/week"} {
+		if _, err := ParseRate(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	var slept []time.Duration
+	l := NewLimiter(2 * time.Second)
+	l.now = func() time.Time { return now }
+	l.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		now = now.Add(d)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(500 * time.Millisecond)
+	}
+	if len(slept) != 2 || slept[0] != 1500*time.Millisecond {
+		t.Fatalf("unexpected sleeps %v", slept)
+	}
+}
+
+func TestProgressResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.csv.progress")
+	p, err := OpenProgress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := templates.Message{Subject: "Invoice 1", Body: "Amount: 10"}
+	key := Key([]string{"Bob@example.com", "ann@example.com"}, msg)
+	if err := p.Mark(key, 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := OpenProgress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resumed.Done(Key([]string{"ann@example.com", "bob@example.com"}, msg)) || resumed.Done(Key([]string{"carol@example.com"}, msg)) {
+		t.Fatal("unexpected resume state")
+	}
+	second := templates.Message{Subject: "Invoice 2", Body: "Amount: 10"}
+	if resumed.Done(Key([]string{"ann@example.com", "bob@example.com"}, second)) {
+		t.Fatal("a second message to the same recipients should not count as sent")
+	}
+}
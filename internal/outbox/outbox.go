@@ -0,0 +1,428 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mailcli/internal/config"
+	"mailcli/internal/email"
+	"mailcli/internal/smtp"
+)
+
+var ErrNotFound = errors.New("outbox entry not found")
+
+const (
+	minBackoff = time.Minute
+	maxBackoff = time.Hour
+	// staleClaim is how long a claim by a flush that never finished keeps
+	// others from sending the entry; after that it can be flushed by ID.
+	staleClaim = time.Hour
+)
+
+// Entry is the metadata stored next to each queued message. The message
+// itself is kept verbatim, so its Message-ID never changes; only the Date
+// header is rewritten when it is finally handed to the server.
+type Entry struct {
+	ID         string       `json:"id"`
+	MessageID  string       `json:"message_id,omitempty"`
+	From       string       `json:"from"`
+	Recipients []string     `json:"recipients"`
+	Subject    string       `json:"subject,omitempty"`
+	Delivery   smtp.Options `json:"delivery"`
+	CreatedAt  time.Time    `json:"created_at"`
+	// NotBefore is the scheduled delivery time for send --later.
+	NotBefore   time.Time `json:"not_before,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"`
+	LastAttempt time.Time `json:"last_attempt,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	// Held entries failed permanently and are only retried when flushed by ID.
+	Held bool `json:"held,omitempty"`
+	// Sending is set by List and Get while a flush has claimed the entry.
+	Sending bool `json:"-"`
+}
+
+// Due returns when the entry should next be attempted.
+func (e Entry) Due() time.Time {
+	if e.NextAttempt.After(e.NotBefore) {
+		return e.NextAttempt
+	}
+	return e.NotBefore
+}
+
+func (e Entry) Status(now time.Time) string {
+	switch {
+	case e.Sending:
+		return "sending"
+	case e.Held:
+		return "held"
+	case e.Attempts == 0 && e.NotBefore.After(now):
+		return "scheduled"
+	case e.Attempts > 0:
+		return "retrying"
+	}
+	return "pending"
+}
+
+type Queue struct {
+	dir string
+	now func() time.Time
+}
+
+// Open returns the queue in the config directory.
+func Open() (*Queue, error) {
+	dir, err := config.OutboxDir()
+	if err != nil {
+		return nil, err
+	}
+	return New(dir), nil
+}
+
+func New(dir string) *Queue {
+	return &Queue{dir: dir, now: time.Now}
+}
+
+// Add stores a message and returns its entry with ID and CreatedAt set.
+func (q *Queue) Add(entry Entry, raw []byte) (Entry, error) {
+	if err := os.MkdirAll(q.dir, 0o700); err != nil {
+		return entry, fmt.Errorf("ensure outbox dir: %w", err)
+	}
+	id, err := q.newID()
+	if err != nil {
+		return entry, err
+	}
+	entry.ID = id
+	entry.CreatedAt = q.now()
+	if msg, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		if entry.MessageID == "" {
+			entry.MessageID = msg.Header.Get("Message-ID")
+		}
+		if entry.Subject == "" {
+			entry.Subject = decodeHeader(msg.Header.Get("Subject"))
+		}
+	}
+
+	if err := os.WriteFile(q.messagePath(id), raw, 0o600); err != nil {
+		return entry, fmt.Errorf("write queued message: %w", err)
+	}
+	if err := q.Update(entry); err != nil {
+		_ = os.Remove(q.messagePath(id))
+		return entry, err
+	}
+	return entry, nil
+}
+
+func (q *Queue) Update(entry Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated entry.
+	tmp := q.entryPath(entry.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	return os.Rename(tmp, q.entryPath(entry.ID))
+}
+
+// List returns all entries, oldest first.
+func (q *Queue) List() ([]Entry, error) {
+	paths, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(paths))
+	for _, path := range paths {
+		entry, err := readEntry(path)
+		if err != nil {
+			return nil, err
+		}
+		entry.Sending = q.claimed(entry.ID)
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// Get finds an entry by ID or unique ID prefix and returns it with its
+// message.
+func (q *Queue) Get(id string) (Entry, []byte, error) {
+	entries, err := q.List()
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	var match *Entry
+	for i := range entries {
+		if entries[i].ID == id {
+			match = &entries[i]
+			break
+		}
+		if strings.HasPrefix(entries[i].ID, id) {
+			if match != nil {
+				return Entry{}, nil, fmt.Errorf("outbox id %q is ambiguous", id)
+			}
+			match = &entries[i]
+		}
+	}
+	if id == "" || match == nil {
+		return Entry{}, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	path := q.messagePath(match.ID)
+	if match.Sending {
+		path = q.sendingPath(match.ID)
+	}
+	raw, err := os.ReadFile(path) //nolint:gosec // path is inside the outbox dir
+	if err != nil {
+		return Entry{}, nil, fmt.Errorf("read queued message: %w", err)
+	}
+	return *match, raw, nil
+}
+
+func (q *Queue) Remove(id string) error {
+	if err := os.Remove(q.entryPath(id)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return err
+	}
+	for _, path := range []string{q.messagePath(id), q.sendingPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendFunc delivers one queued message.
+type SendFunc func(ctx context.Context, entry Entry, raw []byte) (smtp.Result, error)
+
+// Outcome is the result of one delivery attempt during a flush.
+type Outcome struct {
+	Entry  Entry
+	Result smtp.Result
+	Err    error
+}
+
+// Flush attempts every due entry, or the given IDs regardless of schedule,
+// backoff or hold. Sent entries are removed; failures are rescheduled with
+// exponential backoff, or held when the failure is permanent. Each entry is
+// claimed before it is sent, so concurrent flushes never send it twice.
+func (q *Queue) Flush(ctx context.Context, ids []string, send SendFunc) ([]Outcome, error) {
+	var entries []Entry
+	forced := len(ids) > 0
+	if forced {
+		for _, id := range ids {
+			entry, _, err := q.Get(id)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	} else {
+		all, err := q.List()
+		if err != nil {
+			return nil, err
+		}
+		now := q.now()
+		for _, entry := range all {
+			if !entry.Sending && !entry.Held && !entry.Due().After(now) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	outcomes := make([]Outcome, 0, len(entries))
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return outcomes, err
+		}
+		outcome, ok, err := q.deliver(ctx, entry.ID, forced, send)
+		if err != nil {
+			return outcomes, err
+		}
+		if ok {
+			outcomes = append(outcomes, outcome)
+		}
+	}
+	return outcomes, nil
+}
+
+// deliver claims and sends one entry. It reports false when another flush
+// got to the entry first or, unless forced, it is no longer due.
+func (q *Queue) deliver(ctx context.Context, id string, forced bool, send SendFunc) (Outcome, bool, error) {
+	if forced {
+		if err := q.releaseStale(id); err != nil {
+			return Outcome{}, false, err
+		}
+	}
+	if err := q.claim(id); err != nil {
+		if os.IsNotExist(err) {
+			if forced && q.claimed(id) {
+				return Outcome{}, false, fmt.Errorf("outbox entry %s is being sent by another flush", id)
+			}
+			return Outcome{}, false, nil
+		}
+		return Outcome{}, false, err
+	}
+	// Re-read under the claim: another flush may have just rescheduled it.
+	entry, err := readEntry(q.entryPath(id))
+	if err == nil && !forced && (entry.Held || entry.Due().After(q.now())) {
+		return Outcome{}, false, q.release(id)
+	}
+	var raw []byte
+	if err == nil {
+		raw, err = os.ReadFile(q.sendingPath(id))
+	}
+	if err != nil {
+		_ = q.release(id)
+		return Outcome{}, false, err
+	}
+
+	now := q.now()
+	result, sendErr := send(ctx, entry, email.SetDate(raw, now))
+	if sendErr == nil {
+		if err := q.Remove(id); err != nil && !errors.Is(err, ErrNotFound) {
+			return Outcome{}, false, err
+		}
+		return Outcome{Entry: entry, Result: result}, true, nil
+	}
+	if ctx.Err() != nil {
+		_ = q.release(id)
+		return Outcome{}, false, ctx.Err()
+	}
+
+	entry.Attempts++
+	entry.LastAttempt = now
+	entry.LastError = sendErr.Error()
+	if smtp.IsTemporary(sendErr) {
+		entry.Held = false
+		entry.NextAttempt = now.Add(Backoff(entry.Attempts))
+	} else {
+		entry.Held = true
+		entry.NextAttempt = time.Time{}
+	}
+	if err := q.Update(entry); err != nil {
+		_ = q.release(id)
+		return Outcome{}, false, err
+	}
+	if err := q.release(id); err != nil {
+		return Outcome{}, false, err
+	}
+	return Outcome{Entry: entry, Result: result, Err: sendErr}, true, nil
+}
+
+// claim takes the entry for this flush by renaming its message, which only
+// one process can do. The error satisfies os.IsNotExist when the entry is
+// already claimed or gone.
+func (q *Queue) claim(id string) error {
+	if err := os.Rename(q.messagePath(id), q.sendingPath(id)); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(q.sendingPath(id), now, now)
+}
+
+func (q *Queue) release(id string) error {
+	return os.Rename(q.sendingPath(id), q.messagePath(id))
+}
+
+func (q *Queue) claimed(id string) bool {
+	_, err := os.Stat(q.sendingPath(id))
+	return err == nil
+}
+
+// releaseStale gives up the claim of a flush that stopped without
+// finishing, such as one that was killed. Whether that flush delivered the
+// message is unknown, so this is only done when the entry is flushed by ID.
+func (q *Queue) releaseStale(id string) error {
+	info, err := os.Stat(q.sendingPath(id))
+	if err != nil || time.Since(info.ModTime()) < staleClaim {
+		return nil
+	}
+	return q.release(id)
+}
+
+// Backoff returns the delay after the given number of failed attempts.
+func Backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// NextDue returns the earliest time an entry becomes due, or false when
+// nothing is waiting.
+func (q *Queue) NextDue() (time.Time, bool, error) {
+	entries, err := q.List()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var next time.Time
+	found := false
+	for _, entry := range entries {
+		if entry.Held || entry.Sending {
+			continue
+		}
+		if due := entry.Due(); !found || due.Before(next) {
+			next = due
+			found = true
+		}
+	}
+	return next, found, nil
+}
+
+func (q *Queue) newID() (string, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return q.now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b[:]), nil
+}
+
+func (q *Queue) entryPath(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *Queue) messagePath(id string) string {
+	return filepath.Join(q.dir, id+".eml")
+}
+
+func (q *Queue) sendingPath(id string) string {
+	return filepath.Join(q.dir, id+".eml.sending")
+}
+
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+func readEntry(path string) (Entry, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path is inside the outbox dir
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, fmt.Errorf("parse %s: %w", filepath.Base(path), err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,210 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/mail"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"mailcli/internal/smtp"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+const testMessage = "From: me@example.com\r\n" +
+	"To: alice@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+	"Message-ID: <abc@example.com>\r\n" +
+	"\r\n" +
+	"body\r\n"
+
+func testQueue(t *testing.T, now time.Time) (*Queue, *time.Time) {
+	t.Helper()
+	clock := now
+	q := New(t.TempDir())
+	q.now = func() time.Time { return clock }
+	return q, &clock
+}
+
+func TestFlushSendsDueAndRewritesDate(t *testing.T) {
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	q, clock := testQueue(t, start)
+
+	due, err := q.Add(Entry{From: "me@example.com", Recipients: []string{"alice@example.com"}}, []byte(testMessage))
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if due.MessageID != "<abc@example.com>" || due.Subject != "Hello" {
+		t.Fatalf("expected headers to be summarised, got %+v", due)
+	}
+	if _, err := q.Add(Entry{From: "me@example.com", Recipients: []string{"bob@example.com"}, NotBefore: start.Add(time.Hour)}, []byte(testMessage)); err != nil {
+		t.Fatalf("add scheduled: %v", err)
+	}
+
+	*clock = start.Add(time.Minute)
+	var sent []*mail.Message
+	send := func(ctx context.Context, entry Entry, raw []byte) (smtp.Result, error) {
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("parse sent message: %v", err)
+		}
+		sent = append(sent, msg)
+		return smtp.Result{Accepted: entry.Recipients}, nil
+	}
+
+	outcomes, err := q.Flush(context.Background(), nil, send)
+	if err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(outcomes) != 1 || len(sent) != 1 {
+		t.Fatalf("expected only the due message to be sent, got %d", len(sent))
+	}
+	if got := sent[0].Header.Get("Message-ID"); got != "<abc@example.com>" {
+		t.Fatalf("expected Message-ID to be kept, got %q", got)
+	}
+	if date, err := sent[0].Header.Date(); err != nil || !date.Equal(*clock) {
+		t.Fatalf("expected Date to be the delivery time, got %v (%v)", date, err)
+	}
+
+	entries, err := q.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Status(*clock) != "scheduled" {
+		t.Fatalf("expected only the scheduled entry to remain, got %+v", entries)
+	}
+}
+
+func TestFlushBacksOffAndHolds(t *testing.T) {
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	q, clock := testQueue(t, start)
+
+	entry, err := q.Add(Entry{From: "me@example.com", Recipients: []string{"alice@example.com"}}, []byte(testMessage))
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	sendErr := error(&gosmtp.SMTPError{Code: 421, Message: "try again later"})
+	send := func(ctx context.Context, entry Entry, raw []byte) (smtp.Result, error) {
+		return smtp.Result{}, sendErr
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		outcomes, err := q.Flush(context.Background(), nil, send)
+		if err != nil || len(outcomes) != 1 {
+			t.Fatalf("flush %d: %v, %d outcomes", attempt, err, len(outcomes))
+		}
+		if got, want := outcomes[0].Entry.NextAttempt, clock.Add(Backoff(attempt)); !got.Equal(want) {
+			t.Fatalf("attempt %d: expected next attempt %s, got %s", attempt, want, got)
+		}
+		if outcomes, _ := q.Flush(context.Background(), nil, send); len(outcomes) != 0 {
+			t.Fatalf("expected entry to wait for its backoff")
+		}
+		*clock = outcomes[0].Entry.NextAttempt
+	}
+
+	sendErr = &gosmtp.SMTPError{Code: 550, Message: "mailbox unavailable"}
+	outcomes, err := q.Flush(context.Background(), nil, send)
+	if err != nil || len(outcomes) != 1 || !outcomes[0].Entry.Held {
+		t.Fatalf("expected permanent failure to hold the entry, got %+v (%v)", outcomes, err)
+	}
+	if outcomes, _ := q.Flush(context.Background(), nil, send); len(outcomes) != 0 {
+		t.Fatalf("expected held entry to be skipped")
+	}
+
+	sendErr = nil
+	if outcomes, err := q.Flush(context.Background(), []string{entry.ID[:10]}, send); err != nil || len(outcomes) != 1 {
+		t.Fatalf("expected flush by id prefix to send the held entry, got %v", err)
+	}
+	if _, _, err := q.Get(entry.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected sent entry to be removed, got %v", err)
+	}
+}
+
+func TestConcurrentFlushesSendEachEntryOnce(t *testing.T) {
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	first, _ := testQueue(t, start)
+	for i := 0; i < 20; i++ {
+		if _, err := first.Add(Entry{From: "me@example.com", Recipients: []string{"alice@example.com"}}, []byte(testMessage)); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	second := New(first.dir)
+	second.now = first.now
+
+	var mu sync.Mutex
+	sent := map[string]int{}
+	send := func(ctx context.Context, entry Entry, raw []byte) (smtp.Result, error) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		sent[entry.ID]++
+		mu.Unlock()
+		return smtp.Result{Accepted: entry.Recipients}, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, q := range []*Queue{first, second} {
+		wg.Add(1)
+		go func(i int, q *Queue) {
+			defer wg.Done()
+			_, errs[i] = q.Flush(context.Background(), nil, send)
+		}(i, q)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+	}
+	if len(sent) != 20 {
+		t.Fatalf("expected 20 messages to be sent, got %d", len(sent))
+	}
+	for id, n := range sent {
+		if n != 1 {
+			t.Fatalf("entry %s was sent %d times", id, n)
+		}
+	}
+	if entries, err := first.List(); err != nil || len(entries) != 0 {
+		t.Fatalf("expected an empty queue, got %+v (%v)", entries, err)
+	}
+}
+
+func TestFlushSkipsClaimedEntries(t *testing.T) {
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	q, _ := testQueue(t, start)
+	entry, err := q.Add(Entry{From: "me@example.com", Recipients: []string{"alice@example.com"}}, []byte(testMessage))
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := q.claim(entry.ID); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+
+	send := func(ctx context.Context, entry Entry, raw []byte) (smtp.Result, error) {
+		return smtp.Result{Accepted: entry.Recipients}, nil
+	}
+	if outcomes, err := q.Flush(context.Background(), nil, send); err != nil || len(outcomes) != 0 {
+		t.Fatalf("expected the claimed entry to be skipped, got %d outcomes (%v)", len(outcomes), err)
+	}
+	if _, err := q.Flush(context.Background(), []string{entry.ID}, send); err == nil {
+		t.Fatal("expected flushing a claimed entry by ID to fail")
+	}
+	if entries, _ := q.List(); len(entries) != 1 || entries[0].Status(start) != "sending" {
+		t.Fatalf("expected the entry to be listed as sending, got %+v", entries)
+	}
+
+	// A claim left behind by a flush that was killed can be taken over by ID.
+	old := time.Now().Add(-2 * staleClaim)
+	if err := os.Chtimes(q.sendingPath(entry.ID), old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if outcomes, err := q.Flush(context.Background(), []string{entry.ID}, send); err != nil || len(outcomes) != 1 {
+		t.Fatalf("expected a stale claim to be released, got %d outcomes (%v)", len(outcomes), err)
+	}
+}
@@ -0,0 +1,348 @@
+package pgp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// PassphraseFunc returns the passphrase for the secret key with the given
+// fingerprint.
+type PassphraseFunc func(fingerprint string) ([]byte, error)
+
+// Keyring holds the public keys of correspondents and the user's own secret
+// keys.
+type Keyring struct {
+	Public openpgp.EntityList
+	Secret openpgp.EntityList
+}
+
+// MissingKeysError lists recipients without a usable encryption key.
+type MissingKeysError struct {
+	Addresses []string
+}
+
+func (e *MissingKeysError) Error() string {
+	return fmt.Sprintf("no usable OpenPGP key for %d recipient(s): %s", len(e.Addresses), strings.Join(e.Addresses, ", "))
+}
+
+// LoadKeyring reads the public and secret keyring files. Missing files are
+// treated as empty keyrings; both armored and binary keyrings are accepted.
+func LoadKeyring(publicPath, secretPath string) (*Keyring, error) {
+	public, err := readKeyringFile(publicPath)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := readKeyringFile(secretPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{Public: public, Secret: secret}, nil
+}
+
+func readKeyringFile(path string) (openpgp.EntityList, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // keyring path comes from the user's config
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read keyring: %w", err)
+	}
+	entities, err := ReadKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("read keyring %s: %w", path, err)
+	}
+	return entities, nil
+}
+
+// ReadKeys parses one or more armored key blocks, or a binary keyring.
+func ReadKeys(data []byte) (openpgp.EntityList, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	var entities openpgp.EntityList
+	for _, block := range armoredBlocks(data) {
+		list, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(block))
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, list...)
+	}
+	return entities, nil
+}
+
+func armoredBlocks(data []byte) [][]byte {
+	var blocks [][]byte
+	for {
+		start := bytes.Index(data, []byte("-----BEGIN PGP"))
+		if start < 0 {
+			return blocks
+		}
+		data = data[start:]
+		end := bytes.Index(data, []byte("-----END PGP"))
+		if end < 0 {
+			return append(blocks, data)
+		}
+		if nl := bytes.IndexByte(data[end:], '\n'); nl >= 0 {
+			end += nl + 1
+		} else {
+			end = len(data)
+		}
+		blocks = append(blocks, data[:end])
+		data = data[end:]
+	}
+}
+
+// Add merges keys into the keyring, public keys into Public and keys with
+// secret material into Secret, replacing entries with the same fingerprint.
+func (k *Keyring) Add(entities openpgp.EntityList) {
+	for _, e := range entities {
+		if e.PrivateKey != nil {
+			k.Secret = replaceEntity(k.Secret, e)
+		} else {
+			k.Public = replaceEntity(k.Public, e)
+		}
+	}
+}
+
+func replaceEntity(list openpgp.EntityList, e *openpgp.Entity) openpgp.EntityList {
+	for i, existing := range list {
+		if bytes.Equal(existing.PrimaryKey.Fingerprint, e.PrimaryKey.Fingerprint) {
+			list[i] = e
+			return list
+		}
+	}
+	return append(list, e)
+}
+
+// Save writes both keyrings as armored files.
+func (k *Keyring) Save(publicPath, secretPath string) error {
+	if err := writeKeyringFile(publicPath, k.Public, false); err != nil {
+		return err
+	}
+	return writeKeyringFile(secretPath, k.Secret, true)
+}
+
+func writeKeyringFile(path string, entities openpgp.EntityList, secret bool) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	blockType := openpgp.PublicKeyType
+	if secret {
+		blockType = openpgp.PrivateKeyType
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range entities {
+		if secret {
+			err = e.SerializePrivateWithoutSigning(w, nil)
+		} else {
+			err = e.Serialize(w)
+		}
+		if err != nil {
+			return fmt.Errorf("serialize key %s: %w", Fingerprint(e), err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	if err := ensureParent(path); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("write keyring: %w", err)
+	}
+	return nil
+}
+
+// EncryptionKeys finds a valid encryption key for every address. Secret keys
+// count too, so mail to oneself works without exporting the public key.
+func (k *Keyring) EncryptionKeys(addresses []string) (openpgp.EntityList, error) {
+	now := time.Now()
+	var keys openpgp.EntityList
+	var missing []string
+	for _, addr := range addresses {
+		e := findEntity(append(append(openpgp.EntityList{}, k.Public...), k.Secret...), addr, func(e *openpgp.Entity) bool {
+			_, ok := e.EncryptionKey(now)
+			return ok
+		})
+		if e == nil {
+			missing = append(missing, addr)
+			continue
+		}
+		keys = appendUnique(keys, e)
+	}
+	if len(missing) > 0 {
+		return nil, &MissingKeysError{Addresses: missing}
+	}
+	return keys, nil
+}
+
+// VerificationKeys returns every known key, for checking signatures.
+func (k *Keyring) VerificationKeys() openpgp.EntityList {
+	return append(append(openpgp.EntityList{}, k.Public...), k.Secret...)
+}
+
+// SigningKey finds the secret key matching selector (a fingerprint, key ID or
+// address) and unlocks it.
+func (k *Keyring) SigningKey(selector string, passphrase PassphraseFunc) (*openpgp.Entity, error) {
+	now := time.Now()
+	e := findEntity(k.Secret, selector, func(e *openpgp.Entity) bool {
+		_, ok := e.SigningKey(now)
+		return ok
+	})
+	if e == nil {
+		return nil, fmt.Errorf("no OpenPGP signing key for %s in the secret keyring", selector)
+	}
+	if err := Unlock(e, passphrase); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Unlock decrypts the entity's secret keys if they are protected.
+func Unlock(e *openpgp.Entity, passphrase PassphraseFunc) error {
+	if !locked(e) {
+		return nil
+	}
+	if passphrase == nil {
+		return fmt.Errorf("secret key %s is protected by a passphrase", Fingerprint(e))
+	}
+	pass, err := passphrase(Fingerprint(e))
+	if err != nil {
+		return err
+	}
+	if err := e.DecryptPrivateKeys(pass); err != nil {
+		return fmt.Errorf("unlock secret key %s: %w", Fingerprint(e), err)
+	}
+	return nil
+}
+
+func locked(e *openpgp.Entity) bool {
+	if e.PrivateKey != nil && e.PrivateKey.Encrypted {
+		return true
+	}
+	for _, sub := range e.Subkeys {
+		if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint is the primary key fingerprint in upper-case hex.
+func Fingerprint(e *openpgp.Entity) string {
+	return strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint))
+}
+
+// KeyInfo describes a key for listing.
+type KeyInfo struct {
+	Fingerprint string
+	Secret      bool
+	UserIDs     []string
+	CanSign     bool
+	CanEncrypt  bool
+}
+
+// List describes the secret keys followed by the public keys.
+func (k *Keyring) List() []KeyInfo {
+	now := time.Now()
+	var out []KeyInfo
+	for _, list := range []openpgp.EntityList{k.Secret, k.Public} {
+		for _, e := range list {
+			_, canSign := e.SigningKey(now)
+			_, canEncrypt := e.EncryptionKey(now)
+			info := KeyInfo{
+				Fingerprint: Fingerprint(e),
+				Secret:      e.PrivateKey != nil,
+				CanSign:     canSign && e.PrivateKey != nil,
+				CanEncrypt:  canEncrypt,
+			}
+			for name := range e.Identities {
+				info.UserIDs = append(info.UserIDs, name)
+			}
+			sort.Strings(info.UserIDs)
+			out = append(out, info)
+		}
+	}
+	return out
+}
+
+func findEntity(list openpgp.EntityList, selector string, usable func(*openpgp.Entity) bool) *openpgp.Entity {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return nil
+	}
+	if id, ok := parseKeySelector(selector); ok {
+		for _, e := range list {
+			fpr := Fingerprint(e)
+			if (fpr == id || strings.HasSuffix(fpr, id)) && usable(e) {
+				return e
+			}
+		}
+		return nil
+	}
+	addr := strings.ToLower(selector)
+	for _, e := range list {
+		if usable(e) && matchesAddress(e, addr) {
+			return e
+		}
+	}
+	return nil
+}
+
+// parseKeySelector recognises a 16-digit key ID or a 40/64-digit fingerprint.
+func parseKeySelector(selector string) (string, bool) {
+	s := strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(strings.TrimPrefix(selector, "0x"), "0X"), " ", ""))
+	if len(s) != 16 && len(s) != 40 && len(s) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+func matchesAddress(e *openpgp.Entity, addr string) bool {
+	for _, id := range e.Identities {
+		if id.Revoked(time.Now()) {
+			continue
+		}
+		if id.UserId != nil && strings.EqualFold(id.UserId.Email, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list openpgp.EntityList, e *openpgp.Entity) openpgp.EntityList {
+	for _, existing := range list {
+		if existing == e {
+			return list
+		}
+	}
+	return append(list, e)
+}
+
+func ensureParent(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create keyring dir: %w", err)
+	}
+	return nil
+}
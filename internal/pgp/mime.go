@@ -0,0 +1,205 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"mailcli/internal/email"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Options selects how Protect transforms an outgoing message.
+type Options struct {
+	Sign    bool
+	Encrypt bool
+	// Signer is a fingerprint, key ID or address selecting the secret key.
+	Signer     string
+	Recipients []string
+	// EncryptToSelf adds the signer's key so the sent copy stays readable.
+	EncryptToSelf bool
+	Passphrase    PassphraseFunc
+}
+
+// Protect signs and/or encrypts raw as PGP/MIME (RFC 3156). Recipient keys
+// are looked up before the secret key is unlocked, so a missing key fails
+// without a passphrase prompt.
+func (k *Keyring) Protect(raw []byte, opts Options) ([]byte, error) {
+	if !opts.Sign && !opts.Encrypt {
+		return raw, nil
+	}
+	var to openpgp.EntityList
+	if opts.Encrypt {
+		var err error
+		if to, err = k.EncryptionKeys(opts.Recipients); err != nil {
+			return nil, err
+		}
+		if opts.EncryptToSelf {
+			now := time.Now()
+			self := findEntity(k.VerificationKeys(), opts.Signer, func(e *openpgp.Entity) bool {
+				_, ok := e.EncryptionKey(now)
+				return ok
+			})
+			if self != nil {
+				to = appendUnique(to, self)
+			}
+		}
+	}
+	var signer *openpgp.Entity
+	if opts.Sign {
+		var err error
+		if signer, err = k.SigningKey(opts.Signer, opts.Passphrase); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Encrypt {
+		return Encrypt(raw, to, signer)
+	}
+	return Sign(raw, signer)
+}
+
+// Sign wraps the message content in a multipart/signed entity with a detached
+// signature over the original Content-* headers and body.
+func Sign(raw []byte, signer *openpgp.Entity) ([]byte, error) {
+	outer, entity := email.SplitContentHeaders(raw)
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, signer, bytes.NewReader(entity), packetConfig()); err != nil {
+		return nil, fmt.Errorf("sign message: %w", err)
+	}
+	micalg, err := signatureMicalg(sig.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var armored bytes.Buffer
+	aw, err := armor.Encode(&armored, "PGP SIGNATURE", nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := aw.Write(sig.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	writeOuter(&b, outer, raw)
+	fmt.Fprintf(&b, "Content-Type: multipart/signed; boundary=\"%s\";\r\n micalg=%q; protocol=\"application/pgp-signature\"\r\n\r\n", boundary, micalg)
+	b.WriteString("This is an OpenPGP/MIME signed message (RFC 3156).\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pgp-signature; name=\"signature.asc\"\r\n")
+	b.WriteString("Content-Description: OpenPGP digital signature\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"signature.asc\"\r\n\r\n")
+	b.WriteString(crlf(armored.String()))
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// Encrypt wraps the message content in a multipart/encrypted entity readable
+// by the given keys, signing it inside the encryption when signer is set.
+func Encrypt(raw []byte, to openpgp.EntityList, signer *openpgp.Entity) ([]byte, error) {
+	outer, entity := email.SplitContentHeaders(raw)
+	var armored bytes.Buffer
+	aw, err := armor.Encode(&armored, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+	pw, err := openpgp.Encrypt(aw, to, signer, nil, packetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("encrypt message: %w", err)
+	}
+	if _, err := pw.Write(entity); err != nil {
+		return nil, fmt.Errorf("encrypt message: %w", err)
+	}
+	if err := pw.Close(); err != nil {
+		return nil, fmt.Errorf("encrypt message: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	writeOuter(&b, outer, raw)
+	fmt.Fprintf(&b, "Content-Type: multipart/encrypted; boundary=\"%s\";\r\n protocol=\"application/pgp-encrypted\"\r\n\r\n", boundary)
+	b.WriteString("This is an OpenPGP/MIME encrypted message (RFC 3156).\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pgp-encrypted\r\n")
+	b.WriteString("Content-Description: PGP/MIME version identification\r\n\r\n")
+	b.WriteString("Version: 1\r\n")
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n")
+	b.WriteString("Content-Description: OpenPGP encrypted message\r\n")
+	b.WriteString("Content-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n")
+	b.WriteString(crlf(armored.String()))
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+func writeOuter(b *bytes.Buffer, outer, raw []byte) {
+	b.Write(outer)
+	if !email.HasHeader(raw, "MIME-Version") {
+		b.WriteString("MIME-Version: 1.0\r\n")
+	}
+}
+
+func packetConfig() *packet.Config {
+	return &packet.Config{DefaultHash: crypto.SHA256}
+}
+
+// signatureMicalg names the hash of a binary signature packet for the
+// micalg parameter, e.g. pgp-sha256.
+func signatureMicalg(sig []byte) (string, error) {
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return "", fmt.Errorf("read signature: %w", err)
+	}
+	s, ok := p.(*packet.Signature)
+	if !ok {
+		return "", fmt.Errorf("read signature: unexpected packet %T", p)
+	}
+	names := map[crypto.Hash]string{
+		crypto.SHA1:     "pgp-sha1",
+		crypto.SHA224:   "pgp-sha224",
+		crypto.SHA256:   "pgp-sha256",
+		crypto.SHA384:   "pgp-sha384",
+		crypto.SHA512:   "pgp-sha512",
+		crypto.SHA3_256: "pgp-sha3-256",
+		crypto.SHA3_512: "pgp-sha3-512",
+	}
+	name, ok := names[s.Hash]
+	if !ok {
+		return "", fmt.Errorf("unsupported signature hash %v", s.Hash)
+	}
+	return name, nil
+}
+
+func crlf(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimRight(s, "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+func newBoundary() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "pgp-" + hex.EncodeToString(buf), nil
+}
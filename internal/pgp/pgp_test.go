@@ -0,0 +1,182 @@
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: release\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"v1.2 is out.\r\n"
+
+func newTestEntity(t *testing.T, name, addr string) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", addr, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatalf("new entity: %v", err)
+	}
+	return e
+}
+
+func publicOnly(t *testing.T, e *openpgp.Entity) *openpgp.Entity {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := e.Serialize(&buf); err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	list, err := openpgp.ReadKeyRing(&buf)
+	if err != nil {
+		t.Fatalf("read public key: %v", err)
+	}
+	return list[0]
+}
+
+func TestSignProducesVerifiableMultipartSigned(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	ring := &Keyring{Secret: openpgp.EntityList{alice}}
+
+	out, err := ring.Protect([]byte(testMessage), Options{Sign: true, Signer: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+	msg := string(out)
+	if !strings.Contains(msg, "multipart/signed") || !strings.Contains(msg, `micalg="pgp-sha256"`) {
+		t.Fatalf("expected multipart/signed with micalg, got:\n%s", msg)
+	}
+	if !strings.Contains(msg, "Subject: release\r\n") {
+		t.Fatalf("expected outer headers to be kept")
+	}
+
+	boundary := between(msg, `boundary="`, `"`)
+	parts := strings.Split(msg, "\r\n--"+boundary)
+	first := strings.TrimPrefix(parts[1], "\r\n")
+	if !strings.HasPrefix(first, "Content-Type: text/plain") {
+		t.Fatalf("unexpected signed entity:\n%s", first)
+	}
+	sigPart := parts[2][strings.Index(parts[2], "-----BEGIN"):]
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{publicOnly(t, alice)}, strings.NewReader(first), strings.NewReader(sigPart), nil); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+}
+
+func TestEncryptForRecipientsAndSelf(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	bob := newTestEntity(t, "Bob", "bob@example.com")
+	ring := &Keyring{Public: openpgp.EntityList{publicOnly(t, bob)}, Secret: openpgp.EntityList{alice}}
+
+	out, err := ring.Protect([]byte(testMessage), Options{
+		Sign:          true,
+		Encrypt:       true,
+		Signer:        "alice@example.com",
+		Recipients:    []string{"Bob@Example.com"},
+		EncryptToSelf: true,
+	})
+	if err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+	msg := string(out)
+	if !strings.Contains(msg, `protocol="application/pgp-encrypted"`) || !strings.Contains(msg, "Version: 1\r\n") {
+		t.Fatalf("expected multipart/encrypted, got:\n%s", msg)
+	}
+	if strings.Contains(msg, "v1.2 is out") {
+		t.Fatalf("body leaked in clear text")
+	}
+
+	armored := msg[strings.Index(msg, "-----BEGIN PGP MESSAGE"):]
+	for _, reader := range []*openpgp.Entity{bob, alice} {
+		block, err := armor.Decode(strings.NewReader(armored))
+		if err != nil {
+			t.Fatalf("armor: %v", err)
+		}
+		md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{reader, publicOnly(t, alice)}, nil, nil)
+		if err != nil {
+			t.Fatalf("decrypt: %v", err)
+		}
+		body, err := io.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !strings.Contains(string(body), "v1.2 is out") || md.SignatureError != nil || md.SignedBy == nil {
+			t.Fatalf("unexpected decryption result: %q sigErr=%v", body, md.SignatureError)
+		}
+	}
+}
+
+func TestEncryptReportsMissingKeys(t *testing.T) {
+	bob := newTestEntity(t, "Bob", "bob@example.com")
+	ring := &Keyring{Public: openpgp.EntityList{publicOnly(t, bob)}}
+
+	_, err := ring.Protect([]byte(testMessage), Options{
+		Encrypt:    true,
+		Recipients: []string{"bob@example.com", "carol@example.com", "dave@example.com"},
+	})
+	var missing *MissingKeysError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected MissingKeysError, got %v", err)
+	}
+	if strings.Join(missing.Addresses, ",") != "carol@example.com,dave@example.com" {
+		t.Fatalf("unexpected missing list: %v", missing.Addresses)
+	}
+}
+
+func TestKeyringRoundTripAndLocking(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	if err := alice.EncryptPrivateKeys([]byte("secret"), nil); err != nil {
+		t.Fatalf("encrypt private keys: %v", err)
+	}
+	bob := newTestEntity(t, "Bob", "bob@example.com")
+
+	dir := t.TempDir()
+	public, secret := filepath.Join(dir, "pubring.asc"), filepath.Join(dir, "secring.asc")
+	ring := &Keyring{}
+	ring.Add(openpgp.EntityList{alice, publicOnly(t, bob)})
+	if err := ring.Save(public, secret); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded, err := LoadKeyring(public, secret)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(loaded.Public) != 1 || len(loaded.Secret) != 1 {
+		t.Fatalf("unexpected keyring sizes: %d public, %d secret", len(loaded.Public), len(loaded.Secret))
+	}
+
+	if _, err := loaded.SigningKey("alice@example.com", nil); err == nil {
+		t.Fatalf("expected an error for a locked key without a passphrase")
+	}
+	var asked string
+	signer, err := loaded.SigningKey(Fingerprint(alice)[24:], func(fpr string) ([]byte, error) {
+		asked = fpr
+		return []byte("secret"), nil
+	})
+	if err != nil {
+		t.Fatalf("signing key by key ID: %v", err)
+	}
+	if asked != Fingerprint(alice) || signer.PrivateKey.Encrypted {
+		t.Fatalf("expected the key to be unlocked, asked for %q", asked)
+	}
+}
+
+func between(s, start, end string) string {
+	i := strings.Index(s, start)
+	if i < 0 {
+		return ""
+	}
+	s = s[i+len(start):]
+	return s[:strings.Index(s, end)]
+}
@@ -0,0 +1,285 @@
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"mailcli/internal/email"
+	"mailcli/internal/textutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Signature states reported by Verification.
+const (
+	SignatureNone       = "none"
+	SignatureGood       = "good"
+	SignatureBad        = "bad"
+	SignatureUnknownKey = "unknown key"
+)
+
+// Verification describes what was found when opening a PGP message.
+type Verification struct {
+	Encrypted bool
+	// DecryptErr is set when the message is encrypted but could not be read.
+	DecryptErr error
+	Signature  string
+	// Signer is the primary user ID of a known signing key.
+	Signer       string
+	Fingerprint  string
+	KeyID        string
+	SignatureErr error
+	// Unprotected is set when an inline PGP body had text outside the
+	// armored block. That text is not covered by the signature or
+	// encryption, so OpenInline leaves it out.
+	Unprotected bool
+
+	signer *openpgp.Entity
+}
+
+// SignedBy reports whether address is in a user ID of the signing key. A
+// good signature from a key that is not the sender's does not show who
+// wrote the message.
+func (v *Verification) SignedBy(address string) bool {
+	return v.signer != nil && address != "" && matchesAddress(v.signer, strings.ToLower(address))
+}
+
+// String is a one-line summary suitable for display above the body.
+func (v *Verification) String() string {
+	var parts []string
+	if v.Encrypted {
+		if v.DecryptErr != nil {
+			return fmt.Sprintf("encrypted, could not decrypt: %v", v.DecryptErr)
+		}
+		parts = append(parts, "encrypted")
+	}
+	switch v.Signature {
+	case SignatureGood:
+		parts = append(parts, fmt.Sprintf("good signature from %s (%s)", v.Signer, v.Fingerprint))
+	case SignatureBad:
+		parts = append(parts, fmt.Sprintf("BAD signature from %s (%s): %v", textutil.FirstNonEmpty(v.Signer, "key "+v.KeyID), textutil.FirstNonEmpty(v.Fingerprint, v.KeyID), v.SignatureErr))
+	case SignatureUnknownKey:
+		parts = append(parts, fmt.Sprintf("signed by unknown key %s", v.KeyID))
+	default:
+		parts = append(parts, "not signed")
+	}
+	if v.Unprotected {
+		parts = append(parts, "unprotected text around it not shown")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Open decrypts and verifies a PGP/MIME message (RFC 3156). It returns the
+// inner MIME entity, or nil and a nil Verification when raw is not PGP/MIME.
+func (k *Keyring) Open(raw []byte, passphrase PassphraseFunc) ([]byte, *Verification, error) {
+	raw = email.CanonicalLineEndings(raw)
+	mediaType, params, ok := email.MediaType(raw)
+	if !ok {
+		return nil, nil, nil
+	}
+	protocol := strings.ToLower(params["protocol"])
+	switch {
+	case mediaType == "multipart/signed" && protocol == "application/pgp-signature":
+		return k.openSigned(raw, params["boundary"])
+	case mediaType == "multipart/encrypted" && protocol == "application/pgp-encrypted":
+		return k.openEncrypted(raw, params["boundary"], passphrase)
+	}
+	return nil, nil, nil
+}
+
+func (k *Keyring) openSigned(raw []byte, boundary string) ([]byte, *Verification, error) {
+	parts, err := email.SplitMultipart(raw, boundary)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("multipart/signed message has %d parts, expected 2", len(parts))
+	}
+	sig, err := email.DecodePart(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	v := k.verifyDetached(parts[0], sig)
+	return parts[0], v, nil
+}
+
+func (k *Keyring) openEncrypted(raw []byte, boundary string, passphrase PassphraseFunc) ([]byte, *Verification, error) {
+	parts, err := email.SplitMultipart(raw, boundary)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("multipart/encrypted message has %d parts, expected 2", len(parts))
+	}
+	data, err := email.DecodePart(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, v := k.decrypt(data, passphrase)
+	if v.DecryptErr != nil {
+		return nil, v, nil
+	}
+	// Sign-then-encrypt as separate layers (RFC 3156 section 6.1).
+	if inner, innerV, err := k.Open(plain, passphrase); err == nil && innerV != nil {
+		innerV.Encrypted = true
+		return inner, innerV, nil
+	}
+	return plain, v, nil
+}
+
+// OpenInline handles a text body holding an inline PGP message or a
+// clear-signed message. It returns only the verified or decrypted text, so
+// nothing an attacker adds around the block is shown as protected. It
+// returns ok=false when the text contains neither.
+func (k *Keyring) OpenInline(text string, passphrase PassphraseFunc) (string, *Verification, bool) {
+	if start := strings.Index(text, "-----BEGIN PGP SIGNED MESSAGE-----"); start >= 0 {
+		block, rest := clearsign.Decode([]byte(text[start:]))
+		if block == nil {
+			return "", nil, false
+		}
+		sig, err := io.ReadAll(block.ArmoredSignature.Body)
+		if err != nil {
+			return "", nil, false
+		}
+		v := k.verifyDetached(block.Bytes, sig)
+		v.Unprotected = hasText(text[:start]) || hasText(string(rest))
+		return string(block.Plaintext), v, true
+	}
+	start := strings.Index(text, "-----BEGIN PGP MESSAGE-----")
+	if start < 0 {
+		return "", nil, false
+	}
+	end := strings.Index(text[start:], "-----END PGP MESSAGE-----")
+	if end < 0 {
+		return "", nil, false
+	}
+	end += start + len("-----END PGP MESSAGE-----")
+	plain, v := k.decrypt([]byte(text[start:end]), passphrase)
+	if v.DecryptErr != nil {
+		return text, v, true
+	}
+	v.Unprotected = hasText(text[:start]) || hasText(text[end:])
+	return string(plain), v, true
+}
+
+func hasText(s string) bool {
+	return strings.TrimSpace(s) != ""
+}
+
+// decrypt reads an armored or binary OpenPGP message, verifying any
+// signature inside it.
+func (k *Keyring) decrypt(data []byte, passphrase PassphraseFunc) ([]byte, *Verification) {
+	v := &Verification{Encrypted: true, Signature: SignatureNone}
+	r := io.Reader(bytes.NewReader(data))
+	if bytes.Contains(data, []byte("-----BEGIN PGP MESSAGE-----")) {
+		block, err := armor.Decode(bytes.NewReader(data))
+		if err != nil {
+			v.DecryptErr = err
+			return nil, v
+		}
+		r = block.Body
+	}
+	keyring := append(append(openpgp.EntityList{}, k.Secret...), k.Public...)
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if symmetric || len(keys) == 0 {
+			return nil, errors.New("no secret key can decrypt this message")
+		}
+		for _, key := range keys {
+			if err := Unlock(key.Entity, passphrase); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	md, err := openpgp.ReadMessage(r, keyring, prompt, nil)
+	if err != nil {
+		if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+			err = errors.New("no secret key can decrypt this message")
+		}
+		v.DecryptErr = err
+		return nil, v
+	}
+	plain, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		v.DecryptErr = err
+		return nil, v
+	}
+	v.Encrypted = md.IsEncrypted
+	if md.IsSigned {
+		v.KeyID = formatKeyID(md.SignedByKeyId)
+		switch {
+		case md.SignedBy == nil:
+			v.Signature = SignatureUnknownKey
+		case md.SignatureError != nil:
+			v.Signature = SignatureBad
+			v.SignatureErr = md.SignatureError
+			v.setSigner(md.SignedBy.Entity)
+		default:
+			v.Signature = SignatureGood
+			v.setSigner(md.SignedBy.Entity)
+		}
+	}
+	return plain, v
+}
+
+func (k *Keyring) verifyDetached(signed, sig []byte) *Verification {
+	v := &Verification{Signature: SignatureNone}
+	sigReader := io.Reader(bytes.NewReader(sig))
+	if bytes.Contains(sig, []byte("-----BEGIN PGP SIGNATURE-----")) {
+		block, err := armor.Decode(bytes.NewReader(sig))
+		if err != nil {
+			v.Signature = SignatureBad
+			v.SignatureErr = err
+			return v
+		}
+		sigReader = block.Body
+	}
+	sigData, err := io.ReadAll(sigReader)
+	if err != nil {
+		v.Signature = SignatureBad
+		v.SignatureErr = err
+		return v
+	}
+	if p, err := packet.Read(bytes.NewReader(sigData)); err == nil {
+		if s, ok := p.(*packet.Signature); ok && s.IssuerKeyId != nil {
+			v.KeyID = formatKeyID(*s.IssuerKeyId)
+		}
+	}
+	_, signer, err := openpgp.VerifyDetachedSignature(k.VerificationKeys(), bytes.NewReader(signed), bytes.NewReader(sigData), nil)
+	switch {
+	case errors.Is(err, pgperrors.ErrUnknownIssuer):
+		v.Signature = SignatureUnknownKey
+	case err != nil:
+		v.Signature = SignatureBad
+		v.SignatureErr = err
+		if signer != nil {
+			v.setSigner(signer)
+		}
+	default:
+		v.Signature = SignatureGood
+		v.setSigner(signer)
+	}
+	return v
+}
+
+func (v *Verification) setSigner(e *openpgp.Entity) {
+	if e == nil {
+		return
+	}
+	v.signer = e
+	v.Fingerprint = Fingerprint(e)
+	if id := e.PrimaryIdentity(); id != nil {
+		v.Signer = id.Name
+	}
+}
+
+func formatKeyID(id uint64) string {
+	return fmt.Sprintf("%016X", id)
+}
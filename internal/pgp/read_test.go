@@ -0,0 +1,128 @@
+package pgp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+func TestOpenSignedMessage(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	signed, err := Sign([]byte(testMessage), alice)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	reader := &Keyring{Public: openpgp.EntityList{publicOnly(t, alice)}}
+	entity, v, err := reader.Open(signed, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if v.Signature != SignatureGood || !strings.Contains(v.Signer, "alice@example.com") {
+		t.Fatalf("expected good signature, got %s", v)
+	}
+	if !v.SignedBy("Alice@Example.com") || v.SignedBy("mallory@example.com") {
+		t.Fatal("expected the signer to match alice@example.com only")
+	}
+	if !strings.Contains(string(entity), "v1.2 is out.") {
+		t.Fatalf("unexpected entity: %q", entity)
+	}
+
+	tampered := bytes.Replace(signed, []byte("v1.2 is out."), []byte("v1.3 is out."), 1)
+	if _, v, _ := reader.Open(tampered, nil); v.Signature != SignatureBad {
+		t.Fatalf("expected bad signature, got %s", v)
+	}
+
+	stranger := &Keyring{}
+	if _, v, _ := stranger.Open(signed, nil); v.Signature != SignatureUnknownKey || v.KeyID == "" {
+		t.Fatalf("expected unknown key, got %s", v)
+	}
+
+	if _, v, err := reader.Open([]byte(testMessage), nil); v != nil || err != nil {
+		t.Fatalf("expected plain message to be ignored, got %v, %v", v, err)
+	}
+}
+
+func TestOpenEncryptedMessage(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	bob := newTestEntity(t, "Bob", "bob@example.com")
+	encrypted, err := Encrypt([]byte(testMessage), openpgp.EntityList{publicOnly(t, bob)}, alice)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if err := bob.EncryptPrivateKeys([]byte("hunter2"), nil); err != nil {
+		t.Fatalf("lock key: %v", err)
+	}
+
+	reader := &Keyring{Public: openpgp.EntityList{publicOnly(t, alice)}, Secret: openpgp.EntityList{bob}}
+	entity, v, err := reader.Open(encrypted, func(string) ([]byte, error) { return []byte("hunter2"), nil })
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if !v.Encrypted || v.Signature != SignatureGood {
+		t.Fatalf("expected encrypted message with good signature, got %s", v)
+	}
+	if !strings.HasPrefix(string(entity), "Content-Type: text/plain") {
+		t.Fatalf("unexpected entity: %q", entity)
+	}
+
+	outsider := &Keyring{Secret: openpgp.EntityList{newTestEntity(t, "Carol", "carol@example.com")}}
+	if _, v, _ := outsider.Open(encrypted, nil); v.DecryptErr == nil {
+		t.Fatalf("expected decryption to fail without the recipient key")
+	}
+}
+
+func TestOpenInline(t *testing.T) {
+	alice := newTestEntity(t, "Alice", "alice@example.com")
+	reader := &Keyring{Public: openpgp.EntityList{publicOnly(t, alice)}, Secret: openpgp.EntityList{alice}}
+
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, alice.PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("clearsign: %v", err)
+	}
+	_, _ = w.Write([]byte("Meet at noon.\n"))
+	_ = w.Close()
+	text, v, ok := reader.OpenInline(signed.String(), nil)
+	if !ok || v.Signature != SignatureGood || v.Unprotected || !strings.Contains(text, "Meet at noon.") || strings.Contains(text, "BEGIN PGP") {
+		t.Fatalf("unexpected clear-signed result: ok=%v %s %q", ok, v, text)
+	}
+	for _, spoofed := range []string{
+		"Wire the money to account 1234.\n" + signed.String(),
+		signed.String() + "\nP.S. the meeting moved to 3pm.\n",
+	} {
+		text, v, ok := reader.OpenInline(spoofed, nil)
+		if !ok || v.Signature != SignatureGood || !v.Unprotected || strings.Contains(text, "money") || strings.Contains(text, "P.S.") {
+			t.Fatalf("expected text outside the signed block to be left out: ok=%v %s %q", ok, v, text)
+		}
+		if !strings.Contains(v.String(), "unprotected text around it not shown") {
+			t.Fatalf("expected the status to mention the unprotected text, got %s", v)
+		}
+	}
+
+	var armored bytes.Buffer
+	aw, _ := armor.Encode(&armored, "PGP MESSAGE", nil)
+	pw, err := openpgp.Encrypt(aw, openpgp.EntityList{alice}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	_, _ = pw.Write([]byte("secret plans"))
+	_ = pw.Close()
+	_ = aw.Close()
+	text, v, ok = reader.OpenInline(armored.String(), nil)
+	if !ok || !v.Encrypted || v.Signature != SignatureNone || v.Unprotected || text != "secret plans" {
+		t.Fatalf("unexpected inline decryption: ok=%v %s %q", ok, v, text)
+	}
+	text, v, ok = reader.OpenInline("Click http://attacker.test/?\n"+armored.String()+"\n-- sent from my phone\n", nil)
+	if !ok || !v.Unprotected || text != "secret plans" {
+		t.Fatalf("expected only the decrypted text: ok=%v %s %q", ok, v, text)
+	}
+
+	if _, _, ok := reader.OpenInline("no pgp here", nil); ok {
+		t.Fatalf("expected plain text to be ignored")
+	}
+}
@@ -296,6 +296,112 @@ func GetPassword(username string) (string, error) {
 	return string(data), nil
 }
 
+// SetSMTPPassword stores the password for a separate SMTP login, kept apart
+// from the IMAP password even when the usernames match.
+func SetSMTPPassword(username, password string) error {
+	user := normalize(username)
+	if user == "" {
+		return errMissingUsername
+	}
+	if password == "" {
+		return errMissingPassword
+	}
+	return SetSecret(smtpPasswordKey(user), []byte(password))
+}
+
+func GetSMTPPassword(username string) (string, error) {
+	user := normalize(username)
+	if user == "" {
+		return "", errMissingUsername
+	}
+	data, err := GetSecret(smtpPasswordKey(user))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SetPGPPassphrase stores the passphrase protecting an OpenPGP secret key,
+// keyed by its fingerprint.
+func SetPGPPassphrase(fingerprint, passphrase string) error {
+	fpr := normalize(fingerprint)
+	if fpr == "" {
+		return errMissingSecretKey
+	}
+	if passphrase == "" {
+		return errMissingPassword
+	}
+	return SetSecret(pgpPassphraseKey(fpr), []byte(passphrase))
+}
+
+func GetPGPPassphrase(fingerprint string) (string, error) {
+	fpr := normalize(fingerprint)
+	if fpr == "" {
+		return "", errMissingSecretKey
+	}
+	data, err := GetSecret(pgpPassphraseKey(fpr))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SetSMIMEIdentity stores an S/MIME certificate chain and private key, as
+// PEM, for an address.
+func SetSMIMEIdentity(address string, pemData []byte) error {
+	addr := normalize(address)
+	if addr == "" {
+		return errMissingUsername
+	}
+	return SetSecret(smimeIdentityKey(addr), pemData)
+}
+
+func GetSMIMEIdentity(address string) ([]byte, error) {
+	addr := normalize(address)
+	if addr == "" {
+		return nil, errMissingUsername
+	}
+	return GetSecret(smimeIdentityKey(addr))
+}
+
+// SetDKIMKey stores the PEM private key used to sign mail for a selector and
+// domain.
+func SetDKIMKey(selector, domain string, pemData []byte) error {
+	name := dkimKeyName(selector, domain)
+	if name == "" {
+		return errMissingSecretKey
+	}
+	return SetSecret(name, pemData)
+}
+
+func GetDKIMKey(selector, domain string) ([]byte, error) {
+	name := dkimKeyName(selector, domain)
+	if name == "" {
+		return nil, errMissingSecretKey
+	}
+	return GetSecret(name)
+}
+
+func dkimKeyName(selector, domain string) string {
+	selector, domain = normalize(selector), normalize(domain)
+	if selector == "" || domain == "" {
+		return ""
+	}
+	return fmt.Sprintf("dkim:key:%s._domainkey.%s", selector, domain)
+}
+
+func smimeIdentityKey(address string) string {
+	return fmt.Sprintf("smime:identity:%s", address)
+}
+
+func pgpPassphraseKey(fingerprint string) string {
+	return fmt.Sprintf("pgp:passphrase:%s", fingerprint)
+}
+
+func smtpPasswordKey(username string) string {
+	return fmt.Sprintf("smtp:password:%s", username)
+}
+
 func passwordKey(username string) string {
 	return fmt.Sprintf("auth:password:%s", username)
 }
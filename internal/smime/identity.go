@@ -0,0 +1,292 @@
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Identity is the user's own certificate, its issuing chain and private key.
+type Identity struct {
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+	Key         crypto.PrivateKey
+}
+
+// IsPKCS12 reports whether data looks like a PKCS#12 file rather than PEM.
+func IsPKCS12(data []byte) bool {
+	return !bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+// ParseIdentity reads a PKCS#12 file or PEM certificates with an unencrypted
+// private key. The password is only used for PKCS#12.
+func ParseIdentity(data []byte, password string) (*Identity, error) {
+	if IsPKCS12(data) {
+		key, cert, chain, err := pkcs12.DecodeChain(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("read PKCS#12: %w", err)
+		}
+		return &Identity{Certificate: cert, Chain: chain, Key: key}, nil
+	}
+
+	var certs []*x509.Certificate
+	var key crypto.PrivateKey
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse private key: %w", err)
+			}
+			key = k
+		case "RSA PRIVATE KEY":
+			k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse private key: %w", err)
+			}
+			key = k
+		case "EC PRIVATE KEY":
+			k, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse private key: %w", err)
+			}
+			key = k
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, errors.New("encrypted PEM private keys are not supported; export a PKCS#12 file instead")
+		}
+	}
+	if key == nil {
+		return nil, errors.New("no private key found")
+	}
+	id := &Identity{Key: key}
+	for _, cert := range certs {
+		if id.Certificate == nil && publicKeyMatches(cert, key) {
+			id.Certificate = cert
+			continue
+		}
+		id.Chain = append(id.Chain, cert)
+	}
+	if id.Certificate == nil {
+		return nil, errors.New("no certificate matches the private key")
+	}
+	return id, nil
+}
+
+func publicKeyMatches(cert *x509.Certificate, key crypto.PrivateKey) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+// PEM encodes the identity as certificates followed by a PKCS#8 key.
+func (id *Identity) PEM() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, cert := range append([]*x509.Certificate{id.Certificate}, id.Chain...) {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return nil, err
+		}
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(id.Key)
+	if err != nil {
+		return nil, fmt.Errorf("encode private key: %w", err)
+	}
+	if err := pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+// Addresses lists the e-mail addresses a certificate is issued for, from
+// its subject alternative names and the legacy subject emailAddress.
+func Addresses(cert *x509.Certificate) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(addr string) {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+	for _, addr := range cert.EmailAddresses {
+		add(addr)
+	}
+	for _, name := range cert.Subject.Names {
+		if name.Type.Equal(oidEmailAddress) {
+			if s, ok := name.Value.(string); ok {
+				add(s)
+			}
+		}
+	}
+	return out
+}
+
+// ReadCertificates parses PEM or DER certificates.
+func ReadCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN ")) {
+		return x509.ParseCertificates(data)
+	}
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// MissingCertsError lists recipients without a usable certificate.
+type MissingCertsError struct {
+	Addresses []string
+}
+
+func (e *MissingCertsError) Error() string {
+	return fmt.Sprintf("no usable S/MIME certificate for %d recipient(s): %s", len(e.Addresses), strings.Join(e.Addresses, ", "))
+}
+
+// CertStore is a directory of recipient certificates stored as <address>.pem.
+type CertStore struct {
+	Dir string
+}
+
+// Add stores cert under each of its addresses and returns them.
+func (s CertStore) Add(cert *x509.Certificate) ([]string, error) {
+	addresses := Addresses(cert)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("certificate for %s names no e-mail address", cert.Subject)
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create certificate dir: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	for _, addr := range addresses {
+		if err := os.WriteFile(s.path(addr), data, 0o600); err != nil {
+			return nil, fmt.Errorf("write certificate: %w", err)
+		}
+	}
+	return addresses, nil
+}
+
+// Lookup finds a current encryption certificate for every address.
+func (s CertStore) Lookup(addresses []string) ([]*x509.Certificate, error) {
+	now := time.Now()
+	var certs []*x509.Certificate
+	var missing []string
+	for _, addr := range addresses {
+		cert, err := s.get(addr)
+		if err != nil || now.After(cert.NotAfter) || !canEncrypt(cert) {
+			missing = append(missing, addr)
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	if len(missing) > 0 {
+		return nil, &MissingCertsError{Addresses: missing}
+	}
+	return certs, nil
+}
+
+// List returns the stored certificates keyed by address.
+func (s CertStore) List() (map[string]*x509.Certificate, []string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	certs := map[string]*x509.Certificate{}
+	var addresses []string
+	for _, entry := range entries {
+		addr, ok := strings.CutSuffix(entry.Name(), ".pem")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		cert, err := s.get(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		certs[addr] = cert
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+	return certs, addresses, nil
+}
+
+func (s CertStore) get(addr string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(s.path(addr))
+	if err != nil {
+		return nil, err
+	}
+	certs, err := ReadCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("read certificate for %s: %w", addr, err)
+	}
+	return certs[0], nil
+}
+
+func (s CertStore) path(addr string) string {
+	name := strings.ToLower(strings.TrimSpace(addr))
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	return filepath.Join(s.Dir, name+".pem")
+}
+
+// canEncrypt reports whether the certificate carries an RSA key usable for
+// key transport, the only kind the CMS library can encrypt to.
+func canEncrypt(cert *x509.Certificate) bool {
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		return false
+	}
+	return cert.KeyUsage == 0 || cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0
+}
+
+// canSign reports whether the key type can produce CMS signatures.
+func canSign(key crypto.PrivateKey) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return true
+	}
+	return false
+}
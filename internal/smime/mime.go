@@ -0,0 +1,154 @@
+package smime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"mailcli/internal/email"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// Options selects how Protect transforms an outgoing message.
+type Options struct {
+	Sign    bool
+	Encrypt bool
+	// Identity signs the message and, when set, also receives an encrypted
+	// copy so the sent message stays readable.
+	Identity   *Identity
+	Recipients []*x509.Certificate
+}
+
+// Protect signs and/or encrypts raw as S/MIME (RFC 8551). When both are
+// requested the message is signed first and the signed entity encrypted.
+func Protect(raw []byte, opts Options) ([]byte, error) {
+	if opts.Sign {
+		signed, err := Sign(raw, opts.Identity)
+		if err != nil {
+			return nil, err
+		}
+		raw = signed
+	}
+	if opts.Encrypt {
+		to := opts.Recipients
+		if opts.Identity != nil && canEncrypt(opts.Identity.Certificate) {
+			to = append(append([]*x509.Certificate{}, to...), opts.Identity.Certificate)
+		}
+		return Encrypt(raw, to)
+	}
+	return raw, nil
+}
+
+// Sign wraps the message content in a multipart/signed entity with a detached
+// CMS signature over the original Content-* headers and body.
+func Sign(raw []byte, id *Identity) ([]byte, error) {
+	if id == nil {
+		return nil, errors.New("no S/MIME identity to sign with")
+	}
+	if !canSign(id.Key) {
+		return nil, fmt.Errorf("S/MIME signing does not support %T keys", id.Key)
+	}
+	outer, entity := email.SplitContentHeaders(raw)
+	sd, err := pkcs7.NewSignedData(entity)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSignerChain(id.Certificate, id.Key, id.Chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("sign message: %w", err)
+	}
+	sd.Detach()
+	sig, err := sd.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("sign message: %w", err)
+	}
+
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	writeOuter(&b, outer, raw)
+	fmt.Fprintf(&b, "Content-Type: multipart/signed; boundary=\"%s\";\r\n protocol=\"application/pkcs7-signature\"; micalg=sha-256\r\n\r\n", boundary)
+	b.WriteString("This is a cryptographically signed message in MIME format.\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n")
+	b.WriteString("Content-Description: S/MIME Cryptographic Signature\r\n\r\n")
+	b.WriteString(wrapBase64(sig))
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// Encrypt replaces the message content with an application/pkcs7-mime
+// enveloped-data entity readable by the given certificates.
+func Encrypt(raw []byte, to []*x509.Certificate) ([]byte, error) {
+	if len(to) == 0 {
+		return nil, errors.New("no S/MIME recipients to encrypt to")
+	}
+	outer, entity := email.SplitContentHeaders(raw)
+	enveloped, err := encryptAES256(entity, to)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt message: %w", err)
+	}
+	var b bytes.Buffer
+	writeOuter(&b, outer, raw)
+	b.WriteString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n")
+	b.WriteString("Content-Description: S/MIME Encrypted Message\r\n\r\n")
+	b.WriteString(wrapBase64(enveloped))
+	return b.Bytes(), nil
+}
+
+// encryptMu guards pkcs7.ContentEncryptionAlgorithm, which pkcs7 only
+// offers as a package variable.
+var encryptMu sync.Mutex
+
+// encryptAES256 encrypts with AES-256-CBC (RFC 8551 section 2.7) without
+// changing the algorithm for other users of pkcs7.
+func encryptAES256(content []byte, to []*x509.Certificate) ([]byte, error) {
+	encryptMu.Lock()
+	defer encryptMu.Unlock()
+	saved := pkcs7.ContentEncryptionAlgorithm
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES256CBC
+	defer func() { pkcs7.ContentEncryptionAlgorithm = saved }()
+	return pkcs7.Encrypt(content, to)
+}
+
+func writeOuter(b *bytes.Buffer, outer, raw []byte) {
+	b.Write(outer)
+	if !email.HasHeader(raw, "MIME-Version") {
+		b.WriteString("MIME-Version: 1.0\r\n")
+	}
+}
+
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	if encoded != "" {
+		b.WriteString(encoded + "\r\n")
+	}
+	return b.String()
+}
+
+func newBoundary() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "smime-" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,216 @@
+package smime
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mailcli/internal/email"
+	"mailcli/internal/textutil"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// Signature states reported by Verification.
+const (
+	SignatureNone      = "none"
+	SignatureGood      = "good"
+	SignatureBad       = "bad"
+	SignatureUntrusted = "untrusted"
+	// SignatureWrongSender is a valid signature from a certificate that
+	// does not name the From address.
+	SignatureWrongSender = "wrong sender"
+)
+
+// Verification describes what was found when opening an S/MIME message.
+type Verification struct {
+	Encrypted  bool
+	DecryptErr error
+	Signature  string
+	// SignatureErr explains a bad signature or an untrusted certificate.
+	SignatureErr error
+	Signer       *x509.Certificate
+	// Sender is the From address the signer was checked against.
+	Sender string
+}
+
+// String is a one-line summary suitable for display above the body.
+func (v *Verification) String() string {
+	var parts []string
+	if v.Encrypted {
+		if v.DecryptErr != nil {
+			return fmt.Sprintf("encrypted, could not decrypt: %v", v.DecryptErr)
+		}
+		parts = append(parts, "encrypted")
+	}
+	switch v.Signature {
+	case SignatureGood:
+		parts = append(parts, "good signature from "+describeCertificate(v.Signer))
+	case SignatureUntrusted:
+		parts = append(parts, fmt.Sprintf("valid signature from %s, but the certificate is not trusted: %v", describeCertificate(v.Signer), v.SignatureErr))
+	case SignatureWrongSender:
+		parts = append(parts, fmt.Sprintf("valid signature from %s, but the certificate is not for the sender %s", describeCertificate(v.Signer), textutil.FirstNonEmpty(v.Sender, "(none)")))
+	case SignatureBad:
+		parts = append(parts, fmt.Sprintf("BAD signature: %v", v.SignatureErr))
+	default:
+		parts = append(parts, "not signed")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeCertificate(cert *x509.Certificate) string {
+	if cert == nil {
+		return "unknown signer"
+	}
+	desc := cert.Subject.CommonName
+	if desc == "" {
+		desc = cert.Subject.String()
+	}
+	if addresses := Addresses(cert); len(addresses) > 0 {
+		desc += " <" + strings.Join(addresses, ", ") + ">"
+	}
+	desc += fmt.Sprintf(", issued by %s, valid %s to %s", textutil.FirstNonEmpty(cert.Issuer.CommonName, cert.Issuer.String()),
+		cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"))
+	if time.Now().After(cert.NotAfter) {
+		desc += " (expired)"
+	}
+	return desc
+}
+
+// OpenOptions supplies the keys and trust anchors for Open.
+type OpenOptions struct {
+	// Identities are tried in turn to decrypt enveloped data.
+	Identities []*Identity
+	// Roots verifies signer certificates; nil uses the system pool.
+	Roots *x509.CertPool
+}
+
+// IsEncrypted reports whether raw is an S/MIME enveloped-data message, so
+// callers only load private keys when needed.
+func IsEncrypted(raw []byte) bool {
+	mediaType, params, ok := email.MediaType(raw)
+	return ok && isPKCS7Mime(mediaType) && strings.EqualFold(params["smime-type"], "enveloped-data")
+}
+
+// Open decrypts and verifies an S/MIME message. It returns the inner MIME
+// entity, or nil and a nil Verification when raw is not S/MIME. A signature
+// is only reported as good when the certificate names the From address.
+func Open(raw []byte, opts OpenOptions) ([]byte, *Verification, error) {
+	raw = email.CanonicalLineEndings(raw)
+	sender, _ := email.ExtractSender(raw)
+	return open(raw, opts, sender)
+}
+
+func open(raw []byte, opts OpenOptions, sender string) ([]byte, *Verification, error) {
+	mediaType, params, ok := email.MediaType(raw)
+	if !ok {
+		return nil, nil, nil
+	}
+	protocol := strings.ToLower(params["protocol"])
+	switch {
+	case mediaType == "multipart/signed" && (protocol == "application/pkcs7-signature" || protocol == "application/x-pkcs7-signature"):
+		return openSigned(raw, params["boundary"], opts, sender)
+	case isPKCS7Mime(mediaType):
+		der, err := email.DecodePart(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		p7, err := pkcs7.Parse(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse S/MIME content: %w", err)
+		}
+		if len(p7.Signers) > 0 {
+			// Opaque signed-data carries the content inside the signature.
+			v := verify(p7, opts.Roots, sender)
+			return email.CanonicalLineEndings(p7.Content), v, nil
+		}
+		return openEnveloped(p7, opts, sender)
+	}
+	return nil, nil, nil
+}
+
+func openEnveloped(p7 *pkcs7.PKCS7, opts OpenOptions, sender string) ([]byte, *Verification, error) {
+	v := &Verification{Encrypted: true, Signature: SignatureNone}
+	var plain []byte
+	err := errors.New("no S/MIME identity can decrypt this message")
+	for _, id := range opts.Identities {
+		if plain, err = p7.Decrypt(id.Certificate, id.Key); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		v.DecryptErr = err
+		return nil, v, nil
+	}
+	if inner, innerV, err := open(plain, opts, sender); err == nil && innerV != nil {
+		innerV.Encrypted = true
+		return inner, innerV, nil
+	}
+	return plain, v, nil
+}
+
+func openSigned(raw []byte, boundary string, opts OpenOptions, sender string) ([]byte, *Verification, error) {
+	parts, err := email.SplitMultipart(raw, boundary)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("multipart/signed message has %d parts, expected 2", len(parts))
+	}
+	der, err := email.DecodePart(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return parts[0], &Verification{Signature: SignatureBad, SignatureErr: err}, nil
+	}
+	p7.Content = parts[0]
+	return parts[0], verify(p7, opts.Roots, sender), nil
+}
+
+// verify checks the signature first, the certificate chain second and the
+// sender last, so a message from an unknown CA or from a certificate issued
+// to someone else is reported apart from a tampered one.
+func verify(p7 *pkcs7.PKCS7, roots *x509.CertPool, sender string) *Verification {
+	v := &Verification{Signature: SignatureGood, Signer: p7.GetOnlySigner(), Sender: sender}
+	if err := p7.Verify(); err != nil {
+		v.Signature = SignatureBad
+		v.SignatureErr = err
+		return v
+	}
+	if roots == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		roots = pool
+	}
+	if err := p7.VerifyWithChain(roots); err != nil {
+		v.Signature = SignatureUntrusted
+		v.SignatureErr = err
+		return v
+	}
+	if !namesAddress(v.Signer, sender) {
+		v.Signature = SignatureWrongSender
+	}
+	return v
+}
+
+func namesAddress(cert *x509.Certificate, address string) bool {
+	if cert == nil || address == "" {
+		return false
+	}
+	for _, addr := range Addresses(cert) {
+		if strings.EqualFold(addr, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPKCS7Mime(mediaType string) bool {
+	return mediaType == "application/pkcs7-mime" || mediaType == "application/x-pkcs7-mime"
+}
@@ -0,0 +1,214 @@
+package smime
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/pkcs7"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: release\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"v1.2 is out.\r\n"
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, name, addr string) *Identity {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: name},
+		EmailAddresses: []string{addr},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(24 * time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return &Identity{Certificate: cert, Chain: []*x509.Certificate{ca.cert}, Key: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func TestSignAndVerify(t *testing.T) {
+	ca := newTestCA(t)
+	alice := ca.issue(t, "Alice", "alice@example.com")
+
+	signed, err := Sign([]byte(testMessage), alice)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	out := string(signed)
+	if !strings.Contains(out, "protocol=\"application/pkcs7-signature\"") || !strings.Contains(out, "Subject: release\r\n") {
+		t.Fatalf("unexpected signed message:\n%s", out)
+	}
+
+	entity, v, err := Open(signed, OpenOptions{Roots: ca.pool()})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if v.Signature != SignatureGood || !strings.Contains(v.String(), "alice@example.com") {
+		t.Fatalf("expected good signature, got %s", v)
+	}
+	if !strings.Contains(string(entity), "v1.2 is out.") {
+		t.Fatalf("unexpected entity: %q", entity)
+	}
+
+	if _, v, _ := Open(signed, OpenOptions{Roots: x509.NewCertPool()}); v.Signature != SignatureUntrusted {
+		t.Fatalf("expected untrusted signature, got %s", v)
+	}
+
+	mallory := ca.issue(t, "Mallory", "mallory@example.com")
+	forged, err := Sign([]byte(testMessage), mallory)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, v, _ := Open(forged, OpenOptions{Roots: ca.pool()}); v.Signature != SignatureWrongSender || !strings.Contains(v.String(), "not for the sender alice@example.com") {
+		t.Fatalf("expected a signature from another address to be flagged, got %s", v)
+	}
+
+	tampered := bytes.Replace(signed, []byte("v1.2 is out."), []byte("v1.3 is out."), 1)
+	if _, v, _ := Open(tampered, OpenOptions{Roots: ca.pool()}); v.Signature != SignatureBad {
+		t.Fatalf("expected bad signature, got %s", v)
+	}
+
+	if _, v, err := Open([]byte(testMessage), OpenOptions{}); v != nil || err != nil {
+		t.Fatalf("expected plain message to be ignored, got %v, %v", v, err)
+	}
+}
+
+func TestSignedAndEncryptedRoundTrip(t *testing.T) {
+	ca := newTestCA(t)
+	alice := ca.issue(t, "Alice", "alice@example.com")
+	bob := ca.issue(t, "Bob", "bob@example.com")
+
+	algorithm := pkcs7.ContentEncryptionAlgorithm
+	sealed, err := Protect([]byte(testMessage), Options{
+		Sign:       true,
+		Encrypt:    true,
+		Identity:   alice,
+		Recipients: []*x509.Certificate{bob.Certificate},
+	})
+	if err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+	if pkcs7.ContentEncryptionAlgorithm != algorithm {
+		t.Fatal("expected Encrypt to leave the pkcs7 default algorithm alone")
+	}
+	if !IsEncrypted(sealed) || bytes.Contains(sealed, []byte("v1.2 is out.")) {
+		t.Fatalf("expected enveloped message:\n%s", sealed)
+	}
+
+	for _, reader := range []*Identity{bob, alice} {
+		entity, v, err := Open(sealed, OpenOptions{Identities: []*Identity{reader}, Roots: ca.pool()})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if !v.Encrypted || v.Signature != SignatureGood {
+			t.Fatalf("expected encrypted good signature, got %s", v)
+		}
+		if !strings.Contains(string(entity), "v1.2 is out.") {
+			t.Fatalf("unexpected entity: %q", entity)
+		}
+	}
+
+	stranger := ca.issue(t, "Mallory", "mallory@example.com")
+	if _, v, _ := Open(sealed, OpenOptions{Identities: []*Identity{stranger}}); v.DecryptErr == nil {
+		t.Fatalf("expected decryption failure, got %s", v)
+	}
+}
+
+func TestIdentityPEMRoundTrip(t *testing.T) {
+	ca := newTestCA(t)
+	alice := ca.issue(t, "Alice", "alice@example.com")
+	data, err := alice.PEM()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	parsed, err := ParseIdentity(data, "")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !parsed.Certificate.Equal(alice.Certificate) || len(parsed.Chain) != 1 {
+		t.Fatalf("unexpected identity: %s with %d chain certs", parsed.Certificate.Subject, len(parsed.Chain))
+	}
+}
+
+func TestCertStoreLookupReportsMissing(t *testing.T) {
+	ca := newTestCA(t)
+	bob := ca.issue(t, "Bob", "bob@example.com")
+	store := CertStore{Dir: t.TempDir()}
+	if _, err := store.Add(bob.Certificate); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	certs, err := store.Lookup([]string{"Bob@Example.com"})
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("lookup: %v, %d certs", err, len(certs))
+	}
+
+	_, err = store.Lookup([]string{"bob@example.com", "carol@example.com", "dave@example.com"})
+	var missing *MissingCertsError
+	if !errors.As(err, &missing) || len(missing.Addresses) != 2 {
+		t.Fatalf("expected two missing addresses, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package smtp
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"mailcli/internal/config"
+
+	"github.com/emersion/go-sasl"
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+// Mechanisms tried by auth_mechanism "auto", in order of preference. Over
+// TLS any of them will do and PLAIN is the most widely supported; without
+// TLS, CheckTransport leaves only CRAM-MD5, which never sends the password.
+var autoMechanisms = []string{config.SMTPAuthPlain, config.SMTPAuthLogin, config.SMTPAuthCRAMMD5}
+
+// NewSASLClient returns the client for cfg.SMTP.AuthMechanism. When it is
+// "auto", it picks the first mechanism in the server's EHLO AUTH line that
+// CheckTransport allows on this connection. It returns nil when
+// authentication is disabled.
+func NewSASLClient(cfg config.Config, advertised string, encrypted bool) (sasl.Client, error) {
+	mechanism := strings.ToLower(cfg.SMTP.AuthMechanism)
+	if mechanism == "" {
+		mechanism = config.SMTPAuthAuto
+	}
+	if mechanism == config.SMTPAuthNone {
+		return nil, nil
+	}
+	if mechanism != config.SMTPAuthAuto {
+		return newSASLClient(cfg, mechanism)
+	}
+
+	offered := map[string]bool{}
+	for _, m := range strings.Fields(advertised) {
+		offered[strings.ToLower(m)] = true
+	}
+	if len(offered) == 0 {
+		return nil, fmt.Errorf("smtp: server does not advertise AUTH; set smtp.auth_mechanism to none if the relay does not require authentication")
+	}
+	var fallback sasl.Client
+	for _, m := range autoMechanisms {
+		if !offered[m] {
+			continue
+		}
+		client, err := newSASLClient(cfg, m)
+		if err != nil {
+			return nil, err
+		}
+		if CheckTransport(client, encrypted, cfg.SMTP.Host) == nil {
+			return client, nil
+		}
+		if fallback == nil {
+			fallback = client
+		}
+	}
+	if fallback != nil {
+		// Let CheckTransport explain why none of them can be used.
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("smtp: no supported authentication mechanism in %q; set smtp.auth_mechanism explicitly", advertised)
+}
+
+func newSASLClient(cfg config.Config, mechanism string) (sasl.Client, error) {
+	username, password := cfg.SMTPCredentials()
+	switch mechanism {
+	case config.SMTPAuthPlain:
+		return sasl.NewPlainClient("", username, password), nil
+	case config.SMTPAuthLogin:
+		return &loginClient{username: username, password: password}, nil
+	case config.SMTPAuthCRAMMD5:
+		return &cramMD5Client{username: username, secret: password}, nil
+	case config.SMTPAuthXOAUTH2:
+		return &xoauth2Client{username: username, token: password}, nil
+	}
+	return nil, fmt.Errorf("smtp: unsupported auth mechanism %q", cfg.SMTP.AuthMechanism)
+}
+
+func authenticate(c *gosmtp.Client, cfg config.Config) error {
+	_, advertised := c.Extension("AUTH")
+	_, encrypted := c.TLSConnectionState()
+	client, err := NewSASLClient(cfg, advertised, encrypted)
+	if err != nil || client == nil {
+		return err
+	}
+	if err := CheckTransport(client, encrypted, cfg.SMTP.Host); err != nil {
+		return err
+	}
+	return c.Auth(client)
+}
+
+// CheckTransport refuses mechanisms that expose the password or token on an
+// unencrypted connection, except to localhost.
+func CheckTransport(client sasl.Client, encrypted bool, host string) error {
+	if _, hashed := client.(*cramMD5Client); encrypted || hashed || isLocalhost(host) {
+		return nil
+	}
+	return errUnencryptedAuth
+}
+
+// loginClient implements LOGIN without an initial response and matches the
+// prompts loosely, since servers disagree on their exact wording.
+type loginClient struct {
+	username string
+	password string
+}
+
+func (a *loginClient) Start() (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a *loginClient) Next(challenge []byte) ([]byte, error) {
+	prompt := strings.ToLower(string(challenge))
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	}
+	return nil, sasl.ErrUnexpectedServerChallenge
+}
+
+type cramMD5Client struct {
+	username string
+	secret   string
+}
+
+func (a *cramMD5Client) Start() (string, []byte, error) {
+	return "CRAM-MD5", nil, nil
+}
+
+func (a *cramMD5Client) Next(challenge []byte) ([]byte, error) {
+	mac := hmac.New(md5.New, []byte(a.secret))
+	mac.Write(challenge)
+	return []byte(a.username + " " + hex.EncodeToString(mac.Sum(nil))), nil
+}
+
+// xoauth2Client sends an OAuth 2.0 access token the way Gmail and Microsoft
+// 365 expect. On failure the server sends a JSON error as a challenge, which
+// is acknowledged with an empty response so it can return the final status.
+type xoauth2Client struct {
+	username string
+	token    string
+}
+
+func (a *xoauth2Client) Start() (string, []byte, error) {
+	ir := "user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"
+	return "XOAUTH2", []byte(ir), nil
+}
+
+func (a *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	return []byte{}, nil
+}
@@ -0,0 +1,73 @@
+package smtp
+
+import (
+	"testing"
+
+	"mailcli/internal/config"
+)
+
+func TestNewSASLClientAuto(t *testing.T) {
+	cfg := config.Config{Auth: config.AuthConfig{Username: "user", Password: "secret"}}
+	cfg.SMTP.AuthMechanism = config.SMTPAuthAuto
+
+	cfg.SMTP.Host = "smtp.example.com"
+
+	client, err := NewSASLClient(cfg, "CRAM-MD5 LOGIN", true)
+	if err != nil {
+		t.Fatalf("auto: %v", err)
+	}
+	if mech, _, _ := client.Start(); mech != "LOGIN" {
+		t.Fatalf("expected LOGIN to be preferred over CRAM-MD5 over TLS, got %s", mech)
+	}
+
+	client, err = NewSASLClient(cfg, "PLAIN LOGIN CRAM-MD5", false)
+	if err != nil {
+		t.Fatalf("auto: %v", err)
+	}
+	if mech, _, _ := client.Start(); mech != "CRAM-MD5" {
+		t.Fatalf("expected CRAM-MD5 without TLS, got %s", mech)
+	}
+
+	client, err = NewSASLClient(cfg, "PLAIN LOGIN", false)
+	if err != nil {
+		t.Fatalf("auto: %v", err)
+	}
+	if err := CheckTransport(client, false, cfg.SMTP.Host); err == nil {
+		t.Fatalf("expected PLAIN without TLS to be refused")
+	}
+
+	if _, err := NewSASLClient(cfg, "", true); err == nil {
+		t.Fatalf("expected error when the server offers no AUTH")
+	}
+	if _, err := NewSASLClient(cfg, "GSSAPI", true); err == nil {
+		t.Fatalf("expected error when no mechanism is supported")
+	}
+
+	cfg.SMTP.AuthMechanism = config.SMTPAuthNone
+	if client, err := NewSASLClient(cfg, "PLAIN", true); err != nil || client != nil {
+		t.Fatalf("expected no client for none, got %v, %v", client, err)
+	}
+}
+
+func TestCRAMMD5(t *testing.T) {
+	// RFC 2195 section 2 example.
+	cfg := config.Config{SMTP: config.SMTPConfig{
+		AuthMechanism: config.SMTPAuthCRAMMD5,
+		Username:      "tim",
+		Password:      "tanstaaftanstaaf",
+	}}
+	client, err := NewSASLClient(cfg, "", false)
+	if err != nil {
+		t.Fatalf("cram-md5: %v", err)
+	}
+	resp, err := client.Next([]byte("<1896.697170952@postoffice.reston.mci.net>"))
+	if err != nil {
+		t.Fatalf("next: %v", err)
+	}
+	if got, want := string(resp), "tim b913a602c7eda7a495b4e6e7334d3890"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if err := CheckTransport(client, false, "smtp.example.com"); err != nil {
+		t.Fatalf("expected cram-md5 to be allowed without TLS: %v", err)
+	}
+}
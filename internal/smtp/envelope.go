@@ -0,0 +1,186 @@
+package smtp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+// Options controls the SMTP envelope beyond sender and recipients.
+type Options struct {
+	// Notify lists DSN conditions: success, failure, delay, or never.
+	Notify []string `json:"notify,omitempty"`
+	// Return selects how much of the message a DSN includes: full or hdrs.
+	Return string `json:"ret,omitempty"`
+	// Partial sends to the accepted recipients when others are rejected.
+	Partial bool `json:"partial,omitempty"`
+}
+
+func (o Options) Validate() error {
+	_, err := o.notify()
+	if err != nil {
+		return err
+	}
+	_, err = o.ret()
+	return err
+}
+
+func (o Options) notify() ([]gosmtp.DSNNotify, error) {
+	var notify []gosmtp.DSNNotify
+	never := false
+	for _, value := range o.Notify {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "success":
+			notify = append(notify, gosmtp.DSNNotifySuccess)
+		case "failure":
+			notify = append(notify, gosmtp.DSNNotifyFailure)
+		case "delay":
+			notify = append(notify, gosmtp.DSNNotifyDelayed)
+		case "never":
+			never = true
+			notify = append(notify, gosmtp.DSNNotifyNever)
+		default:
+			return nil, fmt.Errorf("invalid notify value %q (expected success, failure, delay, or never)", value)
+		}
+	}
+	if never && len(notify) > 1 {
+		return nil, fmt.Errorf("notify value never cannot be combined with others")
+	}
+	return notify, nil
+}
+
+func (o Options) ret() (gosmtp.DSNReturn, error) {
+	switch strings.ToLower(strings.TrimSpace(o.Return)) {
+	case "":
+		return "", nil
+	case "full":
+		return gosmtp.DSNReturnFull, nil
+	case "hdrs", "headers":
+		return gosmtp.DSNReturnHeaders, nil
+	}
+	return "", fmt.Errorf("invalid ret value %q (expected full or hdrs)", o.Return)
+}
+
+// Result reports what the server accepted.
+type Result struct {
+	Accepted []string
+	Rejected []*RecipientError
+	// DSNIgnored is set when DSN options were requested but the server does
+	// not offer the DSN extension.
+	DSNIgnored bool
+}
+
+// RecipientError is a recipient the server refused at RCPT TO.
+type RecipientError struct {
+	Recipient string
+	Err       error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Recipient, e.Err)
+}
+
+func (e *RecipientError) Unwrap() error {
+	return e.Err
+}
+
+// transact runs one MAIL/RCPT/DATA transaction on an authenticated client.
+func transact(c *gosmtp.Client, from string, recipients []string, msg []byte, opts Options) (Result, error) {
+	result := Result{}
+	notify, err := opts.notify()
+	if err != nil {
+		return result, err
+	}
+	ret, err := opts.ret()
+	if err != nil {
+		return result, err
+	}
+
+	if limit, ok := c.MaxMessageSize(); ok && limit > 0 && len(msg) > limit {
+		return result, fmt.Errorf("message is %s but the server accepts at most %s; remove or shrink attachments", formatSize(len(msg)), formatSize(limit))
+	}
+
+	mailOpts := &gosmtp.MailOptions{Size: int64(len(msg)), Return: ret}
+	if needsSMTPUTF8(from, recipients) {
+		if ok, _ := c.Extension("SMTPUTF8"); !ok {
+			return result, fmt.Errorf("the server does not support SMTPUTF8, required for internationalized addresses")
+		}
+		mailOpts.UTF8 = true
+	}
+	if len(notify) > 0 || ret != "" {
+		if ok, _ := c.Extension("DSN"); !ok {
+			result.DSNIgnored = true
+		}
+	}
+
+	if err := c.Mail(from, mailOpts); err != nil {
+		return result, err
+	}
+	rcptOpts := &gosmtp.RcptOptions{Notify: notify}
+	for _, rcpt := range recipients {
+		if err := c.Rcpt(rcpt, rcptOpts); err != nil {
+			var smtpErr *gosmtp.SMTPError
+			if !errors.As(err, &smtpErr) {
+				return result, err
+			}
+			result.Rejected = append(result.Rejected, &RecipientError{Recipient: rcpt, Err: err})
+			continue
+		}
+		result.Accepted = append(result.Accepted, rcpt)
+	}
+
+	if len(result.Rejected) > 0 && (!opts.Partial || len(result.Accepted) == 0) {
+		_ = c.Reset()
+		cause := worstRejection(result.Rejected)
+		if len(result.Accepted) == 0 {
+			return result, fmt.Errorf("the server rejected all %d recipient(s); message not sent: %w", len(recipients), cause)
+		}
+		return result, fmt.Errorf("the server rejected %d of %d recipient(s); message not sent (use --partial to send to the others): %w", len(result.Rejected), len(recipients), cause)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return result, err
+	}
+	if _, err := w.Write(msg); err != nil {
+		_ = w.Close()
+		return result, err
+	}
+	return result, w.Close()
+}
+
+// worstRejection prefers a permanent (5xx) rejection, so the send is only
+// considered temporary when every rejection was.
+func worstRejection(rejected []*RecipientError) *RecipientError {
+	for _, r := range rejected {
+		var smtpErr *gosmtp.SMTPError
+		if errors.As(r.Err, &smtpErr) && smtpErr.Code >= 500 {
+			return r
+		}
+	}
+	return rejected[0]
+}
+
+func needsSMTPUTF8(from string, recipients []string) bool {
+	for _, addr := range append([]string{from}, recipients...) {
+		for i := 0; i < len(addr); i++ {
+			if addr[i] >= utf8.RuneSelf {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
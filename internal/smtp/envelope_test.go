@@ -0,0 +1,135 @@
+package smtp
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+type testBackend struct {
+	delivered map[string]string
+	notify    []gosmtp.DSNNotify
+	utf8      bool
+	addr      string
+}
+
+func (b *testBackend) NewSession(*gosmtp.Conn) (gosmtp.Session, error) {
+	return &testSession{backend: b}, nil
+}
+
+type testSession struct {
+	backend *testBackend
+	rcpts   []string
+}
+
+func (s *testSession) Reset()        { s.rcpts = nil }
+func (s *testSession) Logout() error { return nil }
+
+func (s *testSession) Mail(from string, opts *gosmtp.MailOptions) error {
+	s.backend.utf8 = opts.UTF8
+	return nil
+}
+
+func (s *testSession) Rcpt(to string, opts *gosmtp.RcptOptions) error {
+	if strings.HasPrefix(to, "unknown") {
+		return &gosmtp.SMTPError{Code: 550, EnhancedCode: gosmtp.EnhancedCode{5, 1, 1}, Message: "no such user"}
+	}
+	s.backend.notify = opts.Notify
+	s.rcpts = append(s.rcpts, to)
+	return nil
+}
+
+func (s *testSession) Data(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range s.rcpts {
+		s.backend.delivered[rcpt] = string(data)
+	}
+	return nil
+}
+
+func startTestServer(t *testing.T) (*testBackend, func() *gosmtp.Client) {
+	t.Helper()
+	backend := &testBackend{delivered: map[string]string{}}
+	server := gosmtp.NewServer(backend)
+	server.Domain = "localhost"
+	server.MaxMessageBytes = 1024
+	server.EnableSMTPUTF8 = true
+	server.EnableDSN = true
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	backend.addr = ln.Addr().String()
+
+	return backend, func() *gosmtp.Client {
+		c, err := gosmtp.Dial(ln.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = c.Close()
+		})
+		return c
+	}
+}
+
+func TestTransactRejectedRecipients(t *testing.T) {
+	backend, dial := startTestServer(t)
+	msg := []byte("Subject: hi\r\n\r\nhello\r\n")
+	recipients := []string{"alice@example.com", "unknown@example.com"}
+
+	result, err := transact(dial(), "me@example.com", recipients, msg, Options{})
+	if err == nil {
+		t.Fatalf("expected error when a recipient is rejected")
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0].Recipient != "unknown@example.com" {
+		t.Fatalf("unexpected rejections: %v", result.Rejected)
+	}
+	if len(backend.delivered) != 0 {
+		t.Fatalf("expected nothing delivered, got %v", backend.delivered)
+	}
+
+	result, err = transact(dial(), "me@example.com", recipients, msg, Options{Partial: true, Notify: []string{"success", "failure"}})
+	if err != nil {
+		t.Fatalf("partial send: %v", err)
+	}
+	if len(result.Accepted) != 1 || len(result.Rejected) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if _, ok := backend.delivered["alice@example.com"]; !ok {
+		t.Fatalf("expected delivery to alice")
+	}
+	if len(backend.notify) != 2 || result.DSNIgnored {
+		t.Fatalf("expected DSN notify to be passed, got %v", backend.notify)
+	}
+}
+
+func TestTransactSizeAndSMTPUTF8(t *testing.T) {
+	backend, dial := startTestServer(t)
+
+	big := []byte("Subject: big\r\n\r\n" + strings.Repeat("x", 2048) + "\r\n")
+	if _, err := transact(dial(), "me@example.com", []string{"alice@example.com"}, big, Options{}); err == nil || !strings.Contains(err.Error(), "at most 1.0 KiB") {
+		t.Fatalf("expected size error, got %v", err)
+	}
+
+	msg := []byte("Subject: hi\r\n\r\nhello\r\n")
+	if _, err := transact(dial(), "me@example.com", []string{"jörg@example.de"}, msg, Options{}); err != nil {
+		t.Fatalf("utf8 send: %v", err)
+	}
+	if !backend.utf8 {
+		t.Fatalf("expected SMTPUTF8 for a non-ASCII recipient")
+	}
+}
@@ -0,0 +1,90 @@
+package smtp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mailcli/internal/config"
+	"mailcli/internal/tlsconfig"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+// Session is an authenticated SMTP connection that can deliver several
+// messages, one transaction each.
+type Session struct {
+	ctx  context.Context
+	c    *gosmtp.Client
+	stop func() bool
+}
+
+// Open connects and authenticates. Cancelling ctx closes the connection,
+// aborting any transaction in progress.
+func Open(ctx context.Context, cfg config.Config) (*Session, error) {
+	tlsConfig, err := tlsconfig.New(cfg.SMTP.TLSOptions, cfg.SMTP.Host, cfg.SMTP.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: %w", err)
+	}
+
+	// The connect timeout covers dialing, TLS and STARTTLS negotiation.
+	connectCtx := ctx
+	if cfg.SMTP.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(ctx, cfg.SMTP.ConnectTimeout)
+		defer cancel()
+	}
+
+	c, err := dial(connectCtx, cfg, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{ctx: ctx, c: c}
+	s.stop = context.AfterFunc(ctx, func() {
+		_ = c.Close()
+	})
+	if err := authenticate(c, cfg); err != nil {
+		s.abort()
+		return nil, s.wrap(err)
+	}
+	return s, nil
+}
+
+// Send delivers one message. After a failed transaction the session is
+// reset so the next message can be sent on the same connection.
+func (s *Session) Send(from string, recipients []string, msg []byte, opts Options) (Result, error) {
+	if len(recipients) == 0 {
+		return Result{}, fmt.Errorf("no recipients provided")
+	}
+	result, err := transact(s.c, from, recipients, msg, opts)
+	if err != nil {
+		var smtpErr *gosmtp.SMTPError
+		if errors.As(err, &smtpErr) {
+			_ = s.c.Reset()
+		}
+		return result, s.wrap(err)
+	}
+	return result, nil
+}
+
+// Close ends the session with QUIT.
+func (s *Session) Close() error {
+	err := s.c.Quit()
+	s.abort()
+	return s.wrap(err)
+}
+
+func (s *Session) abort() {
+	s.stop()
+	_ = s.c.Close()
+}
+
+func (s *Session) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := s.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"syscall"
+	"testing"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+func TestSessionReusesConnectionAfterRejection(t *testing.T) {
+	backend, dial := startTestServer(t)
+	s := &Session{ctx: context.Background(), c: dial(), stop: func() bool { return true }}
+
+	msg := []byte("Subject: hi\r\n\r\nhello\r\n")
+	if _, err := s.Send("me@example.com", []string{"unknown@example.com"}, msg, Options{}); err == nil {
+		t.Fatal("expected rejection")
+	}
+	for _, rcpt := range []string{"alice@example.com", "bob@example.com"} {
+		if _, err := s.Send("me@example.com", []string{rcpt}, msg, Options{}); err != nil {
+			t.Fatalf("send to %s: %v", rcpt, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if len(backend.delivered) != 2 {
+		t.Fatalf("expected two deliveries on one connection, got %v", backend.delivered)
+	}
+}
+
+// quitFailConn drops the connection when the client sends QUIT.
+type quitFailConn struct {
+	net.Conn
+}
+
+func (c quitFailConn) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("QUIT")) {
+		_ = c.Conn.Close()
+		return 0, syscall.EPIPE
+	}
+	return c.Conn.Write(p)
+}
+
+func TestSendOnceIgnoresQuitFailureAfterDelivery(t *testing.T) {
+	backend, _ := startTestServer(t)
+	conn, err := net.Dial("tcp", backend.addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c := gosmtp.NewClient(quitFailConn{conn})
+	s := &Session{ctx: context.Background(), c: c, stop: func() bool { return true }}
+
+	result, err := s.sendOnce("me@example.com", []string{"alice@example.com"}, []byte("Subject: hi\r\n\r\nhello\r\n"), Options{})
+	if err != nil {
+		t.Fatalf("expected delivery to succeed despite QUIT failing, got %v", err)
+	}
+	if len(result.Accepted) != 1 || backend.delivered["alice@example.com"] == "" {
+		t.Fatalf("expected one delivery, got %+v / %v", result, backend.delivered)
+	}
+}
@@ -1,81 +1,210 @@
 package smtp
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"net"
-	"net/smtp"
+	"strconv"
+	"syscall"
 	"time"
 
 	"mailcli/internal/config"
+	"mailcli/internal/tlsconfig"
+	"mailcli/internal/trace"
+
+	gosmtp "github.com/emersion/go-smtp"
 )
 
-func Send(cfg config.Config, from string, recipients []string, msg []byte) error {
+var errUnencryptedAuth = errors.New("smtp: refusing to send credentials over an unencrypted connection")
+
+func Send(ctx context.Context, cfg config.Config, from string, recipients []string, msg []byte, opts Options) (Result, error) {
 	if len(recipients) == 0 {
-		return fmt.Errorf("no recipients provided")
+		return Result{}, fmt.Errorf("no recipients provided")
 	}
 
-	addr := fmt.Sprintf("%s:%d", cfg.SMTP.Host, cfg.SMTP.Port)
-	host := cfg.SMTP.Host
+	s, err := Open(ctx, cfg)
+	if err != nil {
+		return Result{}, err
+	}
+	return s.sendOnce(from, recipients, msg, opts)
+}
+
+// sendOnce delivers one message and ends the session. The message is
+// delivered once the server accepts DATA, so a failing QUIT is ignored:
+// reporting it would have the caller queue the message again.
+func (s *Session) sendOnce(from string, recipients []string, msg []byte, opts Options) (Result, error) {
+	result, err := s.Send(from, recipients, msg, opts)
+	if err != nil {
+		s.abort()
+		return result, err
+	}
+	_ = s.Close()
+	return result, nil
+}
 
-	var c *smtp.Client
-	var err error
+// PeerCertificates connects to the SMTP server, negotiating TLS or STARTTLS
+// as configured, and returns the certificate chain it presents without
+// verifying it.
+func PeerCertificates(ctx context.Context, cfg config.Config) ([]*x509.Certificate, error) {
+	base, err := tlsconfig.New(cfg.SMTP.TLSOptions, cfg.SMTP.Host, cfg.SMTP.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("smtp: %w", err)
+	}
+	if !cfg.SMTP.TLS && !cfg.SMTP.StartTLS {
+		return nil, fmt.Errorf("smtp: neither tls nor starttls is enabled")
+	}
+	tlsConfig, state := tlsconfig.Capture(base)
 
+	connectCtx := ctx
+	if cfg.SMTP.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(ctx, cfg.SMTP.ConnectTimeout)
+		defer cancel()
+	}
+	c, err := dial(connectCtx, cfg, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	_ = c.Quit()
+	return state.PeerCertificates, nil
+}
+
+// dial connects and negotiates TLS or STARTTLS, leaving the client ready to
+// authenticate.
+func dial(connectCtx context.Context, cfg config.Config, tlsConfig *tls.Config) (*gosmtp.Client, error) {
+	addr := net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(connectCtx, "tcp", addr)
+	if err != nil {
+		return nil, connectError(connectCtx, cfg, err)
+	}
 	if cfg.SMTP.TLS {
-		tlsConfig := &tls.Config{
-			ServerName:         host,
-			InsecureSkipVerify: cfg.SMTP.InsecureSkipVerify,
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(connectCtx); err != nil {
+			_ = conn.Close()
+			return nil, connectError(connectCtx, cfg, err)
 		}
-		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, tlsConfig)
-		if err != nil {
-			return err
+		conn = tlsConn
+	}
+
+	debug := trace.SMTPWriter()
+	var c *gosmtp.Client
+	if !cfg.SMTP.TLS && cfg.SMTP.StartTLS {
+		if debug != nil {
+			conn = &plainTraceConn{Conn: conn, debug: debug}
 		}
-		c, err = smtp.NewClient(conn, host)
-		if err != nil {
-			return err
+		stop := context.AfterFunc(connectCtx, func() {
+			_ = conn.Close()
+		})
+		c, err = gosmtp.NewClientStartTLS(conn, tlsConfig)
+		if !stop() {
+			if err == nil {
+				_ = c.Close()
+			}
+			return nil, connectError(connectCtx, cfg, connectCtx.Err())
 		}
-	} else {
-		c, err = smtp.Dial(addr)
 		if err != nil {
-			return err
-		}
-		if cfg.SMTP.StartTLS {
-			tlsConfig := &tls.Config{
-				ServerName:         host,
-				InsecureSkipVerify: cfg.SMTP.InsecureSkipVerify,
-			}
-			if err := c.StartTLS(tlsConfig); err != nil {
-				_ = c.Quit()
-				return err
-			}
+			return nil, err
 		}
+	} else {
+		c = gosmtp.NewClient(conn)
+	}
+	if debug != nil {
+		c.DebugWriter = debug
+	}
+	if cfg.SMTP.CommandTimeout > 0 {
+		c.CommandTimeout = cfg.SMTP.CommandTimeout
 	}
-	defer c.Quit()
+	return c, nil
+}
 
-	auth := smtp.PlainAuth("", cfg.Auth.Username, cfg.Auth.Password, host)
-	if err := c.Auth(auth); err != nil {
-		return err
+func connectError(ctx context.Context, cfg config.Config, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &connectTimeoutError{host: cfg.SMTP.Host, timeout: cfg.SMTP.ConnectTimeout}
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
 	}
+	return err
+}
 
-	if err := c.Mail(from); err != nil {
-		return err
+// connectTimeoutError implements net.Error so IsTemporary treats it like
+// any other network timeout.
+type connectTimeoutError struct {
+	host    string
+	timeout time.Duration
+}
+
+func (e *connectTimeoutError) Error() string {
+	return fmt.Sprintf("smtp: connecting to %s timed out after %s", e.host, e.timeout)
+}
+
+func (e *connectTimeoutError) Timeout() bool   { return true }
+func (e *connectTimeoutError) Temporary() bool { return true }
+
+// IsTemporary reports whether a failed Send may succeed later: the server
+// was unreachable, the connection dropped, or it replied with a 4xx code.
+func IsTemporary(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
 	}
-	for _, rcpt := range recipients {
-		if err := c.Rcpt(rcpt); err != nil {
-			return err
-		}
+	var smtpErr *gosmtp.SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
 	}
-	w, err := c.Data()
-	if err != nil {
-		return err
+	return IsConnectionError(err)
+}
+
+// IsConnectionError reports whether err means the connection failed or was
+// dropped, rather than the server refusing a command.
+func IsConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
 	}
-	if _, err := w.Write(msg); err != nil {
-		_ = w.Close()
-		return err
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
 	}
-	if err := w.Close(); err != nil {
-		return err
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE)
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// plainTraceConn traces the cleartext part of a STARTTLS session, which
+// go-smtp performs before the caller can attach its DebugWriter. It stops at
+// the server's reply to STARTTLS so no TLS records are logged.
+type plainTraceConn struct {
+	net.Conn
+	debug    io.Writer
+	starting bool
+	done     bool
+}
+
+func (c *plainTraceConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 && !c.done {
+		_, _ = c.debug.Write(p[:n])
+		if c.starting && bytes.Contains(p[:n], []byte("\n")) {
+			c.done = true
+		}
 	}
+	return n, err
+}
 
-	return c.Quit()
+func (c *plainTraceConn) Write(p []byte) (int, error) {
+	if !c.done {
+		_, _ = c.debug.Write(p)
+		if bytes.HasPrefix(bytes.ToUpper(p), []byte("STARTTLS")) {
+			c.starting = true
+		}
+	}
+	return c.Conn.Write(p)
 }
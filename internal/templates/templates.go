@@ -0,0 +1,322 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ext is appended to template names that are given without an extension.
+const Ext = ".tmpl"
+
+// Message is a rendered template: headers from the front matter plus the
+// plain and (optional) HTML bodies.
+type Message struct {
+	From        string      `yaml:"from"`
+	Identity    string      `yaml:"identity"`
+	To          AddressList `yaml:"to"`
+	Cc          AddressList `yaml:"cc"`
+	Bcc         AddressList `yaml:"bcc"`
+	ReplyTo     string      `yaml:"reply_to"`
+	Subject     string      `yaml:"subject"`
+	Attachments []string    `yaml:"attachments"`
+	Inline      []string    `yaml:"inline"`
+	Format      string      `yaml:"format"`
+	Body        string      `yaml:"-"`
+	BodyHTML    string      `yaml:"-"`
+}
+
+// AddressList accepts either a YAML list or a comma-separated string.
+type AddressList []string
+
+func (l *AddressList) UnmarshalYAML(node *yaml.Node) error {
+	var values []string
+	switch node.Kind {
+	case yaml.ScalarNode:
+		values = strings.Split(node.Value, ",")
+	case yaml.SequenceNode:
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("line %d: expected an address or a list of addresses", node.Line)
+	}
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	*l = out
+	return nil
+}
+
+// Template is a text/template file with optional YAML front matter between
+// "---" lines. The body renders the plain text part; a {{define "html"}}
+// block, if present, renders the HTML part with html/template escaping.
+type Template struct {
+	Name        string
+	Path        string
+	FrontMatter string
+	Body        string
+}
+
+// Resolve finds a template by path, or by name in dir.
+func Resolve(dir, name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	if dir != "" && !strings.ContainsRune(name, os.PathSeparator) {
+		candidates := []string{filepath.Join(dir, name)}
+		if filepath.Ext(name) == "" {
+			candidates = append(candidates, filepath.Join(dir, name+Ext))
+		}
+		for _, c := range candidates {
+			if _, err := os.Stat(c); err == nil {
+				return c, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("template %q not found", name)
+}
+
+func Load(path string) (*Template, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // template path is chosen by the user
+	if err != nil {
+		return nil, fmt.Errorf("read template: %w", err)
+	}
+	front, body, err := splitFrontMatter(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), Ext)
+	return &Template{Name: name, Path: path, FrontMatter: front, Body: body}, nil
+}
+
+func splitFrontMatter(data string) (string, string, error) {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	if !strings.HasPrefix(data, "---\n") {
+		return "", data, nil
+	}
+	rest := data[len("---\n"):]
+	if strings.HasPrefix(rest, "---\n") {
+		return "", rest[len("---\n"):], nil
+	}
+	end := strings.Index(rest, "\n---\n")
+	if end < 0 {
+		if strings.HasSuffix(rest, "\n---") {
+			return rest[:len(rest)-len("\n---")], "", nil
+		}
+		return "", "", errors.New("front matter is not terminated by ---")
+	}
+	return rest[:end], rest[end+len("\n---\n"):], nil
+}
+
+// Render executes the template with vars. Missing variables are errors, so
+// a typo never sends "<no value>"; use {{index . "name"}} for optional ones.
+func (t *Template) Render(vars map[string]any) (Message, error) {
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	msg, err := t.renderFrontMatter(vars)
+	if err != nil {
+		return msg, err
+	}
+
+	body, err := execText(t.Name, t.Body, vars)
+	if err != nil {
+		return msg, err
+	}
+	if body = strings.Trim(body, "\n"); body != "" {
+		msg.Body = body + "\n"
+	}
+
+	html, err := htmltemplate.New(t.Name).Funcs(htmltemplate.FuncMap(funcs)).Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return msg, fmt.Errorf("parse template %s: %w", t.Name, err)
+	}
+	if html.Lookup("html") != nil {
+		var buf bytes.Buffer
+		if err := html.ExecuteTemplate(&buf, "html", vars); err != nil {
+			return msg, fmt.Errorf("render template %s: %w", t.Name, err)
+		}
+		msg.BodyHTML = strings.TrimSpace(buf.String())
+	}
+	return msg, nil
+}
+
+// actionPattern matches a template action in the front matter.
+var actionPattern = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+
+// placeholderPattern matches what renderFrontMatter replaces actions with:
+// plain YAML that is valid quoted or unquoted, in block or flow context.
+var placeholderPattern = regexp.MustCompile(`mailcliAction(\d+)x`)
+
+// renderFrontMatter parses the front matter as YAML first and then renders
+// each value as its own template, so variable values (from --var or merge
+// rows) can never change the YAML structure, e.g. add a bcc key.
+func (t *Template) renderFrontMatter(vars map[string]any) (Message, error) {
+	var msg Message
+	if strings.TrimSpace(t.FrontMatter) == "" {
+		return msg, nil
+	}
+	var actions []string
+	protected := actionPattern.ReplaceAllStringFunc(t.FrontMatter, func(action string) string {
+		actions = append(actions, action)
+		return fmt.Sprintf("mailcliAction%dx", len(actions)-1)
+	})
+	if err := yaml.Unmarshal([]byte(protected), &msg); err != nil {
+		return msg, fmt.Errorf("%s: parse front matter: %w", t.Name, err)
+	}
+
+	render := func(field, value string) (string, error) {
+		if !placeholderPattern.MatchString(value) {
+			return value, nil
+		}
+		text := placeholderPattern.ReplaceAllStringFunc(value, func(p string) string {
+			i, _ := strconv.Atoi(placeholderPattern.FindStringSubmatch(p)[1])
+			if i < len(actions) {
+				return actions[i]
+			}
+			return p
+		})
+		return execText(t.Name+":"+field, text, vars)
+	}
+	renderList := func(field string, values []string) ([]string, error) {
+		var out []string
+		for _, v := range values {
+			rendered, err := render(field, v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, rendered)
+		}
+		return out, nil
+	}
+	// An address variable may hold a comma-separated list.
+	renderAddresses := func(field string, values AddressList) (AddressList, error) {
+		rendered, err := renderList(field, values)
+		if err != nil {
+			return nil, err
+		}
+		var out AddressList
+		for _, v := range rendered {
+			for _, addr := range strings.Split(v, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					out = append(out, addr)
+				}
+			}
+		}
+		return out, nil
+	}
+
+	var err error
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{
+		{"from", &msg.From}, {"identity", &msg.Identity}, {"reply_to", &msg.ReplyTo},
+		{"subject", &msg.Subject}, {"format", &msg.Format},
+	} {
+		if *f.value, err = render(f.name, *f.value); err != nil {
+			return msg, err
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		value *AddressList
+	}{{"to", &msg.To}, {"cc", &msg.Cc}, {"bcc", &msg.Bcc}} {
+		if *f.value, err = renderAddresses(f.name, *f.value); err != nil {
+			return msg, err
+		}
+	}
+	if msg.Attachments, err = renderList("attachments", msg.Attachments); err != nil {
+		return msg, err
+	}
+	if msg.Inline, err = renderList("inline", msg.Inline); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+func execText(name, text string, vars map[string]any) (string, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"join":  strings.Join,
+	"now":   time.Now,
+}
+
+// ParseVars turns key=value pairs into template data.
+func ParseVars(pairs []string) (map[string]any, error) {
+	vars := make(map[string]any, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --var %q (expected key=value)", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+type Info struct {
+	Name    string
+	Path    string
+	Subject string
+}
+
+// List returns the templates in dir with their (unrendered) subject lines.
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read templates dir: %w", err)
+	}
+	var out []Info
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info := Info{Name: strings.TrimSuffix(entry.Name(), Ext), Path: path}
+		if t, err := Load(path); err == nil {
+			var front struct {
+				Subject string `yaml:"subject"`
+			}
+			// Front matter may not be valid YAML before rendering; the
+			// subject is best effort.
+			_ = yaml.Unmarshal([]byte(t.FrontMatter), &front)
+			info.Subject = front.Subject
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
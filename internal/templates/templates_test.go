@@ -0,0 +1,107 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const weekly = `---
+subject: "Status for week {{.week}}"
+to: team@example.com, lead@example.com
+cc: [boss@example.com]
+attachments:
+  - report-{{.week}}.pdf
+---
+Hi team,
+
+Week {{.week}} went {{.mood | upper}}.
+{{define "html"}}<p>Week {{.week}} went <b>{{.mood}}</b>.</p>{{end}}
+`
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "weekly.tmpl")
+	if err := os.WriteFile(path, []byte(weekly), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := Resolve(dir, "weekly")
+	if err != nil || resolved != path {
+		t.Fatalf("resolve: %q %v", resolved, err)
+	}
+	tmpl, err := Load(resolved)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	vars, err := ParseVars([]string{"week=42", "mood=<fine>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := tmpl.Render(vars)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	if msg.Subject != "Status for week 42" {
+		t.Fatalf("unexpected subject %q", msg.Subject)
+	}
+	if strings.Join(msg.To, ";") != "team@example.com;lead@example.com" || strings.Join(msg.Cc, ";") != "boss@example.com" {
+		t.Fatalf("unexpected recipients %v %v", msg.To, msg.Cc)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0] != "report-42.pdf" {
+		t.Fatalf("unexpected attachments %v", msg.Attachments)
+	}
+	if msg.Body != "Hi team,\n\nWeek 42 went <FINE>.\n" {
+		t.Fatalf("unexpected body %q", msg.Body)
+	}
+	if msg.BodyHTML != "<p>Week 42 went <b>&lt;fine&gt;</b>.</p>" {
+		t.Fatalf("unexpected html %q", msg.BodyHTML)
+	}
+
+	if _, err := tmpl.Render(map[string]any{"week": "1"}); err == nil {
+		t.Fatal("expected missing variable error")
+	}
+
+	list, err := List(dir)
+	if err != nil || len(list) != 1 || list[0].Name != "weekly" {
+		t.Fatalf("unexpected list %+v %v", list, err)
+	}
+}
+
+func TestParseVarsRejectsMissingKey(t *testing.T) {
+	if _, err := ParseVars([]string{"novalue"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRenderKeepsValuesOutOfFrontMatterStructure(t *testing.T) {
+	tmpl := &Template{
+		Name:        "invoice",
+		FrontMatter: "to: {{.email}}\nsubject: Invoice {{.number}}\nattachments: [invoices/{{.number}}.pdf]",
+		Body:        "Dear {{.name}}",
+	}
+	msg, err := tmpl.Render(map[string]any{
+		"email":  "alice@example.com",
+		"number": "7\nbcc: evil@example.net",
+		"name":   `Alice "A": Smith`,
+	})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if len(msg.Bcc) != 0 || strings.Join(msg.To, ";") != "alice@example.com" {
+		t.Fatalf("variable changed the recipients: to %v bcc %v", msg.To, msg.Bcc)
+	}
+	if msg.Subject != "Invoice 7\nbcc: evil@example.net" || msg.Attachments[0] != "invoices/7\nbcc: evil@example.net.pdf" {
+		t.Fatalf("unexpected values %q %v", msg.Subject, msg.Attachments)
+	}
+
+	msg, err = tmpl.Render(map[string]any{"email": "a@example.com, b@example.com", "number": "8", "name": "x"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if strings.Join(msg.To, ";") != "a@example.com;b@example.com" {
+		t.Fatalf("expected an address list variable to be split, got %v", msg.To)
+	}
+}
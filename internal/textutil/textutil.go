@@ -0,0 +1,35 @@
+// Package textutil holds small string helpers shared across packages.
+package textutil
+
+import "strings"
+
+// FirstNonEmpty returns the first value that is not "".
+func FirstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// FirstNonBlank returns the first value with anything besides white space,
+// unchanged. Use it for user input, where "  " means unset.
+func FirstNonBlank(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// IsASCII reports whether s holds only 7-bit characters.
+func IsASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,21 @@
+package textutil
+
+import "testing"
+
+func TestFirstNonEmptyAndBlank(t *testing.T) {
+	if got := FirstNonEmpty("", " ", "b"); got != " " {
+		t.Fatalf("FirstNonEmpty: got %q", got)
+	}
+	if got := FirstNonBlank("", " \t", "b"); got != "b" {
+		t.Fatalf("FirstNonBlank: got %q", got)
+	}
+	if got := FirstNonBlank(" ", ""); got != "" {
+		t.Fatalf("FirstNonBlank with only blanks: got %q", got)
+	}
+}
+
+func TestIsASCII(t *testing.T) {
+	if !IsASCII("example.com") || IsASCII("bänk.test") {
+		t.Fatal("unexpected IsASCII result")
+	}
+}
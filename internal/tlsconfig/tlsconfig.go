@@ -0,0 +1,170 @@
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"mailcli/internal/config"
+)
+
+const pinPrefix = "sha256/"
+
+var ErrPinMismatch = errors.New("tls: server certificate does not match any pinned public key")
+
+// New builds the TLS configuration for a server from its config section.
+// Pins are checked after (not instead of) normal verification unless
+// insecure is set.
+func New(opts config.TLSOptions, host string, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: insecure, //nolint:gosec // opt-in via insecure_skip_verify
+	}
+	if opts.ServerName != "" {
+		tlsConfig.ServerName = opts.ServerName
+	}
+
+	if opts.MinVersion != "" {
+		version, err := ParseVersion(opts.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if opts.CAFile != "" {
+		pool, err := loadCAFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(opts.PinSHA256) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range opts.PinSHA256 {
+			normalized, err := normalizePin(pin)
+			if err != nil {
+				return nil, err
+			}
+			pins[normalized] = true
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				if pins[Pin(cert)] {
+					return nil
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Capture returns a copy of base that accepts any certificate and records
+// the presented chain in state, for inspecting servers that fail
+// verification.
+func Capture(base *tls.Config) (*tls.Config, *tls.ConnectionState) {
+	state := &tls.ConnectionState{}
+	capture := base.Clone()
+	capture.InsecureSkipVerify = true //nolint:gosec // the chain is only recorded, never trusted
+	capture.VerifyConnection = func(cs tls.ConnectionState) error {
+		*state = cs
+		return nil
+	}
+	return capture, state
+}
+
+// Verify checks a presented chain against the roots and server name of
+// tlsConfig, the way the handshake would.
+func Verify(tlsConfig *tls.Config, certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       tlsConfig.ServerName,
+		Roots:         tlsConfig.RootCAs,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return err
+	}
+	if tlsConfig.VerifyConnection != nil {
+		return tlsConfig.VerifyConnection(tls.ConnectionState{PeerCertificates: certs})
+	}
+	return nil
+}
+
+// Pin returns the base64 SHA-256 digest of the certificate's public key in
+// the "sha256/..." form accepted by pin_sha256.
+func Pin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Fingerprint returns the colon-separated SHA-256 digest of the whole
+// certificate, as shown by most browsers and openssl.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func normalizePin(pin string) (string, error) {
+	value := strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix)
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid pin_sha256 %q (expected sha256/<base64 digest>)", pin)
+	}
+	return pinPrefix + value, nil
+}
+
+func ParseVersion(value string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid tls_min_version %q (expected 1.0, 1.1, 1.2 or 1.3)", value)
+}
+
+func loadCAFile(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path comes from the user's config
+	if err != nil {
+		return nil, fmt.Errorf("read ca_file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("ca_file %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
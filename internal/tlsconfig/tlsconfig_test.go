@@ -0,0 +1,123 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mailcli/internal/config"
+)
+
+func selfSigned(t *testing.T, name string) (tls.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func handshake(t *testing.T, serverCert tls.Certificate, clientConfig *tls.Config) error {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{serverCert}}).Handshake()
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	return tls.Client(conn, clientConfig).Handshake()
+}
+
+func TestCAFileAndServerName(t *testing.T) {
+	cert, certPEM := selfSigned(t, "mail.internal")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+
+	tlsConfig, err := New(config.TLSOptions{CAFile: caFile, ServerName: "mail.internal", MinVersion: "1.3"}, "10.0.0.5", false)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if tlsConfig.ServerName != "mail.internal" || tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("unexpected config: %+v", tlsConfig)
+	}
+	if err := handshake(t, cert, tlsConfig); err != nil {
+		t.Fatalf("handshake with ca_file: %v", err)
+	}
+
+	withoutCA, err := New(config.TLSOptions{ServerName: "mail.internal"}, "10.0.0.5", false)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := handshake(t, cert, withoutCA); err == nil {
+		t.Fatalf("expected handshake to fail without ca_file")
+	}
+}
+
+func TestPinning(t *testing.T) {
+	cert, _ := selfSigned(t, "mail.example.com")
+	other, _ := selfSigned(t, "mail.example.com")
+
+	pinned, err := New(config.TLSOptions{PinSHA256: []string{Pin(cert.Leaf)}}, "mail.example.com", true)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if err := handshake(t, cert, pinned); err != nil {
+		t.Fatalf("handshake with matching pin: %v", err)
+	}
+	if err := handshake(t, other, pinned); !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("expected pin mismatch, got %v", err)
+	}
+
+	if _, err := New(config.TLSOptions{PinSHA256: []string{"sha256/not-a-digest"}}, "mail.example.com", false); err == nil {
+		t.Fatalf("expected invalid pin to be rejected")
+	}
+	if _, err := New(config.TLSOptions{MinVersion: "1.4"}, "mail.example.com", false); err == nil {
+		t.Fatalf("expected invalid tls_min_version to be rejected")
+	}
+}
@@ -0,0 +1,236 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const redacted = "[redacted]"
+
+// lineFilter rewrites one protocol line (without CRLF) for display. It
+// returns the lines to log (none to suppress) and the literal, if any, that
+// the line announces.
+type lineFilter interface {
+	filter(line string) (display []string, lit literal)
+}
+
+type literal struct {
+	size   int
+	secret bool
+}
+
+// lineWriter splits a byte stream into protocol lines and literals so that
+// filters never see partial lines.
+type lineWriter struct {
+	prefix string
+	filter lineFilter
+
+	buf     []byte
+	lit     literal
+	litSeen int
+	litBuf  []byte
+}
+
+func newLineWriter(prefix string, filter lineFilter) *lineWriter {
+	return &lineWriter{prefix: prefix, filter: filter}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if w.lit.size > 0 {
+			k := w.lit.size - w.litSeen
+			if k > len(p) {
+				k = len(p)
+			}
+			if !w.lit.secret && len(w.litBuf) < MaxLiteral {
+				keep := k
+				if room := MaxLiteral - len(w.litBuf); keep > room {
+					keep = room
+				}
+				w.litBuf = append(w.litBuf, p[:keep]...)
+			}
+			w.litSeen += k
+			p = p[k:]
+			if w.litSeen == w.lit.size {
+				w.flushLiteral()
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			break
+		}
+		w.buf = append(w.buf, p[:i]...)
+		p = p[i+1:]
+		line := strings.TrimSuffix(string(w.buf), "\r")
+		w.buf = w.buf[:0]
+
+		display, lit := w.filter.filter(line)
+		for _, d := range display {
+			emit(w.prefix, d)
+		}
+		if lit.size > 0 {
+			w.lit = lit
+			w.litSeen = 0
+			w.litBuf = w.litBuf[:0]
+		}
+	}
+	return n, nil
+}
+
+func (w *lineWriter) flushLiteral() {
+	if w.lit.secret {
+		emit(w.prefix, fmt.Sprintf("[%d byte literal redacted]", w.lit.size))
+	} else {
+		for _, line := range strings.Split(strings.TrimRight(string(w.litBuf), "\r\n"), "\n") {
+			emit(w.prefix, strings.TrimSuffix(line, "\r"))
+		}
+		if w.lit.size > len(w.litBuf) {
+			emit(w.prefix, fmt.Sprintf("[... %d more bytes truncated]", w.lit.size-len(w.litBuf)))
+		}
+	}
+	w.lit = literal{}
+	w.litSeen = 0
+	w.litBuf = w.litBuf[:0]
+}
+
+var literalPattern = regexp.MustCompile(`\{(\d+)\+?\}$`)
+
+func trailingLiteral(line string) int {
+	m := literalPattern.FindStringSubmatch(line)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+var saslTokenPattern = regexp.MustCompile(`^[A-Za-z0-9+/=]*$`)
+
+type imapClientFilter struct {
+	// inLogin is set while a LOGIN command spans several literals.
+	inLogin bool
+	// inSASL is set after AUTHENTICATE until the client sends a new command.
+	inSASL bool
+}
+
+func (f *imapClientFilter) filter(line string) ([]string, literal) {
+	size := trailingLiteral(line)
+
+	if f.inLogin {
+		f.inLogin = size > 0
+		return []string{redacted}, literal{size: size, secret: true}
+	}
+
+	fields := strings.Fields(line)
+	if f.inSASL {
+		if len(fields) <= 1 && (line == "*" || saslTokenPattern.MatchString(line)) {
+			return []string{redacted}, literal{}
+		}
+		f.inSASL = false
+	}
+
+	if len(fields) >= 2 {
+		cmd := strings.ToUpper(fields[1])
+		if cmd == "UID" && len(fields) >= 3 {
+			cmd = strings.ToUpper(fields[2])
+		}
+		switch cmd {
+		case "LOGIN":
+			f.inLogin = size > 0
+			return []string{fields[0] + " LOGIN " + redacted}, literal{size: size, secret: true}
+		case "AUTHENTICATE":
+			f.inSASL = true
+			display := fields[0] + " AUTHENTICATE"
+			if len(fields) >= 3 {
+				display += " " + fields[2]
+			}
+			if len(fields) >= 4 {
+				display += " " + redacted
+			}
+			return []string{display}, literal{}
+		}
+	}
+	return []string{line}, literal{size: size}
+}
+
+type imapServerFilter struct{}
+
+func (f *imapServerFilter) filter(line string) ([]string, literal) {
+	// SASL challenges arrive as "+ <base64>" continuation requests.
+	if strings.HasPrefix(line, "+ ") {
+		rest := strings.TrimSpace(line[2:])
+		if rest != "" && !strings.Contains(rest, " ") && saslTokenPattern.MatchString(rest) {
+			return []string{"+ " + redacted}, literal{}
+		}
+	}
+	return []string{line}, literal{size: trailingLiteral(line)}
+}
+
+var smtpReplyPattern = regexp.MustCompile(`^(\d{3})([ -]|$)`)
+
+type smtpFilter struct {
+	inSASL    bool
+	inData    bool
+	dataShown int
+	dataTotal int
+}
+
+func (f *smtpFilter) filter(line string) ([]string, literal) {
+	if f.inData {
+		if line == "." {
+			f.inData = false
+			display := []string{}
+			if hidden := f.dataTotal - f.dataShown; hidden > 0 {
+				display = append(display, fmt.Sprintf("C: [... %d more bytes truncated]", hidden))
+			}
+			return append(display, "C: ."), literal{}
+		}
+		f.dataTotal += len(line) + 2
+		if f.dataShown >= MaxLiteral {
+			return nil, literal{}
+		}
+		f.dataShown += len(line) + 2
+		return []string{"C: " + line}, literal{}
+	}
+
+	if m := smtpReplyPattern.FindStringSubmatch(line); m != nil {
+		switch code := m[1]; {
+		case code == "334":
+			return []string{"S: 334 " + redacted}, literal{}
+		case code == "354":
+			f.inData = true
+			f.dataShown = 0
+			f.dataTotal = 0
+		default:
+			f.inSASL = false
+		}
+		return []string{"S: " + line}, literal{}
+	}
+
+	if f.inSASL {
+		return []string{"C: " + redacted}, literal{}
+	}
+	fields := strings.Fields(line)
+	if len(fields) >= 1 && strings.EqualFold(fields[0], "AUTH") {
+		f.inSASL = true
+		display := "AUTH"
+		if len(fields) >= 2 {
+			display += " " + fields[1]
+		}
+		if len(fields) >= 3 {
+			display += " " + redacted
+		}
+		return []string{"C: " + display}, literal{}
+	}
+	return []string{"C: " + line}, literal{}
+}
@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIMAPTraceRedactsLogin(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf, IMAP)
+	t.Cleanup(func() { _ = Close() })
+
+	client, server := IMAPWriters()
+	_, _ = client.Write([]byte("a1 LOGIN user@example.com hunter2\r\n"))
+	_, _ = client.Write([]byte("a2 LOGIN {4}\r\nuser {7}\r\nsecret!\r\n"))
+	_, _ = client.Write([]byte("a3 AUTHENTICATE PLAIN\r\n"))
+	_, _ = server.Write([]byte("+ \r\n"))
+	_, _ = client.Write([]byte("AHVzZXIAaHVudGVyMg==\r\n"))
+	_, _ = server.Write([]byte("+ dGVzdA==\r\n"))
+	_, _ = client.Write([]byte("a4 SELECT INBOX\r\n"))
+
+	got := buf.String()
+	for _, secret := range []string{"hunter2", "secret!", "AHVzZXIAaHVudGVyMg==", "dGVzdA=="} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("trace leaked %q:\n%s", secret, got)
+		}
+	}
+	for _, want := range []string{"imap C: a1 LOGIN [redacted]", "imap C: a3 AUTHENTICATE PLAIN", "imap S: + [redacted]", "imap C: a4 SELECT INBOX"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in trace:\n%s", want, got)
+		}
+	}
+}
+
+func TestIMAPTraceTruncatesLiterals(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf, IMAP)
+	t.Cleanup(func() { _ = Close() })
+
+	body := strings.Repeat("x", MaxLiteral+100)
+	_, server := IMAPWriters()
+	// Split the literal across writes like a network read would.
+	stream := "* 1 FETCH (BODY[] {" + strconv.Itoa(len(body)) + "}\r\n" + body + ")\r\n"
+	_, _ = server.Write([]byte(stream[:50]))
+	_, _ = server.Write([]byte(stream[50:]))
+
+	got := buf.String()
+	if !strings.Contains(got, "[... 100 more bytes truncated]") {
+		t.Fatalf("expected truncation note:\n%s", got)
+	}
+	if !strings.Contains(got, "imap S: )") {
+		t.Fatalf("expected response to continue after literal:\n%s", got)
+	}
+}
+
+func TestSMTPTraceRedactsAuthAndTruncatesData(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf, SMTP)
+	t.Cleanup(func() { _ = Close() })
+
+	w := SMTPWriter()
+	_, _ = w.Write([]byte("AUTH LOGIN\r\n334 VXNlcm5hbWU6\r\ndXNlcg==\r\n334 UGFzc3dvcmQ6\r\naHVudGVyMg==\r\n235 2.7.0 ok\r\n"))
+	_, _ = w.Write([]byte("DATA\r\n354 go ahead\r\n"))
+	_, _ = w.Write([]byte(strings.Repeat("line of body text\r\n", 200)))
+	_, _ = w.Write([]byte(".\r\n250 queued\r\n"))
+
+	got := buf.String()
+	if strings.Contains(got, "aHVudGVyMg==") || strings.Contains(got, "dXNlcg==") {
+		t.Fatalf("trace leaked credentials:\n%s", got)
+	}
+	for _, want := range []string{"smtp C: AUTH LOGIN", "smtp S: 334 [redacted]", "smtp C: [redacted]", "smtp S: 235 2.7.0 ok", "more bytes truncated]", "smtp C: .", "smtp S: 250 queued"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in trace:\n%s", want, got)
+		}
+	}
+}
+
+func TestConfigureRejectsUnknownProtocol(t *testing.T) {
+	if err := Configure("imap,pop3", ""); err == nil {
+		t.Fatalf("expected error for unknown protocol")
+	}
+	if err := Configure("", ""); err != nil {
+		t.Fatalf("empty spec: %v", err)
+	}
+	if Enabled(IMAP) || Enabled(SMTP) {
+		t.Fatalf("expected tracing disabled")
+	}
+}
@@ -0,0 +1,132 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	IMAP = "imap"
+	SMTP = "smtp"
+)
+
+// MaxLiteral is the number of bytes of a message literal (IMAP) or DATA
+// payload (SMTP) shown before the rest is summarised.
+var MaxLiteral = 1024
+
+var (
+	mu       sync.Mutex
+	enabled  = map[string]bool{}
+	out      io.Writer
+	outClose io.Closer
+)
+
+// Configure enables tracing for a comma-separated list of protocols ("imap",
+// "smtp", or "all"). Output goes to the file at path, or stderr when empty.
+func Configure(spec, path string) error {
+	protocols, err := parseSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	closeLocked()
+	enabled = protocols
+	if len(protocols) == 0 {
+		return nil
+	}
+	if path == "" {
+		out = os.Stderr
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		enabled = map[string]bool{}
+		return fmt.Errorf("open debug log: %w", err)
+	}
+	out = file
+	outClose = file
+	return nil
+}
+
+// SetOutput enables tracing for the given protocols and writes to w.
+func SetOutput(w io.Writer, protocols ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	closeLocked()
+	enabled = map[string]bool{}
+	for _, p := range protocols {
+		enabled[p] = true
+	}
+	out = w
+}
+
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	return closeLocked()
+}
+
+func closeLocked() error {
+	var err error
+	if outClose != nil {
+		err = outClose.Close()
+	}
+	out = nil
+	outClose = nil
+	return err
+}
+
+func Enabled(protocol string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return out != nil && enabled[protocol]
+}
+
+func parseSpec(spec string) (map[string]bool, error) {
+	protocols := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		switch p := strings.ToLower(strings.TrimSpace(part)); p {
+		case "", "0", "false", "off":
+		case "all", "1", "true", "on":
+			protocols[IMAP] = true
+			protocols[SMTP] = true
+		case IMAP, SMTP:
+			protocols[p] = true
+		default:
+			return nil, fmt.Errorf("invalid debug protocol %q (expected imap, smtp, or all)", p)
+		}
+	}
+	return protocols, nil
+}
+
+// IMAPWriters returns redacting writers for client and server IMAP traffic,
+// suitable for imap.NewDebugWriter, or nils when IMAP tracing is disabled.
+func IMAPWriters() (client, server io.Writer) {
+	if !Enabled(IMAP) {
+		return nil, nil
+	}
+	return newLineWriter("imap C: ", &imapClientFilter{}), newLineWriter("imap S: ", &imapServerFilter{})
+}
+
+// SMTPWriter returns a redacting writer for a full SMTP conversation, or nil
+// when SMTP tracing is disabled.
+func SMTPWriter() io.Writer {
+	if !Enabled(SMTP) {
+		return nil
+	}
+	return newLineWriter("smtp ", &smtpFilter{})
+}
+
+func emit(prefix, line string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if out == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(out, "%s%s\n", prefix, line)
+}